@@ -0,0 +1,168 @@
+// Package admin implements HTTP handler of cache introspection for
+// operators: statistics, listing of keys with their TTL, invalidation of
+// keys and flush of cache.
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Authorizer reports whether request is allowed, e.g. by checking its
+// bearer token or client certificate.
+type Authorizer func(r *http.Request) bool
+
+// KeyParser parses key of cache from path of request.
+type KeyParser[K comparable] func(s string) (K, error)
+
+// Handler serves following endpoints relative to its mount point, e.g.
+// mounted by http.StripPrefix:
+//
+//	GET    /stats                       statistics of cache
+//	GET    /keys?after=<key>&limit=<n>  page of keys with remaining TTL
+//	DELETE /keys/<key>                  removal of key
+//	POST   /flush                       removal of all keys
+//
+// Keys are listed in ascending order of their string form produced by
+// fmt.Sprint, next page starts after key returned in field next.
+type Handler[K comparable, V any] struct {
+	cache     *cache.Cache[K, V]
+	parseKey  KeyParser[K]
+	authorize Authorizer
+}
+
+// NewHandler returns admin handler of given cache, keys of requests are
+// parsed by parseKey and each request is authorized by authorize.
+// It panics if authorize is nil, so handler is never left unguarded.
+func NewHandler[K comparable, V any](c *cache.Cache[K, V], parseKey KeyParser[K], authorize Authorizer) *Handler[K, V] {
+	if authorize == nil {
+		panic("admin: authorizer must be set")
+	}
+	return &Handler[K, V]{cache: c, parseKey: parseKey, authorize: authorize}
+}
+
+// KeyEntry is entry of key listing.
+type KeyEntry struct {
+	Key string `json:"key"`
+	// TTLMs is remaining time to live in milliseconds, zero means that
+	// entry can be evicted only by policy.
+	TTLMs int64 `json:"ttl_ms"`
+}
+
+// KeyPage is page of key listing, next is empty on last page.
+type KeyPage struct {
+	Keys []KeyEntry `json:"keys"`
+	Next string     `json:"next,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case path == "stats":
+		if allow(w, r, http.MethodGet) {
+			writeJSON(w, h.cache.Stats())
+		}
+	case path == "keys":
+		if allow(w, r, http.MethodGet) {
+			h.listKeys(w, r)
+		}
+	case strings.HasPrefix(path, "keys/"):
+		if allow(w, r, http.MethodDelete) {
+			h.deleteKey(w, strings.TrimPrefix(path, "keys/"))
+		}
+	case path == "flush":
+		if allow(w, r, http.MethodPost) {
+			h.cache.Clear()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler[K, V]) listKeys(w http.ResponseWriter, r *http.Request) {
+	limit := defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "admin: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+	after := r.URL.Query().Get("after")
+
+	keys := h.cache.Keys()
+	names := make(map[string]K, len(keys))
+	sorted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := fmt.Sprint(key)
+		names[name] = key
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	page := KeyPage{Keys: make([]KeyEntry, 0, limit)}
+	for _, name := range sorted[sort.SearchStrings(sorted, after):] {
+		if name == after && after != "" {
+			continue
+		}
+		if len(page.Keys) == limit {
+			page.Next = page.Keys[len(page.Keys)-1].Key
+			break
+		}
+		// NOTE: key could be removed after listing.
+		ttl, ok := h.cache.GetTTL(names[name])
+		if !ok {
+			continue
+		}
+		page.Keys = append(page.Keys, KeyEntry{Key: name, TTLMs: ttl.Milliseconds()})
+	}
+	writeJSON(w, page)
+}
+
+func (h *Handler[K, V]) deleteKey(w http.ResponseWriter, s string) {
+	key, err := h.parseKey(s)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("admin: invalid key: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.cache.Pop(key); !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allow reports whether request has given method, otherwise it responds
+// with status 405.
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
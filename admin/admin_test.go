@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+func Test_Handler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := cache.NewCache[int, string](ctx, 10)
+	for i := 0; i < 5; i++ {
+		c.SetNX(i, `value`, time.Hour)
+	}
+	c.Set(5, `persistent`)
+
+	handler := NewHandler(c, strconv.Atoi, func(r *http.Request) bool {
+		return r.Header.Get(`Authorization`) == `Bearer secret`
+	})
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(`Authorization`, `Bearer secret`)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, `/flush`, nil))
+	if rec.Code != http.StatusForbidden || c.Len() != 6 {
+		t.Fatalf(`expected unauthorized request forbidden, got %d`, rec.Code)
+	}
+
+	var stats cache.Stats
+	if rec := do(http.MethodGet, `/stats`); rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&stats) != nil || stats.Len != 6 {
+		t.Fatalf(`expected stats, got %d`, rec.Code)
+	}
+
+	var keys []KeyEntry
+	after := ``
+	for pages := 0; ; pages++ {
+		var page KeyPage
+		rec := do(http.MethodGet, `/keys?limit=4&after=`+after)
+		if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&page) != nil {
+			t.Fatalf(`expected page of keys, got %d`, rec.Code)
+		}
+		keys = append(keys, page.Keys...)
+		if page.Next == `` {
+			if pages != 1 {
+				t.Fatalf(`expected 2 pages, got %d`, pages+1)
+			}
+			break
+		}
+		after = page.Next
+	}
+	if len(keys) != 6 || keys[0].Key != `0` || keys[5].Key != `5` {
+		t.Fatalf(`expected all keys in order, got %v`, keys)
+	}
+	if keys[0].TTLMs <= 0 || keys[5].TTLMs != 0 {
+		t.Fatalf(`expected TTL of keys, got %v`, keys)
+	}
+
+	if rec := do(http.MethodDelete, `/keys/3`); rec.Code != http.StatusNoContent || c.Contains(3) {
+		t.Fatalf(`expected key deleted, got %d`, rec.Code)
+	}
+	if rec := do(http.MethodDelete, `/keys/3`); rec.Code != http.StatusNotFound {
+		t.Fatalf(`expected missing key not found, got %d`, rec.Code)
+	}
+	if rec := do(http.MethodDelete, `/keys/three`); rec.Code != http.StatusBadRequest {
+		t.Fatalf(`expected invalid key rejected, got %d`, rec.Code)
+	}
+	if rec := do(http.MethodGet, `/flush`); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf(`expected wrong method rejected, got %d`, rec.Code)
+	}
+	if rec := do(http.MethodPost, `/flush`); rec.Code != http.StatusNoContent || c.Len() != 0 {
+		t.Fatalf(`expected cache flushed, got %d`, rec.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchKeys is number of precomputed keys of benchmark workload.
+const benchKeys = 1 << 20
+
+var benchPolicies = []struct {
+	name   string
+	policy evictionPolicy
+}{
+	{`LRU`, LRU},
+	{`LFU`, LFU},
+	{`ARC`, ARC},
+	{`TinyLFU`, TinyLFU},
+	{`Hyperbolic`, Hyperbolic},
+}
+
+var benchCapacities = []int{1_000, 100_000}
+
+// benchDistributions are key distributions of workload, keys are drawn from
+// range ten times larger than capacity, so workload has misses.
+var benchDistributions = []struct {
+	name string
+	keys func(capacity int) []int
+}{
+	{`uniform`, func(capacity int) []int {
+		r := rand.New(rand.NewSource(1))
+		keys := make([]int, benchKeys)
+		for i := range keys {
+			keys[i] = r.Intn(10 * capacity)
+		}
+		return keys
+	}},
+	{`zipf`, func(capacity int) []int {
+		zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, uint64(10*capacity-1))
+		keys := make([]int, benchKeys)
+		for i := range keys {
+			keys[i] = int(zipf.Uint64())
+		}
+		return keys
+	}},
+}
+
+// benchmark runs given workload over matrix of policies, capacities and key
+// distributions against cache prefilled with keys of workload.
+func benchmark(b *testing.B, workload func(b *testing.B, cache *Cache[int, int], keys []int), opts ...Option) {
+	for _, dist := range benchDistributions {
+		for _, capacity := range benchCapacities {
+			keys := dist.keys(capacity)
+			for _, p := range benchPolicies {
+				name := fmt.Sprintf(`%s/%s/capacity=%d`, dist.name, p.name, capacity)
+				b.Run(name, func(b *testing.B) {
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					cache := NewCache[int, int](ctx, capacity, append([]Option{WithEvictionPolicy(p.policy)}, opts...)...)
+					for _, key := range keys[:2*capacity] {
+						cache.Set(key, key)
+					}
+					b.ReportAllocs()
+					b.ResetTimer()
+					workload(b, cache, keys)
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkGet measures lookups, it must not allocate.
+func BenchmarkGet(b *testing.B) {
+	benchmark(b, func(b *testing.B, cache *Cache[int, int], keys []int) {
+		for i := 0; i < b.N; i++ {
+			cache.Get(keys[i&(benchKeys-1)])
+		}
+	})
+}
+
+func BenchmarkSet(b *testing.B) {
+	benchmark(b, func(b *testing.B, cache *Cache[int, int], keys []int) {
+		for i := 0; i < b.N; i++ {
+			key := keys[i&(benchKeys-1)]
+			cache.Set(key, key)
+		}
+	})
+}
+
+func BenchmarkSetNX(b *testing.B) {
+	benchmark(b, func(b *testing.B, cache *Cache[int, int], keys []int) {
+		for i := 0; i < b.N; i++ {
+			key := keys[i&(benchKeys-1)]
+			cache.SetNX(key, key, time.Minute)
+		}
+	})
+}
+
+// BenchmarkMixed measures concurrent workload of 75% lookups and 25%
+// insertions, missed keys are inserted, by each locking mode.
+func BenchmarkMixed(b *testing.B) {
+	for _, mode := range []struct {
+		name string
+		mode LockingMode
+	}{
+		{`SpinLock`, SpinLock},
+		{`RWMutexLock`, RWMutexLock},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			benchmark(b, func(b *testing.B, cache *Cache[int, int], keys []int) {
+				b.RunParallel(func(pb *testing.PB) {
+					i := rand.Intn(benchKeys)
+					for pb.Next() {
+						key := keys[i&(benchKeys-1)]
+						if _, ok := cache.Get(key); !ok || i%4 == 0 {
+							cache.Set(key, key)
+						}
+						i++
+					}
+				})
+			}, WithLocking(mode.mode))
+		})
+	}
+}
+
+// BenchmarkSetBurst measures latency of Set of new keys to full cache,
+// p99 of single Set is reported by p99-ns metric.
+func BenchmarkSetBurst(b *testing.B) {
+	for _, batch := range []int{1, 64, 256} {
+		b.Run(`batch=`+strconv.Itoa(batch), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cache := NewCache[int, int](ctx, 10_000, WithEvictionBatch(batch), WithDefaultTTL(time.Minute))
+			latencies := make([]time.Duration, b.N)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				cache.Set(i, i)
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[len(latencies)*99/100]), `p99-ns`)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log/slog"
+	"math/rand"
+	"sync"
+)
+
+// Bus is publish-subscribe channel shared by instances of cache, which
+// delivers invalidations of keys to peers, e.g. bus over Redis pub/sub
+// channel of package redisbus: Publish sends message by PUBLISH and
+// Subscribe receives messages of SUBSCRIBE connection by background
+// goroutine. Messages published by instance may be delivered to its own
+// handler, cache ignores them.
+type Bus interface {
+	// Publish sends message to all subscribers.
+	Publish(msg []byte) error
+	// Subscribe registers handler of messages, which may be called
+	// concurrently. Returned function cancels subscription.
+	Subscribe(handler func(msg []byte)) (cancel func(), err error)
+}
+
+// invalidation is message of bus, origin identifies publishing instance.
+type invalidation[K comparable] struct {
+	Origin uint64
+	Key    K
+}
+
+// invalidator publishes keys set or removed by cache to bus by single
+// writer, so operations under cache lock do not wait for bus and keys are
+// published in order.
+type invalidator[K comparable] struct {
+	bus         Bus
+	origin      uint64
+	publisher   *dispatcher
+	unsubscribe func()
+	// closed guards cancellation of subscription, since cache is stopped
+	// by both Close and cancellation of its context.
+	closed sync.Once
+	logger *slog.Logger
+}
+
+func newInvalidator[K comparable](bus Bus, logger *slog.Logger) *invalidator[K] {
+	if bus == nil {
+		return nil
+	}
+	return &invalidator[K]{
+		bus:       bus,
+		origin:    rand.Uint64(),
+		publisher: newDispatcher(1, invalidationQueueSize),
+		logger:    logger,
+	}
+}
+
+func (i *invalidator[K]) publish(key K) {
+	i.publisher.dispatch(func() {
+		msg, err := encodeGob(invalidation[K]{Origin: i.origin, Key: key})
+		if err == nil {
+			err = i.bus.Publish(msg)
+		}
+		if err != nil {
+			logWarn(i.logger, "ttlcache: publish of invalidation failed", slog.Any("error", err))
+		}
+	})
+}
+
+// close cancels subscription and waits for queued invalidations.
+func (i *invalidator[K]) close() {
+	i.closed.Do(func() {
+		if i.unsubscribe != nil {
+			i.unsubscribe()
+		}
+	})
+	i.publisher.close()
+}
+
+// subscribe registers handler of invalidations published by peers.
+func (c *Cache[K, V]) subscribe() {
+	unsubscribe, err := c.invalidator.bus.Subscribe(c.onInvalidation)
+	if err != nil {
+		logWarn(c.logger, "ttlcache: subscription to invalidation bus failed", slog.Any("error", err))
+		return
+	}
+	c.invalidator.unsubscribe = unsubscribe
+}
+
+// onInvalidation removes key invalidated by peer, removal is not published
+// back to bus.
+func (c *Cache[K, V]) onInvalidation(msg []byte) {
+	var inv invalidation[K]
+	if err := gob.NewDecoder(bytes.NewReader(msg)).Decode(&inv); err != nil {
+		logWarn(c.logger, "ttlcache: malformed invalidation", slog.Any("error", err))
+		return
+	}
+	if inv.Origin == c.invalidator.origin {
+		return
+	}
+
+	c.acquire()
+	defer c.release()
+
+	c.quietly(func() { c.remove(inv.Key, Removed) })
+}
+
+// quietly runs fn, which modifications are not published to peers. Must be
+// called under cache lock.
+func (c *Cache[K, V]) quietly(fn func()) {
+	quiet := c.quiet
+	c.quiet = true
+	fn()
+	c.quiet = quiet
+}
+
+// invalidate publishes key set or removed explicitly to peers, if bus is
+// configured by WithInvalidationBus.
+func (c *Cache[K, V]) invalidate(key K) {
+	if c.invalidator == nil || c.quiet {
+		return
+	}
+	c.invalidator.publish(key)
+}
+
+// localBus is bus of instances of cache within process.
+type localBus struct {
+	lock     sync.RWMutex
+	next     int
+	handlers map[int]func(msg []byte)
+}
+
+// NewLocalBus returns bus, which delivers messages to subscribers of the
+// same process synchronously, e.g. to keep several caches over the same
+// data consistent or to test invalidation without message broker.
+func NewLocalBus() Bus {
+	return &localBus{handlers: make(map[int]func(msg []byte))}
+}
+
+func (b *localBus) Publish(msg []byte) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *localBus) Subscribe(handler func(msg []byte)) (func(), error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		delete(b.handlers, id)
+	}, nil
+}
@@ -2,62 +2,338 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	"hash/maphash"
+	"log/slog"
 	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/moeryomenko/synx"
-
+	"github.com/moeryomenko/ttlcache/internal/backoff"
 	"github.com/moeryomenko/ttlcache/internal/policies"
 )
 
 // Cache is cache with TTL and eviction over capacity.
 type Cache[K comparable, V any] struct {
-	cache    replacementCacher[K, entry[V]]
-	capacity int
+	cache     Policy[K, *entry[V]]
+	newPolicy func() Policy[K, *entry[V]]
+	capacity  int
+
+	lock locker
+	// ticks is number of TTL epochs passed, which are not applied yet by
+	// externally synchronized cache.
+	ticks      atomic.Int64
+	lazyExpiry bool
+	// janitor reports whether background goroutine runs, otherwise TTL
+	// epochs are counted by clock and epochEnd is end of current epoch.
+	janitor  bool
+	epochEnd atomic.Int64
+	// janitorRunning and janitorBeat are liveness of janitor and time of
+	// its last run in nanoseconds, see Healthy.
+	janitorRunning atomic.Bool
+	janitorBeat    atomic.Int64
+	// paused suspends collection of expired entries.
+	paused atomic.Bool
+	// readMostly enables copy-on-write index, see WithReadMostly.
+	readMostly bool
+	// retick passes new TTL epoch granularity to janitor.
+	retick chan time.Duration
+	clock  Clock
+	// manual is clock of cache in manual mode, see WithManualTicks.
+	manual *manualClock
+	ttl    *ttlIndex[K]
+	pinned map[K]*entry[V]
+	calls  map[K]*call[V]
+	// loader loads values missed by Get, see WithLoader.
+	loader func(ctx context.Context, key K) (V, time.Duration, error)
+	// bulkLoader loads values missed by GetMany, see WithBulkLoader.
+	bulkLoader func(ctx context.Context, keys []K) (map[K]V, error)
+	// backing is store written through by explicit modifications, see
+	// WithWriteThrough.
+	backing BackingStore[K, V]
+	// writeBehind queues explicit modifications to backing store, see
+	// WithWriteBehind.
+	writeBehind *writeBehind[K, V]
+	// loaderRetry configures retry of failed loads, see WithLoaderRetry.
+	loaderRetry retryPolicy
+	// negative is failures of loader cached for negativeTTL, which errors
+	// are accepted by cacheable, see WithNegativeCaching.
+	negative    map[K]failure
+	negativeTTL time.Duration
+	cacheable   func(err error) bool
+	index       *index[K, V]
+	reads       *readBuffer[K]
+	keyLocks    keyLocks[K]
+	// writeLocks serializes writes of key to backing store, they are
+	// separate from keyLocks, so writes do not wait for callers of LockKey.
+	writeLocks keyLocks[K]
+	// evictions is number of policy evictions during current epoch.
+	evictions int
+
+	// disabled cache stores nothing.
+	disabled bool
+	// closed cache is disabled and its background work is stopped.
+	closed       bool
+	evictOnClose bool
+	// redactJSON omits values from JSON encoding, see WithJSONRedaction.
+	redactJSON bool
+	// options are options of cache, cloner copies values, see Clone.
+	options []Option
+	cloner  func(value V) V
+
+	defaultTTL time.Duration
+	sliding    bool
+	jitter     float64
+	maxTTL     time.Duration
+	admission  func(key K, value V) bool
+	filter     Admission
+	seed       maphash.Seed
+	sizer      func(key K, value V) int64
+	weigher    func(key K, value V) int64
+	maxWeight  int64
+	// maxEntrySize is limit of single entry size, zero means no limit.
+	maxEntrySize int64
+	// highWatermark and lowWatermark are shares of capacity and max weight,
+	// zero means that eviction starts over limit and evicts down to it.
+	highWatermark float64
+	lowWatermark  float64
+	// overshoot is share of limit evicted additionally without watermarks.
+	overshoot float64
+	// evictionBatch is number of entries over capacity evicted at once,
+	// victims collects entries evicted by policy in single pass.
+	evictionBatch int
+	victims       victims[K, V]
+	evicting      bool
+	// oplog records operations, see WithOperationLog.
+	oplog *opLog[K, V]
+	// persistFile is file of snapshot, see WithPersistFile.
+	persistFile string
+	// overflow is second tier of evicted entries, see WithOverflowStore
+	// and WithEvictionSpill.
+	overflow *overflow[K, V]
+	// demote moves evicted entries with their remaining TTL to L2 of
+	// exclusive Tiered, which uses cache as L1, see NewTiered.
+	demote func(key K, value V, ttl time.Duration) error
+	// deferred is work of operations under cache lock, which runs after
+	// lock is released, see release.
+	deferred []func()
+	// invalidator publishes explicit modifications to peers, see
+	// WithInvalidationBus, quiet is set while values are filled by loaders
+	// or invalidations of peers are applied, so they are not published.
+	invalidator *invalidator[K]
+	quiet       bool
+	// weight is total weight of entries computed by weigher.
+	weight int64
 
-	lock        synx.Spinlock
-	epoch       uint64
-	granularity time.Duration
-	ttlMap      map[uint64][]K
+	onEvict    func(key K, value V)
+	onExpire   func(key K, value V)
+	onRemoval  func(key K, value V, reason Reason)
+	onSet      func(key K, value V)
+	onRemove   func(key K, value V)
+	onReject   func(key K, value V)
+	dispatcher *dispatcher
+	// emitLock guards closing of expired channel against delivery.
+	emitLock sync.RWMutex
+	stopped  bool
+	expired  chan Entry[K, V]
+	ctx      context.Context
+	done     <-chan struct{}
+	cancel   context.CancelFunc
+
+	// expiredDropped is number of expired entries dropped by full buffer
+	// of expired channel.
+	expiredDropped atomic.Uint64
+
+	logger  *slog.Logger
+	metrics MetricsListener
+	stats   counters
+	window  window
 }
 
-// NewCache returns cache with selected eviction policy.
+// NewCache returns cache with selected eviction policy. Non-positive capacity
+// means that cache is unbounded and entries are removed only by TTL.
 func NewCache[K comparable, V any](ctx context.Context, capacity int, opts ...Option) *Cache[K, V] {
+	ctx, cancel := context.WithCancel(ctx)
 	cfg := config{
 		policy:      LRU,
 		granularity: defaultEpochGranularity,
+		clock:       systemClock{},
 	}
 
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
+	if cfg.clock == nil {
+		cfg.clock = systemClock{}
+	}
+	var manual *manualClock
+	if cfg.manualTicks {
+		manual = newManualClock(cfg.clock.Now())
+		cfg.clock, cfg.noJanitor = manual, true
+	}
+	if cfg.granularity <= 0 {
+		logWarn(cfg.logger, "ttlcache: non-positive TTL epoch granularity, default is used",
+			slog.Duration("granularity", cfg.granularity), slog.Duration("default", defaultEpochGranularity))
+		cfg.granularity = defaultEpochGranularity
+	}
+	if capacity <= 0 {
+		if cfg.maxWeight > 0 || cfg.maxBytes > 0 {
+			logWarn(cfg.logger, "ttlcache: weight limit is ignored by unbounded cache",
+				slog.Int64("max_weight", cfg.maxWeight), slog.Int64("max_bytes", cfg.maxBytes))
+			cfg.maxWeight, cfg.maxBytes = 0, 0
+		}
+		// NOTE: unbounded cache is never evicted by policy, only by TTL.
+		cfg.policy, cfg.customPolicy = NOOP, nil
+	}
+	if cfg.disabled {
+		cfg.policy, cfg.customPolicy = NOOP, nil
+	}
+	if cfg.maxBytes > 0 && (cfg.weigher != nil || cfg.maxWeight > 0) {
+		logWarn(cfg.logger, "ttlcache: max bytes overrides weigher and max weight",
+			slog.Int64("max_bytes", cfg.maxBytes), slog.Int64("max_weight", cfg.maxWeight))
+	}
+	if (cfg.highWatermark != 0 || cfg.lowWatermark != 0) &&
+		!(0 < cfg.lowWatermark && cfg.lowWatermark < cfg.highWatermark && cfg.highWatermark <= 1) {
+		logWarn(cfg.logger, "ttlcache: invalid watermarks are ignored",
+			slog.Float64("high", cfg.highWatermark), slog.Float64("low", cfg.lowWatermark))
+		cfg.highWatermark, cfg.lowWatermark = 0, 0
+	}
+	if cfg.maxTTL > 0 && cfg.defaultTTL > cfg.maxTTL {
+		logWarn(cfg.logger, "ttlcache: default TTL exceeds max TTL and will be clamped",
+			slog.Duration("default_ttl", cfg.defaultTTL), slog.Duration("max_ttl", cfg.maxTTL))
+	}
+
 	cache := &Cache[K, V]{
-		capacity:    capacity,
-		granularity: cfg.granularity,
-		ttlMap:      make(map[uint64][]K),
-	}
-	switch cfg.policy {
-	case LRU:
-		cache.cache = policies.NewLRUCache[K, entry[V]](capacity)
-	case LFU:
-		cache.cache = policies.NewLFUCache[K, entry[V]](capacity)
-	case ARC:
-		cache.cache = policies.NewARCCache[K, entry[V]](capacity)
-	case NOOP:
-		cache.cache = policies.NewNoEvictionCache[K, entry[V]](capacity)
-	default:
-		panic("Unknown eviction policy")
+		capacity:      capacity,
+		lock:          newLocker(cfg.locking),
+		lazyExpiry:    cfg.locking == NoLock || cfg.noJanitor,
+		janitor:       !cfg.noJanitor,
+		readMostly:    cfg.readMostly && !cfg.sliding,
+		disabled:      cfg.disabled,
+		clock:         cfg.clock,
+		manual:        manual,
+		defaultTTL:    cfg.defaultTTL,
+		sliding:       cfg.sliding,
+		jitter:        cfg.jitter,
+		maxTTL:        cfg.maxTTL,
+		logger:        cfg.logger,
+		sizer:         sizerFunc[K, V](cfg.sizer),
+		weigher:       weigherFunc[K, V](cfg.weigher, cfg.maxWeight),
+		maxWeight:     cfg.maxWeight,
+		maxEntrySize:  cfg.maxEntrySize,
+		highWatermark: cfg.highWatermark,
+		lowWatermark:  cfg.lowWatermark,
+		overshoot:     cfg.overshoot,
+		evictionBatch: max(cfg.evictionBatch, 1),
+		pinned:        make(map[K]*entry[V]),
+		calls:         make(map[K]*call[V]),
+		reads:         newReadBuffer[K](),
+		ctx:           ctx,
+		done:          ctx.Done(),
+		loader:        loaderFunc[K, V](cfg.loader),
+		bulkLoader:    bulkLoaderFunc[K, V](cfg.bulkLoader),
+		loaderRetry:   cfg.loaderRetry,
+		backing:       backingStore[K, V](cfg.backing),
+		negative:      make(map[K]failure),
+		negativeTTL:   cfg.negativeTTL,
+		cacheable:     cfg.cacheable,
+		cancel:        cancel,
+		evictOnClose:  cfg.evictOnClose,
+		redactJSON:    cfg.redactJSON,
+		options:       opts,
+		cloner:        clonerFunc[V](cfg.cloner),
+		oplog:         newOpLog[K, V](cfg.opLog),
+		persistFile:   cfg.persistFile,
+		overflow:      newOverflow[K, V](cfg.overflow, cfg.asyncSpill, cfg.logger),
+		invalidator:   newInvalidator[K](cfg.bus, cfg.logger),
+		onEvict:       callback[K, V](cfg.onEvict),
+		onExpire:      callback[K, V](cfg.onExpire),
+		onRemoval:     removalCallback[K, V](cfg.onRemoval),
+		onSet:         callback[K, V](cfg.onSet),
+		onRemove:      callback[K, V](cfg.onRemove),
+		onReject:      callback[K, V](cfg.onReject),
+		admission:     admissionFunc[K, V](cfg.admission),
+		filter:        cfg.admissionFilter,
+		seed:          maphash.MakeSeed(),
+	}
+	cache.newPolicy = func() Policy[K, *entry[V]] {
+		if cfg.customPolicy != nil {
+			return newCustomPolicy(cfg.customPolicy, cache.policyCapacity(), cache.evicted)
+		}
+		return newReplacementCacher(cfg.policy, cache.policyCapacity(), cache.evicted)
+	}
+	cache.cache = cache.newPolicy()
+	cache.victims = newVictims[K, V](cache.evictionBatch)
+	cache.index = newIndex[K, V](cache.seed, cache.readMostly)
+	if cache.readMostly {
+		cache.lock = &publishingLock{locker: cache.lock, publish: cache.index.publish}
+	}
+	cache.ttl = newTTLIndex[K](cfg.granularity, cache.clock.Now())
+	if cfg.maxBytes > 0 {
+		cache.weigher, cache.maxWeight = cache.sizer, cfg.maxBytes
+	}
+	_, cache.window.slotStart = cache.ttl.current()
+	cache.epochEnd.Store(cache.window.slotStart.Add(cfg.granularity).UnixNano())
+	cache.metrics = listeners{&cache.stats, &cache.window}
+	if cfg.metrics != nil {
+		cache.metrics = append(cache.metrics.(listeners), cfg.metrics)
+	}
+	if cfg.expiredBuffer > 0 {
+		cache.expired = make(chan Entry[K, V], cfg.expiredBuffer)
+	}
+	if cfg.callbackWorkers > 0 {
+		cache.dispatcher = newDispatcher(cfg.callbackWorkers, cfg.callbackQueue)
+	}
+	if cfg.writeBehind != nil {
+		cache.writeBehind = newWriteBehind(cache.backing, *cfg.writeBehind, cfg.logger)
+		cache.backing = nil
+		go cache.writeBehind.run(ctx)
+	}
+	context.AfterFunc(ctx, cache.shutdown)
+	if cache.invalidator != nil {
+		cache.subscribe()
+	}
+	for key, seed := range initialEntries[K, V](cfg.initialEntries) {
+		if seed.TTL > 0 {
+			cache.SetNX(key, seed.Value, seed.TTL)
+			continue
+		}
+		cache.Set(key, seed.Value)
+	}
+	if cache.persistFile != "" && !cache.disabled {
+		if err := cache.loadFile(cache.persistFile); err != nil {
+			logWarn(cache.logger, "ttlcache: restore of persist file failed",
+				slog.String("path", cache.persistFile), slog.Any("error", err))
+		}
+	}
+
+	if cache.disabled || !cache.janitor {
+		return cache
 	}
 
+	cache.retick = make(chan time.Duration, 1)
+	cache.janitorRunning.Store(true)
+	cache.janitorBeat.Store(cache.clock.Now().UnixNano())
 	go func() {
-		ttlTicker := time.NewTicker(cache.granularity)
-		defer ttlTicker.Stop()
+		ttlTicker := cache.clock.NewTicker(cfg.granularity)
+		defer func() {
+			ttlTicker.Stop()
+			cache.janitorRunning.Store(false)
+		}()
 
 		for {
 			select {
-			case <-ttlTicker.C:
+			case <-ttlTicker.C():
+				cache.janitorBeat.Store(cache.clock.Now().UnixNano())
 				cache.collectExpired()
+			case granularity := <-cache.retick:
+				cache.janitorBeat.Store(cache.clock.Now().UnixNano())
+				ttlTicker.Stop()
+				ttlTicker = cache.clock.NewTicker(granularity)
 			case <-ctx.Done():
 				return
 			}
@@ -67,121 +343,1887 @@ func NewCache[K comparable, V any](ctx context.Context, capacity int, opts ...Op
 	return cache
 }
 
-// Set sets new or updates key-value pair to cache, which can be evicted only by policy.
+// NewDisabledCache returns cache in pass-through mode, which stores nothing,
+// see WithDisabled.
+func NewDisabledCache[K comparable, V any](opts ...Option) *Cache[K, V] {
+	return NewCache[K, V](context.Background(), 0, append(opts, WithDisabled(true))...)
+}
+
+// Set sets new or updates key-value pair to cache, which can be evicted only by policy,
+// unless default expiration time is configured by WithDefaultTTL.
 func (c *Cache[K, V]) Set(key K, value V) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.store(key, value, c.setDefault)
+}
 
-	// NOTE: set max epoch value, prevent eviction by ttl, but can be
-	// evicted by replacement policy.
-	c.cache.Set(key, entry[V]{value: value, epoch: math.MaxUint64})
+// store sets key-value pair by given setter, value is written through to
+// backing store first, see WithWriteThrough, and queued to write-behind
+// store, see WithWriteBehind. Errors are described by SetE.
+func (c *Cache[K, V]) store(key K, value V, set func(key K, value V)) error {
+	if c.backing != nil {
+		unlock := c.lockWrite(key)
+		defer unlock()
+		if refused, err := c.refuses(); refused {
+			return err
+		}
+		if err := c.writeThrough(key, value); err != nil {
+			return err
+		}
+	}
+	c.acquire()
+	defer c.release()
 
-	if c.cache.Len() > c.capacity {
-		c.evict(1)
+	if c.closed {
+		return ErrClosed
+	}
+	set(key, value)
+	c.queueWrite(key, value)
+	if _, ok := c.peek(key); !ok && !c.disabled {
+		return ErrCapacityExceeded
+	}
+	return nil
+}
+
+// refuses reports whether disabled cache refuses writes, so they do not
+// reach backing store, and returns ErrClosed if cache is closed.
+func (c *Cache[K, V]) refuses() (bool, error) {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	if c.closed {
+		return true, ErrClosed
+	}
+	return c.disabled, nil
+}
+
+// setDefault sets key-value pair with default expiration time, if it is
+// configured by WithDefaultTTL.
+func (c *Cache[K, V]) setDefault(key K, value V) {
+	if c.defaultTTL > 0 {
+		c.setNX(key, value, c.defaultTTL)
+		return
 	}
+
+	c.set(key, value)
+}
+
+// SetE is Set, which reports why value is not stored: ErrClosed if cache
+// is closed, error of backing store configured by WithWriteThrough or
+// ErrCapacityExceeded if entry is refused by admission or evicted at once.
+// Disabled cache stores nothing without error.
+func (c *Cache[K, V]) SetE(key K, value V) error {
+	return c.store(key, value, c.setDefault)
 }
 
 // SetNX sets new or updates key-value pair with given expiration time.
 func (c *Cache[K, V]) SetNX(key K, value V, expiry time.Duration) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.store(key, value, func(key K, value V) { c.setNX(key, value, expiry) })
+}
 
-    if item, ok := c.cache.Get(key); ok {
-		c.removeFromTTL(item.epoch, item.slot)
+// SetMany sets new or updates given key-value pairs with given expiration time.
+func (c *Cache[K, V]) SetMany(items map[K]V, expiry time.Duration) {
+	if c.backing != nil {
+		// NOTE: each key is written through under its own lock.
+		for key, value := range items {
+			c.SetNX(key, value, expiry)
+		}
+		return
+	}
+	c.acquire()
+	defer c.release()
+
+	for key, value := range items {
+		c.setNX(key, value, expiry)
+		c.queueWrite(key, value)
 	}
+}
 
-    epoch, slot := c.emplaceToTTLBucket(key, expiry)
-	c.cache.Set(key, entry[V]{value: value, epoch: epoch, slot: slot})
+// SetWithDeadline sets new or updates key-value pair which expires at given time.
+func (c *Cache[K, V]) SetWithDeadline(key K, value V, deadline time.Time) {
+	c.store(key, value, func(key K, value V) { c.setWithDeadline(key, value, deadline) })
+}
 
-	if c.cache.Len() > c.capacity {
-		c.evict(1)
+// GetOrSet returns existing value by given key, otherwise sets given value
+// with expiration time. The loaded result is true if value was present in cache.
+func (c *Cache[K, V]) GetOrSet(key K, value V, expiry time.Duration) (V, bool) {
+	if c.backing != nil {
+		unlock := c.lockWrite(key)
+		defer unlock()
+	}
+	c.acquire()
+	if item, ok := c.get(key); ok {
+		c.release()
+		return item.value, true
 	}
+	if c.backing != nil {
+		if c.disabled {
+			c.release()
+			return value, false
+		}
+		c.release()
+		if c.writeThrough(key, value) != nil {
+			return value, false
+		}
+		c.acquire()
+	}
+
+	c.setNX(key, value, expiry)
+	c.queueWrite(key, value)
+	c.release()
+	return value, false
+}
+
+// GetOrCompute returns existing value by given key, otherwise computes it by fn
+// and sets it with returned expiration time. Concurrent callers of same missing
+// key wait for single computation and share its result. Failed computation
+// result is not cached.
+func (c *Cache[K, V]) GetOrCompute(key K, fn func() (V, time.Duration, error)) (V, error) {
+	return c.fetch(context.Background(), key, fn)
+}
+
+// GetOrComputeCtx is GetOrCompute, which stops waiting for computation
+// started by concurrent caller when ctx is done and returns error of ctx.
+// Computation is not started if ctx is already done.
+func (c *Cache[K, V]) GetOrComputeCtx(ctx context.Context, key K, fn func() (V, time.Duration, error)) (V, error) {
+	return c.fetch(ctx, key, fn)
+}
+
+// fetch returns existing value by given key, otherwise computes it by fn
+// once for concurrent callers and sets it. Callers wait for computation
+// until ctx is done.
+func (c *Cache[K, V]) fetch(ctx context.Context, key K, fn func() (V, time.Duration, error)) (V, error) {
+	var v V
+	c.acquire()
+	if item, ok := c.get(key); ok {
+		c.release()
+		return item.value, nil
+	}
+	if cl, ok := c.calls[key]; ok {
+		c.release()
+		select {
+		case <-cl.done:
+			return cl.value, cl.err
+		case <-ctx.Done():
+			return v, ctx.Err()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		c.release()
+		return v, err
+	}
+	cl := &call[V]{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.release()
+
+	defer func() {
+		c.acquire()
+		delete(c.calls, key)
+		if cl.err == nil {
+			c.quietly(func() { c.setNX(key, cl.value, cl.expiry) })
+		}
+		c.release()
+		close(cl.done)
+	}()
+
+	cl.err = errComputePanicked
+	cl.value, cl.expiry, cl.err = fn()
+
+	return cl.value, cl.err
 }
 
-// Get returns value by given key.
+// Get returns value by given key, missing value is read from overflow
+// store or loaded by loader, see WithOverflowStore and WithLoader.
 func (c *Cache[K, V]) Get(key K) (V, bool) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	value, ok, _ := c.GetCtx(c.ctx, key)
+	return value, ok
+}
 
-	item, ok := c.cache.Get(key)
+// GetE is Get, which reports why value is missing: ErrClosed if cache is
+// closed, error of loader, ErrExpired if expiration time of entry has
+// passed, but entry was not yet removed by janitor, otherwise ErrNotFound.
+// Such entry is removed and loaded again by loader as missing one.
+func (c *Cache[K, V]) GetE(key K) (V, error) {
+	var v V
+	c.acquire()
+	if c.closed {
+		c.release()
+		return v, ErrClosed
+	}
+	// NOTE: expiration is checked before get, which prolongs expiration
+	// time of entry in sliding mode.
+	item, ok := c.peek(key)
+	expired := false
+	if ok {
+		_, pinned := c.pinned[key]
+		expired = !pinned && !item.deadline.IsZero() && !item.deadline.After(c.clock.Now())
+	}
+	if ok && !expired {
+		item, _ = c.get(key)
+	}
+	if expired {
+		// NOTE: entry is removed ahead of janitor, so it is not returned
+		// by lookups of miss.
+		c.remove(key, Expired)
+	}
+	c.release()
+	if ok && !expired {
+		return item.value, nil
+	}
+
+	value, ok, err := c.miss(c.ctx, key)
+	switch {
+	case err != nil:
+		return value, err
+	case ok:
+		return value, nil
+	case expired:
+		return value, ErrExpired
+	default:
+		return value, ErrNotFound
+	}
+}
+
+// GetCtx is Get, which passes ctx to loader and stops waiting for load
+// started by concurrent caller when ctx is done. Error is error of loader,
+// of ctx or cached failure of loader, see WithNegativeCaching.
+func (c *Cache[K, V]) GetCtx(ctx context.Context, key K) (V, bool, error) {
+	if c.sliding {
+		c.acquire()
+		item, ok := c.get(key)
+		c.release()
+		if ok {
+			return item.value, ok, nil
+		}
+		return c.miss(ctx, key)
+	}
+
+	// NOTE: lookup does not take cache lock, access is buffered and
+	// applied to policy later, by reader which fills buffer or by janitor.
+	c.catchUp()
+	hash := c.index.hash(key)
+	item, ok := c.index.loadHashed(hash, key)
+	if c.readMostly {
+		// NOTE: lookup of copy-on-write index is only counted, policy
+		// is not updated.
+		c.reads.count(hash, ok)
+	} else {
+		switch n := c.reads.push(hash, read[K]{key: key, hit: ok}); {
+		case n >= readBufferSize:
+			c.acquire()
+			c.release()
+		case n >= readBufferSize/2 && c.lock.TryLock():
+			c.drain()
+			c.release()
+		}
+	}
+	if ok {
+		return item.value, ok, nil
+	}
+	return c.miss(ctx, key)
+}
+
+// miss returns value missed by Get from overflow store or loader.
+func (c *Cache[K, V]) miss(ctx context.Context, key K) (V, bool, error) {
+	value, ok := c.readOverflow(key)
+	if ok || c.loader == nil {
+		return value, ok, nil
+	}
+	if c.negativeTTL > 0 {
+		if err := c.failed(key); err != nil {
+			return value, false, err
+		}
+	}
+	value, err := c.fetch(ctx, key, func() (value V, expiry time.Duration, err error) {
+		// NOTE: queued write of key must reach backing store read by loader.
+		if c.writeBehind != nil {
+			c.writeBehind.flushKey(ctx, key)
+		}
+		err = c.retry(ctx, func() error {
+			value, expiry, err = c.loader(ctx, key)
+			return err
+		})
+		// NOTE: failure caused by done context is failure of caller.
+		if err != nil && c.negativeTTL > 0 && ctx.Err() == nil {
+			c.fail(key, err)
+		}
+		return value, expiry, err
+	})
+	return value, err == nil, err
+}
+
+// retry calls load until it succeeds or number of attempts configured by
+// WithLoaderRetry is reached, attempts are delayed by exponential backoff
+// with jitter. Retry stops when ctx is done.
+func (c *Cache[K, V]) retry(ctx context.Context, load func() error) error {
+	err := load()
+	delay := c.loaderRetry.backoff
+	for attempt := 1; attempt < c.loaderRetry.attempts && err != nil && ctx.Err() == nil; attempt++ {
+		if !backoff.Wait(ctx, delay) {
+			return err
+		}
+		delay = min(2*delay, max(c.loaderRetry.maxBackoff, c.loaderRetry.backoff))
+		err = load()
+	}
+	return err
+}
+
+// failed returns error of last load of given key, if it failed within
+// negative cache TTL, see WithNegativeCaching.
+func (c *Cache[K, V]) failed(key K) error {
+	c.acquire()
+	defer c.release()
+
+	cached, ok := c.negative[key]
+	if !ok {
+		return nil
+	}
+	if !c.clock.Now().Before(cached.deadline) {
+		delete(c.negative, key)
+		return nil
+	}
+	return cached.err
+}
+
+// fail caches failure of load of given key, if error is accepted by
+// predicate of WithNegativeCaching. Number of failures is bounded by
+// capacity, expired failures are swept when limit is reached.
+func (c *Cache[K, V]) fail(key K, err error) {
+	if c.cacheable != nil && !c.cacheable(err) {
+		return
+	}
+
+	c.acquire()
+	defer c.release()
+
+	now := c.clock.Now()
+	if limit := max(c.capacity, minNegativeLimit); len(c.negative) >= limit {
+		for k, cached := range c.negative {
+			if !now.Before(cached.deadline) {
+				delete(c.negative, k)
+			}
+		}
+		if len(c.negative) >= limit {
+			return
+		}
+	}
+	c.negative[key] = failure{err: err, deadline: now.Add(c.negativeTTL)}
+}
+
+// GetMany returns values by given keys, missing keys are omitted from result.
+// Missing values are loaded by single call of bulk loader, see WithBulkLoader.
+func (c *Cache[K, V]) GetMany(keys []K) map[K]V {
+	c.acquire()
+	values := make(map[K]V, len(keys))
+	var missing []K
+	for _, key := range keys {
+		if item, ok := c.get(key); ok {
+			values[key] = item.value
+		} else if c.bulkLoader != nil {
+			missing = append(missing, key)
+		}
+	}
+	c.release()
+
+	if len(missing) == 0 {
+		return values
+	}
+	var loaded map[K]V
+	err := c.retry(c.ctx, func() (err error) {
+		loaded, err = c.bulkLoader(c.ctx, missing)
+		return err
+	})
+	if err != nil {
+		return values
+	}
+
+	c.acquire()
+	defer c.release()
+
+	for _, key := range missing {
+		value, ok := loaded[key]
+		if !ok {
+			continue
+		}
+		// NOTE: key could be set while lock was released.
+		if item, ok := c.peek(key); ok {
+			values[key] = item.value
+			continue
+		}
+		c.quietly(func() { c.setDefault(key, value) })
+		values[key] = value
+	}
+	return values
+}
+
+// GetTTL returns approximate remaining time to live of entry by given key,
+// zero duration means that entry can be evicted only by policy.
+func (c *Cache[K, V]) GetTTL(key K) (time.Duration, bool) {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	item, ok := c.peek(key)
+	if !ok {
+		return 0, false
+	}
+	if item.deadline.IsZero() {
+		return 0, true
+	}
+	return max(item.deadline.Sub(c.clock.Now()), 0), true
+}
+
+// Touch moves entry by given key to new expiration time without updating
+// its value and eviction policy state. Returns false if key is not present.
+func (c *Cache[K, V]) Touch(key K, expiry time.Duration) bool {
+	c.acquire()
+	defer c.release()
+
+	return c.expire(key, expiry)
+}
+
+// Expire changes expiration time of entry by given key, non-positive expiry
+// removes entry immediately. Returns false if key is not present.
+func (c *Cache[K, V]) Expire(key K, expiry time.Duration) bool {
+	c.acquire()
+	defer c.release()
+
+	if expiry <= 0 {
+		_, ok := c.remove(key, Expired)
+		return ok
+	}
+
+	return c.expire(key, expiry)
+}
+
+// Persist removes expiration time of entry by given key, so it can be
+// evicted only by policy. Returns false if key is not present.
+func (c *Cache[K, V]) Persist(key K) bool {
+	c.acquire()
+	defer c.release()
+
+	item, ok := c.peek(key)
+	if !ok {
+		return false
+	}
+
+	c.ttl.remove(key)
+	item.epoch, item.expiry, item.deadline = math.MaxUint64, 0, time.Time{}
+	c.logOp(opRecord[K, V]{Op: opSet, Key: key, Value: item.value})
+	return true
+}
+
+// Now returns current time of cache clock, expiration times returned by
+// cache are relative to it.
+func (c *Cache[K, V]) Now() time.Time {
+	return c.clock.Now()
+}
+
+// GetWithExpiry returns value by given key with its expiration time, zero
+// time means that entry can be evicted only by policy.
+func (c *Cache[K, V]) GetWithExpiry(key K) (V, time.Time, bool) {
+	c.acquire()
+	defer c.release()
+
+	item, ok := c.get(key)
+	if ok {
+		return item.value, item.deadline, ok
+	}
+	var v V
+	return v, time.Time{}, ok
+}
+
+// Peek returns value by given key without updating eviction policy state
+// (e.g. recency in LRU).
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.catchUp()
+	item, ok := c.index.load(key)
 	if ok {
 		return item.value, ok
 	}
-        var v V
+	var v V
 	return v, ok
 }
 
-// Remove removes cache entry by given key.
+// Contains reports whether cache contains entry by given key, without
+// updating eviction policy state.
+func (c *Cache[K, V]) Contains(key K) bool {
+	c.catchUp()
+	_, ok := c.index.load(key)
+	return ok
+}
+
+// Remove removes cache entry by given key, e.g. to invalidate it. Backing
+// store configured by WithWriteThrough or WithWriteBehind is not modified,
+// see Delete.
 func (c *Cache[K, V]) Remove(key K) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.acquire()
+	defer c.release()
+
+	c.remove(key, Removed)
+}
+
+// Pop returns and removes cache entry by given key, backing store is not
+// modified as by Remove.
+func (c *Cache[K, V]) Pop(key K) (V, bool) {
+	c.acquire()
+	defer c.release()
+
+	item, ok := c.remove(key, Removed)
+	if ok {
+		return item.value, ok
+	}
+	var v V
+	return v, ok
+}
+
+// Delete removes entry by given key from cache and from backing store
+// configured by WithWriteThrough or WithWriteBehind, e.g. when record of
+// key is deleted. Without backing store it is equivalent to Remove.
+func (c *Cache[K, V]) Delete(key K) {
+	if c.backing != nil {
+		unlock := c.lockWrite(key)
+		defer unlock()
+		if refused, _ := c.refuses(); refused {
+			return
+		}
+		c.deleteThrough(key)
+	}
+	c.acquire()
+	defer c.release()
+
+	c.remove(key, Removed)
+	c.queueDelete(key)
+}
+
+// Pin exempts entry by given key from eviction by policy and expiration
+// until it is unpinned. Returns false if key is not present.
+func (c *Cache[K, V]) Pin(key K) bool {
+	c.acquire()
+	defer c.release()
+
+	return c.pin(key)
+}
+
+// pin moves entry by given key from eviction policy to pinned entries.
+func (c *Cache[K, V]) pin(key K) bool {
+	if _, ok := c.pinned[key]; ok {
+		return true
+	}
+	item, ok := c.cache.Peek(key)
+	if !ok {
+		return false
+	}
 
+	c.ttl.remove(key)
+	item.epoch = math.MaxUint64
 	c.cache.Remove(key)
+	c.pinned[key] = item
+	return true
 }
 
-// Len returns current size of cache.
-func (c *Cache[K, V]) Len() int {
-	return c.cache.Len()
+// Unpin returns pinned entry by given key under control of eviction policy
+// and expiration. Entry which deadline has passed while it was pinned
+// expires on next TTL epoch. Returns false if key is not pinned.
+func (c *Cache[K, V]) Unpin(key K) bool {
+	c.acquire()
+	defer c.release()
+
+	item, ok := c.pinned[key]
+	if !ok {
+		return false
+	}
+
+	delete(c.pinned, key)
+	if !item.deadline.IsZero() {
+		c.scheduleAt(key, item, item.deadline)
+	}
+	c.cache.Set(key, item)
+	c.shrink(false)
+	return true
 }
 
-func (c *Cache[K, V]) emplaceToTTLBucket(key K, expiration time.Duration) (epoch uint64, slot int) {
-	index := uint64(expiration/c.granularity) + c.epoch
-	if _, ok := c.ttlMap[index]; ok {
-		c.ttlMap[index] = append(c.ttlMap[index], key)
-		return index, len(c.ttlMap[index]) - 1
+// Resize changes capacity of cache at runtime, entries over new capacity
+// are evicted by policy. Custom policy is resized only if it implements
+// Resizer, otherwise it stays bounded by capacity it was created with.
+// Unbounded cache and non-positive capacity are not resized.
+func (c *Cache[K, V]) Resize(capacity int) {
+	c.acquire()
+	defer c.release()
+
+	if c.capacity <= 0 || capacity <= 0 {
+		logWarn(c.logger, "ttlcache: resize of unbounded cache or to non-positive capacity is ignored",
+			slog.Int("capacity", c.capacity), slog.Int("new_capacity", capacity))
+		return
 	}
 
-	c.ttlMap[index] = []K{key}
-	return index, 0
+	c.capacity = capacity
+	if resizer, ok := c.cache.(Resizer); ok {
+		resizer.Resize(c.policyCapacity())
+	}
+	c.shrink(false)
 }
 
-func (c *Cache[K, V]) removeFromTTL(epoch uint64, slot int) {
-	slots := c.ttlMap[epoch]
-	c.ttlMap[epoch] = append(slots[:slot], slots[slot+1:]...)
+// Evict removes up to n entries, entries which are due to expire in current
+// TTL epoch are removed first, rest are evicted by policy. Pinned entries
+// are never evicted. Returns number of removed entries.
+func (c *Cache[K, V]) Evict(n int) int {
+	c.acquire()
+	defer c.release()
+
+	if n <= 0 {
+		return 0
+	}
+	size := c.len()
+	c.evict(n)
+	return size - c.len()
 }
 
-func (c *Cache[K, V]) collectExpired() {
-	c.lock.Lock()
-	defer func() {
-		c.epoch++
-		c.lock.Unlock()
-	}()
+// Cleanup removes entries which expiration time has passed, without
+// waiting for end of current TTL epoch. Returns number of removed entries.
+func (c *Cache[K, V]) Cleanup() int {
+	c.acquire()
+	defer c.release()
 
-	c.removeExpired()
+	return c.removeDue()
 }
 
-func (c *Cache[K, V]) removeExpired() int {
-	removeCount := 0
+// Tick advances time of cache in manual mode by given duration and removes
+// entries, which expiration time has passed. See WithManualTicks.
+func (c *Cache[K, V]) Tick(d time.Duration) {
+	if c.manual == nil {
+		logWarn(c.logger, "ttlcache: tick of cache not in manual mode is ignored")
+		return
+	}
+	c.manual.advance(d)
 
-	for epochCounter := c.epoch; epochCounter >= 0; epochCounter-- {
-		epochBucket, ok := c.ttlMap[epochCounter]
-		if !ok {
-			return removeCount
-		}
-		for _, key := range epochBucket {
-			c.cache.Remove(key)
+	c.acquire()
+	defer c.release()
+
+	c.removeDue()
+}
+
+// AdvanceEpoch advances time of cache in manual mode by given number of TTL
+// epochs, see Tick.
+func (c *Cache[K, V]) AdvanceEpoch(n int) {
+	c.Tick(time.Duration(n) * c.ttl.period())
+}
+
+// removeDue removes entries which expiration time has passed.
+func (c *Cache[K, V]) removeDue() int {
+	now := c.clock.Now()
+	removed := 0
+	// NOTE: passed deadlines belong to current epoch, previous ones are
+	// already collected.
+	for _, key := range c.ttl.due() {
+		if item, ok := c.peek(key); ok && !item.deadline.After(now) {
+			c.remove(key, Expired)
+			removed++
 		}
+	}
+	return removed
+}
 
-		delete(c.ttlMap, epochCounter)
+// SetGranularity changes TTL epoch granularity of running cache, scheduled
+// entries are rescheduled to epochs of new granularity by their expiration
+// time and janitor ticker is restarted with new period. Non-positive
+// granularity is ignored.
+func (c *Cache[K, V]) SetGranularity(granularity time.Duration) {
+	if granularity <= 0 {
+		logWarn(c.logger, "ttlcache: non-positive TTL epoch granularity is ignored",
+			slog.Duration("granularity", granularity))
+		return
 	}
 
-	return removeCount
-}
+	c.acquire()
+	defer c.release()
 
-func (c *Cache[K, V]) evict(count int) {
-	removed := c.removeExpired()
-	if count <= removed {
+	now := c.clock.Now()
+	for _, key := range c.ttl.rescale(granularity, now) {
+		if item, ok := c.peek(key); ok {
+			item.epoch = c.ttl.emplace(key, item.deadline)
+		}
+	}
+	c.epochEnd.Store(now.Add(granularity).UnixNano())
+	if c.retick == nil {
 		return
 	}
+	// NOTE: janitor is the only receiver, so pending granularity is
+	// replaced by new one.
+	for {
+		select {
+		case c.retick <- granularity:
+			return
+		default:
+			select {
+			case <-c.retick:
+			default:
+			}
+		}
+	}
+}
 
-	count -= removed
+// LockKey locks mutex of given key and returns function, which unlocks it
+// and must be called once. It serializes read-modify-write sequences of
+// callers of LockKey on the same key, but it does not block other cache
+// operations on the key. Mutex exists only while key is locked or awaited.
+func (c *Cache[K, V]) LockKey(key K) func() {
+	return c.keyLocks.lock(c.index.hash(key), key)
+}
 
-	c.cache.Evict(count)
+// lockWrite locks key for write to backing store, see WithWriteThrough.
+func (c *Cache[K, V]) lockWrite(key K) func() {
+	return c.writeLocks.lock(c.index.hash(key), key)
 }
 
-type entry[V any] struct {
-	value V
+// PauseExpiry suspends collection of expired entries, e.g. during bulk
+// load, expired entries remain in cache until ResumeExpiry is called.
+func (c *Cache[K, V]) PauseExpiry() {
+	c.paused.Store(true)
+}
+
+// ResumeExpiry resumes collection of expired entries, entries expired
+// during pause are collected by next TTL epoch.
+func (c *Cache[K, V]) ResumeExpiry() {
+	c.paused.Store(false)
+}
+
+// Keys returns keys of all entries in cache. Order of keys depends on
+// eviction policy.
+func (c *Cache[K, V]) Keys() []K {
+	c.acquire()
+	defer c.release()
+
+	return c.keys()
+}
+
+// Items returns snapshot of all entries in cache with their expiration time.
+func (c *Cache[K, V]) Items() map[K]Item[V] {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	items := make(map[K]Item[V], c.len())
+	for _, key := range c.keys() {
+		item, _ := c.peek(key)
+		items[key] = Item[V]{Value: item.value, ExpiresAt: item.deadline, clock: c.clock}
+	}
+	return items
+}
+
+// Clear removes all entries from cache.
+func (c *Cache[K, V]) Clear() {
+	c.acquire()
+	defer c.release()
+
+	c.clear()
+	c.logOp(opRecord[K, V]{Op: opClear})
+}
+
+// clear removes all entries with notification.
+func (c *Cache[K, V]) clear() {
+	if c.onRemoval != nil {
+		for _, key := range c.keys() {
+			item, _ := c.peek(key)
+			c.notify(key, item.value, Cleared)
+		}
+	}
+
+	c.reset()
+}
+
+// Close stops janitor and callback workers and releases all entries,
+// further operations are no-ops as if cache is disabled. Eviction callbacks
+// are called for remaining entries if WithEvictOnClose is used, queued
+// callbacks are run before Close returns. Cache is stopped by cancellation
+// of context passed to NewCache too, but entries are retained then.
+// Entries are saved to file configured by WithPersistFile, error of save
+// is returned.
+func (c *Cache[K, V]) Close() error {
+	c.acquire()
+	if c.closed {
+		c.release()
+		return nil
+	}
+	c.closed = true
+
+	var err error
+	if c.persistFile != "" && !c.disabled {
+		err = c.saveFile(c.persistFile)
+	}
+	var remaining []Entry[K, V]
+	if c.evictOnClose {
+		for _, key := range c.keys() {
+			item, _ := c.peek(key)
+			remaining = append(remaining, Entry[K, V]{Key: key, Value: item.value})
+		}
+	}
+	c.reset()
+	c.disabled = true
+	c.release()
+
+	// NOTE: callbacks may call cache, so they are dispatched and run
+	// without cache lock.
+	for _, e := range remaining {
+		c.notify(e.Key, e.Value, Evicted)
+	}
+	c.shutdown()
+	c.cancel()
+	return err
+}
+
+// Healthy verifies that cache is operational: janitor runs and internal
+// invariants hold, e.g. TTL index does not track more keys than cache
+// holds. Returns nil if cache is healthy, it is intended for readiness
+// probes.
+func (c *Cache[K, V]) Healthy() error {
+	c.acquire()
+	defer c.release()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if c.disabled {
+		return nil
+	}
+	if c.janitor {
+		if !c.janitorRunning.Load() {
+			return errJanitorStopped
+		}
+		idle := c.clock.Now().Sub(time.Unix(0, c.janitorBeat.Load()))
+		if idle > janitorStallEpochs*c.ttl.period() {
+			return fmt.Errorf("%w: last run %s ago", errJanitorStalled, idle)
+		}
+	}
+	size := c.len()
+	if scheduled := c.ttl.scheduled(); scheduled > size {
+		return fmt.Errorf("%w: %d keys for %d entries", errTTLIndexOverflow, scheduled, size)
+	}
+	if indexed := c.index.len(); indexed != size {
+		return fmt.Errorf("%w: %d indexed for %d entries", errIndexMismatch, indexed, size)
+	}
+	if c.weight < 0 {
+		return fmt.Errorf("%w: %d", errNegativeWeight, c.weight)
+	}
+	return nil
+}
+
+// reset removes all entries without notification.
+func (c *Cache[K, V]) reset() {
+	c.cache = c.newPolicy()
+	c.ttl.clear()
+	c.pinned = make(map[K]*entry[V])
+	c.index.clear()
+	clear(c.negative)
+	c.weight = 0
+}
+
+// Expired returns channel of expired entries, configured by WithExpiredBuffer,
+// otherwise it returns nil channel.
+func (c *Cache[K, V]) Expired() <-chan Entry[K, V] {
+	return c.expired
+}
+
+// ExpiredDropped returns number of expired entries, which were not
+// delivered to channel returned by Expired, since its buffer was full.
+func (c *Cache[K, V]) ExpiredDropped() uint64 {
+	return c.expiredDropped.Load()
+}
+
+// CallbacksDropped returns number of callbacks, which were dropped, since
+// queue of WithAsyncCallbacks was full.
+func (c *Cache[K, V]) CallbacksDropped() uint64 {
+	if c.dispatcher == nil {
+		return 0
+	}
+	return c.dispatcher.dropped.Load()
+}
+
+// Stats returns cache statistics.
+func (c *Cache[K, V]) Stats() Stats {
+	c.acquire()
+	defer c.release()
+
+	stats := c.stats.snapshot()
+	stats.Len = c.len()
+	return stats
+}
+
+// RecentStats returns cache statistics over given recent period, which is
+// rounded up to 10 seconds and limited by 15 minutes. Accuracy of period
+// bounds is limited by TTL epoch granularity.
+func (c *Cache[K, V]) RecentStats(period time.Duration) Stats {
+	c.acquire()
+	defer c.release()
+
+	stats := c.window.stats(period)
+	stats.Len = c.len()
+	return stats
+}
+
+// TTLHistogram returns distribution of remaining TTL of entries over given
+// upper bounds of histogram buckets. Remaining TTL is approximated by TTL
+// epoch granularity.
+func (c *Cache[K, V]) TTLHistogram(bounds []time.Duration) TTLHistogram {
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	histogram := TTLHistogram{
+		Bounds: bounds,
+		Counts: make([]int, len(bounds)+1),
+	}
+
+	scheduled := 0
+	for remaining, count := range c.ttl.remaining(c.clock.Now()) {
+		i, _ := slices.BinarySearch(bounds, remaining)
+		histogram.Counts[i] += count
+		scheduled += count
+	}
+	histogram.Persistent = c.len() - scheduled
+
+	return histogram
+}
+
+// EntryInfo returns access metadata of entry by given key without updating
+// eviction policy state.
+func (c *Cache[K, V]) EntryInfo(key K) (EntryInfo, bool) {
+	c.acquire()
+	defer c.release()
+
+	item, ok := c.peek(key)
+	if !ok {
+		return EntryInfo{}, false
+	}
+	_, pinned := c.pinned[key]
+	return EntryInfo{
+		CreatedAt:  item.createdAt,
+		UpdatedAt:  item.updatedAt,
+		AccessedAt: item.accessedAt,
+		ExpiresAt:  item.deadline,
+		Hits:       item.hits,
+		Pinned:     pinned,
+	}, true
+}
+
+// EstimatedBytes returns estimated size of all entries in bytes, computed
+// by sizer configured with WithSizer or by reflection-based estimation.
+func (c *Cache[K, V]) EstimatedBytes() int64 {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	var size int64
+	for _, key := range c.keys() {
+		item, _ := c.peek(key)
+		size += c.sizer(key, item.value)
+	}
+	return size
+}
+
+// Weight returns total weight of entries computed by weigher configured
+// with WithWeigher, or number of entries if only WithMaxWeight is used.
+func (c *Cache[K, V]) Weight() int64 {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	return c.weight
+}
+
+// Len returns current size of cache.
+func (c *Cache[K, V]) Len() int {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	return c.len()
+}
+
+// peek returns entry by given key without updating eviction policy state.
+func (c *Cache[K, V]) peek(key K) (*entry[V], bool) {
+	if item, ok := c.cache.Peek(key); ok {
+		return item, ok
+	}
+	item, ok := c.pinned[key]
+	return item, ok
+}
+
+// keys returns keys of all entries including pinned ones.
+func (c *Cache[K, V]) keys() []K {
+	keys := c.cache.Keys()
+	for key := range c.pinned {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// len returns number of all entries including pinned ones.
+func (c *Cache[K, V]) len() int {
+	return c.cache.Len() + len(c.pinned)
+}
+
+// get returns entry by given key and updates eviction policy state,
+// in sliding mode it also prolongs expiration time of entry.
+func (c *Cache[K, V]) get(key K) (*entry[V], bool) {
+	item, ok := c.lookup(key)
+	c.record(key, item, ok)
+	if !ok {
+		return nil, false
+	}
+
+	if c.sliding && item.epoch != math.MaxUint64 {
+		c.ttl.remove(key)
+		c.schedule(key, item, item.expiry)
+	}
+	return item, true
+}
+
+// lookup returns entry by given key and updates eviction policy state.
+func (c *Cache[K, V]) lookup(key K) (*entry[V], bool) {
+	item, ok := c.cache.Get(key)
+	if !ok {
+		item, ok = c.pinned[key]
+	}
+	return item, ok
+}
+
+// record records lookup of key to metrics and admission filter, and updates
+// access metadata of found entry.
+func (c *Cache[K, V]) record(key K, item *entry[V], hit bool) {
+	if c.filter != nil {
+		c.filter.Record(policies.HashKey(c.seed, key))
+	}
+	if !hit {
+		c.metrics.RecordMiss()
+		return
+	}
+
+	c.metrics.RecordHit()
+	if item != nil {
+		item.accessedAt = c.clock.Now()
+		item.hits++
+	}
+}
+
+// acquire takes cache lock and applies reads buffered by Get, so cache
+// operations observe eviction policy state of all preceding lookups.
+func (c *Cache[K, V]) acquire() {
+	c.lock.Lock()
+	c.drain()
+	if c.lazyExpiry {
+		c.advance()
+	}
+}
+
+// release releases cache lock taken by acquire and runs work deferred by
+// operation under lock, e.g. I/O of demotion of evicted entries.
+func (c *Cache[K, V]) release() {
+	deferred := c.deferred
+	c.deferred = nil
+	c.lock.Unlock()
+
+	for _, fn := range deferred {
+		fn()
+	}
+}
+
+// acquireShared takes cache lock shared for operations, which do not
+// modify cache state.
+func (c *Cache[K, V]) acquireShared() {
+	c.catchUp()
+	c.lock.RLock()
+}
+
+// catchUp applies passed TTL epochs of cache with lazy expiration before
+// operation without exclusive cache lock.
+func (c *Cache[K, V]) catchUp() {
+	if c.lazyExpiry && c.behind() {
+		c.acquire()
+		c.release()
+	}
+}
+
+// behind reports whether TTL epochs passed, which are not applied yet.
+func (c *Cache[K, V]) behind() bool {
+	if c.paused.Load() {
+		return false
+	}
+	if c.janitor {
+		return c.ticks.Load() > 0
+	}
+	return c.clock.Now().UnixNano() >= c.epochEnd.Load()
+}
+
+// advance collects expired entries of TTL epochs passed since last cache
+// operation of cache with lazy expiration.
+func (c *Cache[K, V]) advance() {
+	if c.paused.Load() {
+		return
+	}
+	if c.janitor {
+		for c.ticks.Load() > 0 {
+			c.ticks.Add(-1)
+			c.tick(true)
+		}
+		return
+	}
+
+	// NOTE: without janitor epochs are counted by clock, epochs of idle
+	// cache without scheduled keys are skipped at once.
+	passed := c.ttl.passed(c.clock.Now())
+	if passed > 1 && c.ttl.skip(uint64(passed-1)) {
+		passed = 1
+	}
+	for ; passed > 0; passed-- {
+		c.tick(true)
+	}
+}
+
+// drain applies reads buffered by Get to eviction policy and metrics.
+func (c *Cache[K, V]) drain() {
+	for i := range c.reads.stripes {
+		stripe := &c.reads.stripes[i]
+		reads := stripe.take()
+		for _, r := range reads {
+			var item *entry[V]
+			if r.hit {
+				item, _ = c.lookup(r.key)
+			}
+			c.record(r.key, item, r.hit)
+		}
+		stripe.release(reads)
+		for n := stripe.hits.Swap(0); n > 0; n-- {
+			c.metrics.RecordHit()
+		}
+		for n := stripe.misses.Swap(0); n > 0; n-- {
+			c.metrics.RecordMiss()
+		}
+	}
+}
+
+func (c *Cache[K, V]) set(key K, value V) {
+	if !c.admit(key, value) {
+		return
+	}
+	c.replace(key)
+
+	// NOTE: set max epoch value, prevent eviction by ttl, but can be
+	// evicted by replacement policy.
+	c.insert(key, &entry[V]{value: value, epoch: math.MaxUint64})
+}
+
+func (c *Cache[K, V]) setWithDeadline(key K, value V, deadline time.Time) {
+	if !c.admit(key, value) {
+		return
+	}
+	c.replace(key)
+
+	item := &entry[V]{value: value}
+	c.scheduleAt(key, item, deadline)
+	item.expiry = deadline.Sub(c.clock.Now())
+	c.insert(key, item)
+}
+
+func (c *Cache[K, V]) setNX(key K, value V, expiry time.Duration) {
+	if !c.admit(key, value) {
+		return
+	}
+	c.replace(key)
+
+	item := &entry[V]{value: value}
+	c.schedule(key, item, expiry)
+	c.insert(key, item)
+}
+
+// insert puts prepared entry to policy and evicts entries over capacity.
+func (c *Cache[K, V]) insert(key K, item *entry[V]) {
+	item.updatedAt = c.clock.Now()
+	if c.weigher != nil {
+		item.weight = c.weigher(key, item.value)
+		c.weight += item.weight
+	}
+	if old, ok := c.peek(key); ok {
+		item.createdAt, item.accessedAt, item.hits = old.createdAt, old.accessedAt, old.hits
+		c.weight -= old.weight
+	} else {
+		item.createdAt = item.updatedAt
+	}
+
+	evictions := c.evictions
+	c.index.store(key, item)
+	delete(c.negative, key)
+	c.logOp(opRecord[K, V]{Op: opSet, Key: key, Value: item.value, Deadline: item.deadline})
+	c.invalidate(key)
+	_, pinned := c.pinned[key]
+	if pinned {
+		c.pinned[key] = item
+	} else {
+		c.cache.Set(key, item)
+	}
+	c.metrics.RecordSet()
+	if c.onSet != nil {
+		value := item.value
+		c.dispatch(func() { c.onSet(key, value) })
+	}
+
+	if !pinned {
+		c.shrink(c.evictions > evictions)
+	}
+}
+
+// admit reports whether new key can be inserted to full cache by admission
+// function and admission filter, oversized entries are refused and replace
+// existing value by removal.
+func (c *Cache[K, V]) admit(key K, value V) bool {
+	if c.disabled {
+		return false
+	}
+	if c.oversized(key, value) {
+		c.remove(key, Replaced)
+		if c.onReject != nil {
+			c.dispatch(func() { c.onReject(key, value) })
+		}
+		return false
+	}
+
+	var hash uint64
+	if c.filter != nil {
+		hash = policies.HashKey(c.seed, key)
+		c.filter.Record(hash)
+	}
+	if c.capacity <= 0 || c.len() < c.capacity {
+		return true
+	}
+	if _, ok := c.peek(key); ok {
+		return true
+	}
+	if c.admission != nil && !c.admission(key, value) {
+		return false
+	}
+	if c.filter == nil {
+		return true
+	}
+	victims, ok := c.cache.(victimer[K])
+	if !ok {
+		return true
+	}
+	victim, ok := victims.Victim()
+	return !ok || c.filter.Admit(hash, policies.HashKey(c.seed, victim))
+}
+
+// oversized reports whether entry exceeds max entry size.
+func (c *Cache[K, V]) oversized(key K, value V) bool {
+	if c.maxEntrySize <= 0 {
+		return false
+	}
+	if c.weigher != nil {
+		return c.weigher(key, value) > c.maxEntrySize
+	}
+	return c.sizer(key, value) > c.maxEntrySize
+}
+
+// replace releases TTL slot of existing entry by given key before it is
+// overwritten.
+func (c *Cache[K, V]) replace(key K) {
+	if item, ok := c.peek(key); ok {
+		c.ttl.remove(key)
+		c.notify(key, item.value, Replaced)
+	}
+}
+
+func (c *Cache[K, V]) expire(key K, expiry time.Duration) bool {
+	item, ok := c.peek(key)
+	if !ok {
+		return false
+	}
+
+	c.ttl.remove(key)
+	c.schedule(key, item, expiry)
+	c.logOp(opRecord[K, V]{Op: opSet, Key: key, Value: item.value, Deadline: item.deadline})
+	return true
+}
+
+func (c *Cache[K, V]) remove(key K, reason Reason) (*entry[V], bool) {
+	item, ok := c.peek(key)
+	if !ok {
+		// NOTE: entry evicted from memory may be kept by overflow store.
+		if reason == Removed {
+			c.dropOverflow(key)
+			c.invalidate(key)
+		}
+		return nil, false
+	}
+
+	c.unlink(key, item)
+	if reason == Removed {
+		c.logOp(opRecord[K, V]{Op: opRemove, Key: key})
+		c.invalidate(key)
+	}
+	if reason != Evicted {
+		c.dropOverflow(key)
+	}
+	c.notify(key, item.value, reason)
+	return item, true
+}
+
+// unlink detaches entry by given key from indexes and eviction policy.
+func (c *Cache[K, V]) unlink(key K, item *entry[V]) {
+	c.ttl.remove(key)
+	c.weight -= item.weight
+	c.index.delete(key)
+	if _, pinned := c.pinned[key]; pinned {
+		delete(c.pinned, key)
+	} else {
+		c.cache.Remove(key)
+	}
+}
+
+// discard removes entry by given key without notifications, e.g. by replay
+// of removal, which has been reported already.
+func (c *Cache[K, V]) discard(key K) {
+	if item, ok := c.peek(key); ok {
+		c.unlink(key, item)
+	}
+	c.dropOverflow(key)
+}
+
+// notify reports removal of entry to registered callbacks.
+func (c *Cache[K, V]) notify(key K, value V, reason Reason) {
+	switch reason {
+	case Evicted:
+		c.metrics.RecordEviction()
+	case Expired:
+		c.metrics.RecordExpiration()
+	}
+	switch {
+	case reason == Evicted && c.onEvict != nil:
+		c.dispatch(func() { c.onEvict(key, value) })
+	case reason == Expired && c.onExpire != nil:
+		c.dispatch(func() { c.onExpire(key, value) })
+	case reason == Removed && c.onRemove != nil:
+		c.dispatch(func() { c.onRemove(key, value) })
+	}
+	if c.onRemoval != nil {
+		c.dispatch(func() { c.onRemoval(key, value, reason) })
+	}
+	if reason == Expired && c.expired != nil {
+		c.emit(Entry[K, V]{Key: key, Value: value})
+	}
+}
+
+// emit delivers expired entry to channel returned by Expired. It is called
+// under cache lock, so entry is dropped if buffer of channel is full.
+func (c *Cache[K, V]) emit(e Entry[K, V]) {
+	c.emitLock.RLock()
+	defer c.emitLock.RUnlock()
+
+	if c.stopped {
+		return
+	}
+	select {
+	case c.expired <- e:
+	default:
+		c.expiredDropped.Add(1)
+	}
+}
+
+// shutdown runs callbacks queued to workers and closes channel of expired
+// entries, so entries buffered by it are still delivered. It is called once
+// context of cache is cancelled or cache is closed.
+func (c *Cache[K, V]) shutdown() {
+	c.emitLock.Lock()
+	if !c.stopped {
+		c.stopped = true
+		if c.expired != nil {
+			close(c.expired)
+		}
+	}
+	c.emitLock.Unlock()
+
+	if c.dispatcher != nil {
+		c.dispatcher.close()
+	}
+	if c.overflow != nil {
+		c.overflow.close()
+	}
+	if c.invalidator != nil {
+		c.invalidator.close()
+	}
+	if c.writeBehind != nil {
+		c.writeBehind.close()
+	}
+}
+
+// dispatch runs callback in place or passes it to worker pool in async mode.
+func (c *Cache[K, V]) dispatch(fn func()) {
+	if c.dispatcher == nil {
+		fn()
+		return
+	}
+	c.dispatcher.dispatch(fn)
+}
+
+// schedule places entry to TTL bucket by given expiration time, adjusted
+// by jitter and max TTL settings.
+func (c *Cache[K, V]) schedule(key K, item *entry[V], expiry time.Duration) {
+	expiration := expiry
+	if c.jitter > 0 {
+		expiration += time.Duration((rand.Float64()*2 - 1) * c.jitter * float64(expiration))
+	}
+
+	c.scheduleAt(key, item, c.clock.Now().Add(expiration))
+	item.expiry = expiry
+}
+
+// scheduleAt places entry to TTL bucket by given expiration deadline,
+// adjusted by max TTL setting.
+func (c *Cache[K, V]) scheduleAt(key K, item *entry[V], deadline time.Time) {
+	if c.maxTTL > 0 {
+		if limit := c.clock.Now().Add(c.maxTTL); deadline.After(limit) {
+			deadline = limit
+		}
+	}
+
+	if _, pinned := c.pinned[key]; pinned {
+		// NOTE: pinned entries are not tracked by TTL index, deadline
+		// is applied when entry is unpinned.
+		item.epoch, item.deadline = math.MaxUint64, deadline
+		return
+	}
+
+	item.epoch = c.ttl.emplace(key, deadline)
+	item.deadline = deadline
+}
+
+// evicted is called by replacement policy for each evicted entry.
+func (c *Cache[K, V]) evicted(key K, item *entry[V]) {
+	if c.evicting {
+		c.victims.add(key, item)
+		return
+	}
+	c.evictions++
+	c.weight -= item.weight
+	c.index.delete(key)
+	c.ttl.remove(key)
+	c.spill(key, item)
+	c.notify(key, item.value, Evicted)
+}
+
+func (c *Cache[K, V]) collectExpired() {
+	if c.lazyExpiry {
+		c.ticks.Add(1)
+		return
+	}
+	if c.paused.Load() {
+		return
+	}
+
+	// NOTE: ticker drops ticks while janitor is late, so janitor applies
+	// all epochs passed by clock.
+	for passed := max(c.ttl.passed(c.clock.Now()), 1); passed > 0; passed-- {
+		c.tick(false)
+	}
+}
+
+// tick collects expired entries of current TTL epoch and starts next one.
+// Expired keys are detached from TTL index under its own lock and removed
+// in batches, cache lock is taken for each batch unless it is already held.
+func (c *Cache[K, V]) tick(locked bool) {
+	start := c.clock.Now()
+	expired := c.ttl.expired(true, start)
+	c.epochEnd.Store(start.Add(c.ttl.period()).UnixNano())
+	removed := 0
+	for keys := expired.keys; len(keys) > 0; keys = keys[min(expireBatchSize, len(keys)):] {
+		if !locked {
+			c.acquire()
+		}
+		removed += c.removeBucket(expired.epoch, keys[:min(expireBatchSize, len(keys))])
+		if !locked {
+			c.release()
+		}
+	}
+
+	if !locked {
+		c.acquire()
+		defer c.release()
+	}
+	_, epochStart := c.ttl.current()
+	c.window.rotate(epochStart)
+	evictions := c.evictions
+	c.evictions = 0
+	if c.logger == nil {
+		return
+	}
+
+	c.logger.Debug("ttlcache: expired entries collected",
+		slog.Uint64("epoch", expired.epoch), slog.Int("expired", removed),
+		slog.Int("evicted", evictions), slog.Duration("elapsed", c.clock.Now().Sub(start)))
+	if threshold := c.bulkThreshold(removed); removed >= threshold {
+		c.logger.Info("ttlcache: bulk expiration", slog.Int("expired", removed), slog.Int("capacity", c.capacity))
+	}
+	if threshold := c.bulkThreshold(removed); evictions >= threshold {
+		c.logger.Warn("ttlcache: high policy eviction rate, capacity may be too small",
+			slog.Int("evicted", evictions), slog.Int("capacity", c.capacity), slog.Duration("period", c.ttl.period()))
+	}
+}
+
+// removeExpired removes entries of current TTL epoch.
+func (c *Cache[K, V]) removeExpired() int {
+	expired := c.ttl.expired(false, time.Time{})
+	return c.removeBucket(expired.epoch, expired.keys)
+}
+
+// removeBucket removes entries by given keys detached from TTL index,
+// which are still scheduled to given epoch.
+func (c *Cache[K, V]) removeBucket(epoch uint64, keys []K) int {
+	removed := 0
+	for _, key := range keys {
+		item, ok := c.cache.Peek(key)
+		// NOTE: entry could be rescheduled or replaced after its bucket
+		// was detached.
+		if !ok || item.epoch != epoch {
+			continue
+		}
+
+		c.cache.Remove(key)
+		c.weight -= item.weight
+		c.index.delete(key)
+		c.dropOverflow(key)
+		removed++
+		c.notify(key, item.value, Expired)
+	}
+	return removed
+}
+
+func (c *Cache[K, V]) evict(count int) {
+	removed := c.removeExpired()
+	if count <= removed {
+		return
+	}
+
+	count -= removed
+
+	// NOTE: victims are collected during single pass of policy and
+	// unscheduled from TTL index at once.
+	c.evicting = true
+	c.cache.Evict(count)
+	c.evicting = false
+
+	c.ttl.removeAll(c.victims.keys)
+	for i, key := range c.victims.keys {
+		item := c.victims.items[i]
+		c.evictions++
+		c.weight -= item.weight
+		c.index.delete(key)
+		c.spill(key, item)
+		c.notify(key, item.value, Evicted)
+	}
+	c.victims.reset(c.evictionBatch)
+}
+
+// policyCapacity returns capacity of policy, which leaves room for batch of
+// entries over capacity of cache.
+func (c *Cache[K, V]) policyCapacity() int {
+	if c.capacity <= 0 {
+		return c.capacity
+	}
+	return c.capacity + c.evictionBatch - 1
+}
+
+// shrink evicts entries when number of entries or total weight reaches
+// high watermark, down to low watermark. Evicted reports whether policy
+// has already evicted entry over capacity by itself, so overshoot is applied.
+func (c *Cache[K, V]) shrink(evicted bool) {
+	if c.capacity > 0 {
+		high, low := c.watermarks(int64(c.capacity), int64(c.evictionBatch))
+		if n := c.len() - int(low); n > 0 && (int64(c.len()) >= high || evicted) {
+			c.evict(n)
+		}
+	}
+	if c.maxWeight <= 0 {
+		return
+	}
+	high, low := c.watermarks(c.maxWeight, 1)
+	if c.weight < high {
+		return
+	}
+	for c.weight > low {
+		size := c.cache.Len()
+		c.evict(1)
+		// NOTE: policy may be unable to evict, e.g. NOOP.
+		if c.cache.Len() == size {
+			return
+		}
+	}
+}
+
+// watermarks returns occupancy of given limit, which triggers eviction,
+// and occupancy left after eviction. Batch is excess over limit, which
+// is evicted at once.
+func (c *Cache[K, V]) watermarks(limit, batch int64) (high, low int64) {
+	if c.highWatermark == 0 {
+		return limit + batch, limit - int64(float64(limit)*c.overshoot)
+	}
+	return max(int64(float64(limit)*c.highWatermark), 1), int64(float64(limit) * c.lowWatermark)
+}
+
+// bulkThreshold returns number of entries expired or evicted during single
+// epoch, which is logged as bulk operation. Unbounded cache uses its size
+// at start of epoch instead of capacity.
+func (c *Cache[K, V]) bulkThreshold(removed int) int {
+	size := c.capacity
+	if size <= 0 {
+		size = c.len() + removed
+	}
+	return max(size/bulkThresholdDivisor, 1)
+}
+
+// callback returns typed callback from untyped config value.
+func callback[K comparable, V any](fn any) func(key K, value V) {
+	if fn == nil {
+		return nil
+	}
+	typed, ok := fn.(func(key K, value V))
+	if !ok {
+		panic("Callback type does not match cache key and value types")
+	}
+	return typed
+}
+
+// chainCallback returns callback calling prev and fn in order. Callback of
+// other types is kept, so NewCache reports mismatch of types.
+func chainCallback[K comparable, V any](prev any, fn func(key K, value V)) any {
+	switch prev := prev.(type) {
+	case nil:
+		return fn
+	case func(key K, value V):
+		if fn == nil {
+			return prev
+		}
+		if prev == nil {
+			return fn
+		}
+		return func(key K, value V) {
+			prev(key, value)
+			fn(key, value)
+		}
+	}
+	return prev
+}
+
+// removalCallback returns typed removal callback from untyped config value.
+func removalCallback[K comparable, V any](fn any) func(key K, value V, reason Reason) {
+	if fn == nil {
+		return nil
+	}
+	typed, ok := fn.(func(key K, value V, reason Reason))
+	if !ok {
+		panic("Callback type does not match cache key and value types")
+	}
+	return typed
+}
+
+// chainRemovalCallback returns removal callback calling prev and fn in
+// order, see chainCallback.
+func chainRemovalCallback[K comparable, V any](prev any, fn func(key K, value V, reason Reason)) any {
+	switch prev := prev.(type) {
+	case nil:
+		return fn
+	case func(key K, value V, reason Reason):
+		if fn == nil {
+			return prev
+		}
+		if prev == nil {
+			return fn
+		}
+		return func(key K, value V, reason Reason) {
+			prev(key, value, reason)
+			fn(key, value, reason)
+		}
+	}
+	return prev
+}
+
+// admissionFunc returns typed admission function from untyped config value.
+func admissionFunc[K comparable, V any](fn any) func(key K, value V) bool {
+	if fn == nil {
+		return nil
+	}
+	typed, ok := fn.(func(key K, value V) bool)
+	if !ok {
+		panic("Admission function type does not match cache key and value types")
+	}
+	return typed
+}
+
+// loaderFunc returns typed loader from untyped config value.
+func loaderFunc[K comparable, V any](fn any) func(ctx context.Context, key K) (V, time.Duration, error) {
+	if fn == nil {
+		return nil
+	}
+	typed, ok := fn.(func(ctx context.Context, key K) (V, time.Duration, error))
+	if !ok {
+		panic("Loader type does not match cache key and value types")
+	}
+	return typed
+}
+
+// bulkLoaderFunc returns typed bulk loader from untyped config value.
+func bulkLoaderFunc[K comparable, V any](fn any) func(ctx context.Context, keys []K) (map[K]V, error) {
+	if fn == nil {
+		return nil
+	}
+	typed, ok := fn.(func(ctx context.Context, keys []K) (map[K]V, error))
+	if !ok {
+		panic("Bulk loader type does not match cache key and value types")
+	}
+	return typed
+}
+
+// backingStore returns typed backing store from untyped config value.
+func backingStore[K comparable, V any](store any) BackingStore[K, V] {
+	if store == nil {
+		return nil
+	}
+	typed, ok := store.(BackingStore[K, V])
+	if !ok {
+		panic("BackingStore type does not match cache key and value types")
+	}
+	return typed
+}
+
+// clonerFunc returns typed value cloner from untyped config value.
+func clonerFunc[V any](fn any) func(value V) V {
+	if fn == nil {
+		return nil
+	}
+	typed, ok := fn.(func(value V) V)
+	if !ok {
+		panic("Value cloner type does not match cache value type")
+	}
+	return typed
+}
+
+// initialEntries returns typed initial entries from untyped config value.
+func initialEntries[K comparable, V any](entries any) map[K]SeedEntry[V] {
+	if entries == nil {
+		return nil
+	}
+	typed, ok := entries.(map[K]SeedEntry[V])
+	if !ok {
+		panic("Initial entries type does not match cache key and value types")
+	}
+	return typed
+}
+
+// sizerFunc returns typed sizer from untyped config value, default sizer
+// estimates size by reflection.
+func sizerFunc[K comparable, V any](fn any) func(key K, value V) int64 {
+	if fn == nil {
+		return estimateEntrySize[K, V]
+	}
+	typed, ok := fn.(func(key K, value V) int64)
+	if !ok {
+		panic("Sizer type does not match cache key and value types")
+	}
+	return typed
+}
+
+// weigherFunc returns typed weigher from untyped config value, if only max
+// weight is set each entry weighs 1.
+func weigherFunc[K comparable, V any](fn any, maxWeight int64) func(key K, value V) int64 {
+	if fn == nil {
+		if maxWeight <= 0 {
+			return nil
+		}
+		return func(K, V) int64 { return 1 }
+	}
+	typed, ok := fn.(func(key K, value V) int64)
+	if !ok {
+		panic("Weigher type does not match cache key and value types")
+	}
+	return typed
+}
+
+// Entry is key-value pair of cache.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// SeedEntry is entry set by WithInitialEntries, non-positive TTL means
+// that entry is set as by Set.
+type SeedEntry[V any] struct {
+	Value V
+	TTL   time.Duration
+}
+
+// Item is snapshot of cache entry.
+type Item[V any] struct {
+	Value V
+	// ExpiresAt is approximate expiration time of entry, zero value
+	// means that entry can be evicted only by policy.
+	ExpiresAt time.Time
+	// clock is clock of cache, which item is taken from.
+	clock Clock
+}
+
+// TTL returns remaining time to live of entry by clock of cache, zero value
+// means that entry can be evicted only by policy.
+func (i Item[V]) TTL() time.Duration {
+	if i.ExpiresAt.IsZero() {
+		return 0
+	}
+	clock := i.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return max(i.ExpiresAt.Sub(clock.Now()), 0)
+}
+
+// EntryInfo is access metadata of cache entry.
+type EntryInfo struct {
+	// CreatedAt is time of first insertion of key.
+	CreatedAt time.Time
+	// UpdatedAt is time of last update of value.
+	UpdatedAt time.Time
+	// AccessedAt is time of last read access, zero value means that
+	// entry was never read.
+	AccessedAt time.Time
+	// ExpiresAt is expiration time of entry, zero value means that
+	// entry can be evicted only by policy.
+	ExpiresAt time.Time
+	// Hits is number of read accesses to entry.
+	Hits uint64
+	// Pinned reports whether entry is exempt from eviction.
+	Pinned bool
+}
+
+// failure is cached failure of loader.
+type failure struct {
+	err      error
+	deadline time.Time
+}
+
+// call is in-flight or completed GetOrCompute computation or load.
+type call[V any] struct {
+	// done is closed when result is ready.
+	done chan struct{}
+
+	value  V
+	expiry time.Duration
+	err    error
+}
+
+type entry[V any] struct {
+	value V
+
+	epoch  uint64
+	expiry time.Duration
+	// deadline is expiration time of entry, zero value means that entry
+	// can be evicted only by policy.
+	deadline time.Time
 
-	epoch uint64
-	slot  int
+	createdAt  time.Time
+	updatedAt  time.Time
+	accessedAt time.Time
+	hits       uint64
+	// weight is computed by weigher when entry is inserted.
+	weight int64
 }
@@ -1,8 +1,21 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -113,3 +126,3105 @@ func fail(t *testing.T, msg string, args ...any) {
 	t.Logf(msg, args...)
 	t.FailNow()
 }
+
+func Test_GetOrSet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+
+	value, loaded := cache.GetOrSet(`key`, `first`, time.Minute)
+	if loaded {
+		fail(t, `expected key not present before first call`)
+	}
+	if value != `first` {
+		fail(t, `unexpected value %v`, value)
+	}
+
+	value, loaded = cache.GetOrSet(`key`, `second`, time.Minute)
+	if !loaded {
+		fail(t, `expected key present after first call`)
+	}
+	if value != `first` {
+		fail(t, `unexpected value %v`, value)
+	}
+}
+
+func Test_GetOrCompute(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+
+	var calls int32
+	compute := func() (string, time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		<-time.After(10 * time.Millisecond)
+		return `computed`, time.Minute, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.GetOrCompute(`key`, compute)
+			if err != nil || value != `computed` {
+				t.Errorf(`unexpected result %v, %v`, value, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		fail(t, `expected single computation, got %d`, calls)
+	}
+
+	_, err := cache.GetOrCompute(`failed`, func() (string, time.Duration, error) {
+		return ``, 0, fmt.Errorf(`compute error`)
+	})
+	if err == nil {
+		fail(t, `expected compute error`)
+	}
+	if _, ok := cache.Get(`failed`); ok {
+		fail(t, `expected failed computation not cached`)
+	}
+}
+
+func Test_Peek(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 2, WithEvictionPolicy(LRU))
+	cache.Set(`k1`, `v1`)
+	cache.Set(`k2`, `v2`)
+
+	value, ok := cache.Peek(`k1`)
+	if !ok || value != `v1` {
+		fail(t, `unexpected peek result %v, %v`, value, ok)
+	}
+
+	if !cache.Contains(`k1`) {
+		fail(t, `expected key present`)
+	}
+
+	cache.Set(`k3`, `v3`)
+	if cache.Contains(`k1`) {
+		fail(t, `expected peeked key evicted as least recently used`)
+	}
+}
+
+func Test_Keys(t *testing.T) {
+	for name, policy := range map[string]evictionPolicy{`LRU`: LRU, `LFU`: LFU, `ARC`: ARC, `TinyLFU`: TinyLFU, `Hyperbolic`: Hyperbolic, `NOOP`: NOOP} {
+		policy := policy
+		t.Run(fmt.Sprintf(`cache(%s) keys`, name), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cache := NewCache[string, string](ctx, 10, WithEvictionPolicy(policy))
+			cache.Set(`k1`, `v1`)
+			cache.SetNX(`k2`, `v2`, time.Minute)
+
+			keys := cache.Keys()
+			if len(keys) != 2 {
+				fail(t, `unexpected keys %v`, keys)
+			}
+			for _, key := range keys {
+				if key != `k1` && key != `k2` {
+					fail(t, `unexpected key %v`, key)
+				}
+			}
+		})
+	}
+}
+
+func Test_Items(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Second)
+
+	items := cache.Items()
+	if len(items) != 2 {
+		fail(t, `unexpected items %v`, items)
+	}
+	if item := items[`k1`]; item.Value != `v1` || !item.ExpiresAt.IsZero() {
+		fail(t, `unexpected item %v`, item)
+	}
+	item := items[`k2`]
+	if item.Value != `v2` {
+		fail(t, `unexpected item %v`, item)
+	}
+	if ttl := item.TTL(); ttl <= 900*time.Millisecond || ttl > 1100*time.Millisecond {
+		fail(t, `unexpected ttl %v`, ttl)
+	}
+}
+
+func Test_Clear(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Minute)
+
+	cache.Clear()
+	if cache.Len() != 0 {
+		fail(t, `expected empty cache, got %d entries`, cache.Len())
+	}
+
+	cache.Set(`k1`, `v1`)
+	if value, ok := cache.Get(`k1`); !ok || value != `v1` {
+		fail(t, `expected cache usable after clear`)
+	}
+}
+
+func Test_Pop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Minute)
+
+	for key, expected := range map[string]string{`k1`: `v1`, `k2`: `v2`} {
+		value, ok := cache.Pop(key)
+		if !ok || value != expected {
+			fail(t, `unexpected pop result %v, %v`, value, ok)
+		}
+		if cache.Contains(key) {
+			fail(t, `expected key %v removed`, key)
+		}
+	}
+
+	if _, ok := cache.Pop(`k1`); ok {
+		fail(t, `expected missing key`)
+	}
+}
+
+func Test_Many(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+	cache.SetMany(map[string]string{`k1`: `v1`, `k2`: `v2`}, time.Minute)
+
+	values := cache.GetMany([]string{`k1`, `k2`, `k3`})
+	if len(values) != 2 || values[`k1`] != `v1` || values[`k2`] != `v2` {
+		fail(t, `unexpected values %v`, values)
+	}
+}
+
+func Test_GetTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Second)
+
+	if ttl, ok := cache.GetTTL(`k1`); !ok || ttl != 0 {
+		fail(t, `unexpected ttl %v, %v`, ttl, ok)
+	}
+	if ttl, ok := cache.GetTTL(`k2`); !ok || ttl <= 900*time.Millisecond || ttl > 1100*time.Millisecond {
+		fail(t, `unexpected ttl %v, %v`, ttl, ok)
+	}
+	if _, ok := cache.GetTTL(`k3`); ok {
+		fail(t, `expected missing key`)
+	}
+}
+
+func Test_Touch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.SetNX(`key`, `value`, 20*time.Millisecond)
+
+	if !cache.Touch(`key`, time.Minute) {
+		fail(t, `expected key touched`)
+	}
+	<-time.After(40 * time.Millisecond)
+	if value, ok := cache.Get(`key`); !ok || value != `value` {
+		fail(t, `expected key not expired after touch`)
+	}
+
+	if cache.Touch(`missing`, time.Minute) {
+		fail(t, `expected missing key not touched`)
+	}
+}
+
+func Test_Expire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Minute)
+
+	if !cache.Expire(`k1`, 10*time.Millisecond) {
+		fail(t, `expected key expiration changed`)
+	}
+	if !cache.Expire(`k2`, 0) {
+		fail(t, `expected key expired immediately`)
+	}
+	if cache.Contains(`k2`) {
+		fail(t, `expected key removed`)
+	}
+	<-time.After(30 * time.Millisecond)
+	if cache.Contains(`k1`) {
+		fail(t, `expected key expired`)
+	}
+}
+
+func Test_Persist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.SetNX(`k1`, `v1`, 10*time.Millisecond)
+	cache.SetNX(`k2`, `v2`, 10*time.Millisecond)
+	cache.Set(`k2`, `v2`)
+
+	if !cache.Persist(`k1`) {
+		fail(t, `expected key persisted`)
+	}
+	if cache.Persist(`k3`) {
+		fail(t, `expected missing key not persisted`)
+	}
+	<-time.After(30 * time.Millisecond)
+	for _, key := range []string{`k1`, `k2`} {
+		if !cache.Contains(key) {
+			fail(t, `expected key %v not expired`, key)
+		}
+	}
+}
+
+func Test_DefaultTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond), WithDefaultTTL(10*time.Millisecond))
+	cache.Set(`key`, `value`)
+	if !cache.Contains(`key`) {
+		fail(t, `expected key not expired`)
+	}
+	<-time.After(30 * time.Millisecond)
+	if cache.Contains(`key`) {
+		fail(t, `expected key expired by default ttl`)
+	}
+}
+
+func Test_SlidingTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond), WithSlidingTTL())
+	cache.SetNX(`key`, `value`, 30*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		<-time.After(15 * time.Millisecond)
+		if _, ok := cache.Get(`key`); !ok {
+			fail(t, `expected key prolonged by access`)
+		}
+	}
+	<-time.After(60 * time.Millisecond)
+	if cache.Contains(`key`) {
+		fail(t, `expected key expired without access`)
+	}
+}
+
+func Test_TTLJitter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 100, WithTTLEpochGranularity(time.Millisecond), WithTTLJitter(0.5))
+	for i := 0; i < 100; i++ {
+		cache.SetNX(i, i, 100*time.Millisecond)
+	}
+
+	deadlines := make(map[time.Time]struct{})
+	for _, item := range cache.Items() {
+		if ttl := item.TTL(); ttl < 45*time.Millisecond || ttl > 155*time.Millisecond {
+			fail(t, `unexpected ttl %v`, ttl)
+		}
+		deadlines[item.ExpiresAt] = struct{}{}
+	}
+	if len(deadlines) < 2 {
+		fail(t, `expected expiration spread over several epochs`)
+	}
+}
+
+func Test_MaxTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond), WithMaxTTL(10*time.Millisecond))
+	cache.SetNX(`key`, `value`, 24*time.Hour)
+	if ttl, _ := cache.GetTTL(`key`); ttl > 20*time.Millisecond {
+		fail(t, `expected ttl clamped, got %v`, ttl)
+	}
+	<-time.After(30 * time.Millisecond)
+	if cache.Contains(`key`) {
+		fail(t, `expected key expired by max ttl`)
+	}
+}
+
+func Test_GetWithExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+	cache.Set(`k1`, `v1`)
+	before := time.Now()
+	cache.SetNX(`k2`, `v2`, time.Minute)
+
+	if value, deadline, ok := cache.GetWithExpiry(`k1`); !ok || value != `v1` || !deadline.IsZero() {
+		fail(t, `unexpected result %v, %v, %v`, value, deadline, ok)
+	}
+	value, deadline, ok := cache.GetWithExpiry(`k2`)
+	if !ok || value != `v2` {
+		fail(t, `unexpected result %v, %v`, value, ok)
+	}
+	if deadline.Before(before.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		fail(t, `unexpected deadline %v`, deadline)
+	}
+}
+
+func Test_SetWithDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	deadline := time.Now().Add(25 * time.Millisecond)
+	cache.SetWithDeadline(`key`, `value`, deadline)
+
+	if _, expiresAt, ok := cache.GetWithExpiry(`key`); !ok || !expiresAt.Equal(deadline) {
+		fail(t, `unexpected deadline %v`, expiresAt)
+	}
+	<-time.After(time.Until(deadline) - 5*time.Millisecond)
+	if _, ok := cache.Get(`key`); !ok {
+		fail(t, `expected key not expired before deadline`)
+	}
+	<-time.After(time.Until(deadline) + 20*time.Millisecond)
+	if cache.Contains(`key`) {
+		fail(t, `expected key expired after deadline`)
+	}
+}
+
+func Test_OnEvict(t *testing.T) {
+	for name, policy := range map[string]evictionPolicy{`LRU`: LRU, `LFU`: LFU, `ARC`: ARC, `TinyLFU`: TinyLFU, `Hyperbolic`: Hyperbolic} {
+		policy := policy
+		t.Run(fmt.Sprintf(`cache(%s) on evict`, name), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			evicted := make(map[string]string)
+			cache := NewCache[string, string](ctx, 2, WithEvictionPolicy(policy), WithOnEvict(func(key, value string) {
+				evicted[key] = value
+			}))
+			cache.Set(`k1`, `v1`)
+			cache.SetNX(`k2`, `v2`, time.Minute)
+			cache.Set(`k3`, `v3`)
+			cache.Remove(`k3`)
+
+			if len(evicted) != 1 {
+				fail(t, `expected single eviction, got %v`, evicted)
+			}
+			for key, value := range evicted {
+				if cache.Contains(key) || value != `v`+key[1:] {
+					fail(t, `unexpected eviction %v: %v`, key, value)
+				}
+			}
+		})
+	}
+}
+
+func Test_OnExpire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		expired []string
+		evicted []string
+	)
+	cache := NewCache[string, string](ctx, 2,
+		WithTTLEpochGranularity(10*time.Millisecond),
+		WithOnExpire(func(key, _ string) {
+			mu.Lock()
+			defer mu.Unlock()
+			expired = append(expired, key)
+		}),
+		WithOnEvict(func(key, _ string) {
+			mu.Lock()
+			defer mu.Unlock()
+			evicted = append(evicted, key)
+		}),
+	)
+	cache.SetNX(`k1`, `v1`, 10*time.Millisecond)
+	cache.Set(`k2`, `v2`)
+	<-time.After(30 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(expired) != 1 || expired[0] != `k1` {
+		fail(t, `unexpected expired keys %v`, expired)
+	}
+	if len(evicted) != 0 {
+		fail(t, `unexpected evicted keys %v`, evicted)
+	}
+}
+
+func Test_OnRemoval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		reasons = make(map[string][]Reason)
+	)
+	cache := NewCache[string, string](ctx, 2,
+		WithTTLEpochGranularity(10*time.Millisecond),
+		WithOnRemoval(func(key, _ string, reason Reason) {
+			mu.Lock()
+			defer mu.Unlock()
+			reasons[key] = append(reasons[key], reason)
+		}),
+	)
+	cache.SetNX(`expired`, `v`, 10*time.Millisecond)
+	<-time.After(30 * time.Millisecond)
+	cache.Set(`replaced`, `v`)
+	cache.Set(`replaced`, `v`)
+	cache.Set(`removed`, `v`)
+	cache.Remove(`removed`)
+	cache.Set(`evicted`, `v`)
+	cache.Get(`replaced`)
+	cache.Set(`cleared`, `v`)
+	cache.Clear()
+
+	expected := map[string][]Reason{
+		`expired`:  {Expired},
+		`replaced`: {Replaced, Cleared},
+		`removed`:  {Removed},
+		`evicted`:  {Evicted},
+		`cleared`:  {Cleared},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for key, expectedReasons := range expected {
+		if fmt.Sprint(reasons[key]) != fmt.Sprint(expectedReasons) {
+			fail(t, `unexpected reasons of %v removal: %v`, key, reasons[key])
+		}
+	}
+}
+
+func Test_OnSetOnRemove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		set     []string
+		removed []string
+	)
+	cache := NewCache[string, string](ctx, 10,
+		WithOnSet(func(key, value string) { set = append(set, key+`=`+value) }),
+		WithOnRemove(func(key, value string) { removed = append(removed, key+`=`+value) }),
+	)
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Minute)
+	cache.Set(`k1`, `v3`)
+	cache.Remove(`k1`)
+	cache.Pop(`k2`)
+
+	if fmt.Sprint(set) != `[k1=v1 k2=v2 k1=v3]` {
+		fail(t, `unexpected set hooks %v`, set)
+	}
+	if fmt.Sprint(removed) != `[k1=v3 k2=v2]` {
+		fail(t, `unexpected remove hooks %v`, removed)
+	}
+}
+
+func Test_AsyncCallbacks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	evicted := make(chan string, 10)
+	cache := NewCache[string, string](ctx, 1,
+		WithAsyncCallbacks(1, 10),
+		WithOnEvict(func(key, _ string) {
+			<-release
+			evicted <- key
+		}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.Set(`k1`, `v1`)
+		cache.Set(`k2`, `v2`)
+		cache.Set(`k3`, `v3`)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		fail(t, `expected cache operations not blocked by callbacks`)
+	}
+
+	close(release)
+	for _, expected := range []string{`k1`, `k2`} {
+		select {
+		case key := <-evicted:
+			if key != expected {
+				fail(t, `unexpected evicted key %v`, key)
+			}
+		case <-time.After(time.Second):
+			fail(t, `expected callback called`)
+		}
+	}
+
+	// NOTE: callbacks over full queue are dropped, so callbacks calling
+	// cache do not deadlock it.
+	block := make(chan struct{})
+	var full *Cache[int, int]
+	full = NewCache[int, int](ctx, 1, WithAsyncCallbacks(1, 1),
+		WithOnEvict(func(key, _ int) {
+			<-block
+			full.Contains(key)
+		}),
+	)
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			full.Set(i, i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		fail(t, `expected cache operations not blocked by full queue`)
+	}
+	close(block)
+	if full.CallbacksDropped() == 0 {
+		fail(t, `expected callbacks over full queue dropped`)
+	}
+}
+
+func Test_Expired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond), WithExpiredBuffer(10))
+	cache.SetNX(`key`, `value`, 10*time.Millisecond)
+
+	select {
+	case entry := <-cache.Expired():
+		if entry.Key != `key` || entry.Value != `value` {
+			fail(t, `unexpected expired entry %v`, entry)
+		}
+	case <-time.After(time.Second):
+		fail(t, `expected expired entry delivered`)
+	}
+}
+
+func Test_AdmissionFunc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 2, WithAdmissionFunc(func(_ string, value int) bool {
+		return value > 10
+	}))
+	cache.Set(`k1`, 1)
+	cache.Set(`k2`, 2)
+	cache.Set(`k3`, 3)
+	if cache.Contains(`k3`) || !cache.Contains(`k1`) {
+		fail(t, `expected key rejected by admission`)
+	}
+	cache.Set(`k1`, 4)
+	if value, _ := cache.Get(`k1`); value != 4 {
+		fail(t, `expected existing key updated`)
+	}
+	cache.Set(`k4`, 40)
+	if !cache.Contains(`k4`) {
+		fail(t, `expected key admitted`)
+	}
+}
+
+func Test_Pin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 3, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.SetNX(`pinned`, `v`, 10*time.Millisecond)
+	cache.Set(`config`, `v`)
+	if !cache.Pin(`pinned`) || !cache.Pin(`config`) {
+		fail(t, `expected keys pinned`)
+	}
+	if cache.Pin(`missing`) {
+		fail(t, `expected missing key not pinned`)
+	}
+
+	for _, key := range []string{`k1`, `k2`, `k3`} {
+		cache.Set(key, `v`)
+	}
+	<-time.After(30 * time.Millisecond)
+	for _, key := range []string{`pinned`, `config`} {
+		if value, ok := cache.Get(key); !ok || value != `v` {
+			fail(t, `expected pinned key %v present`, key)
+		}
+	}
+	if cache.Len() != 3 {
+		fail(t, `unexpected cache size %d`, cache.Len())
+	}
+
+	if !cache.Unpin(`pinned`) {
+		fail(t, `expected key unpinned`)
+	}
+	<-time.After(30 * time.Millisecond)
+	if cache.Contains(`pinned`) {
+		fail(t, `expected unpinned key expired`)
+	}
+}
+
+type countingListener struct {
+	hits, misses, evictions, expirations, sets int
+}
+
+func (l *countingListener) RecordHit()        { l.hits++ }
+func (l *countingListener) RecordMiss()       { l.misses++ }
+func (l *countingListener) RecordEviction()   { l.evictions++ }
+func (l *countingListener) RecordExpiration() { l.expirations++ }
+func (l *countingListener) RecordSet()        { l.sets++ }
+
+func Test_MetricsListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := &countingListener{}
+	cache := NewCache[string, string](ctx, 1, WithMetricsListener(listener))
+	cache.Set(`k1`, `v1`)
+	cache.Get(`k1`)
+	cache.Set(`k2`, `v2`)
+	cache.Get(`k1`)
+	cache.Expire(`k2`, 0)
+
+	expected := countingListener{hits: 1, misses: 1, evictions: 1, expirations: 1, sets: 2}
+	if *listener != expected {
+		fail(t, `unexpected metrics %+v`, *listener)
+	}
+}
+
+func Test_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 1)
+	cache.Set(`k1`, `v1`)
+	cache.Get(`k1`)
+	cache.Set(`k2`, `v2`)
+	cache.Get(`k1`)
+	cache.Expire(`k2`, 0)
+
+	expected := Stats{Hits: 1, Misses: 1, Sets: 2, Evictions: 1, Expirations: 1, Len: 0}
+	if stats := cache.Stats(); stats != expected {
+		fail(t, `unexpected stats %+v`, stats)
+	}
+	if ratio := cache.Stats().HitRatio(); ratio != 0.5 {
+		fail(t, `unexpected hit ratio %v`, ratio)
+	}
+}
+
+func Test_RecentStats(t *testing.T) {
+	start := time.Now()
+	w := window{slotStart: start}
+
+	w.RecordHit()
+	w.rotate(start.Add(time.Minute))
+	w.RecordMiss()
+	w.RecordHit()
+
+	if stats := w.stats(10 * time.Second); stats.Hits != 1 || stats.Misses != 1 {
+		fail(t, `unexpected last slot stats %+v`, stats)
+	}
+	if stats := w.stats(5 * time.Minute); stats.Hits != 2 || stats.Misses != 1 {
+		fail(t, `unexpected 5m stats %+v`, stats)
+	}
+
+	w.rotate(start.Add(time.Hour))
+	if stats := w.stats(15 * time.Minute); stats.Hits != 0 || stats.Misses != 0 {
+		fail(t, `expected outdated stats dropped, got %+v`, stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+	cache.Set(`key`, `value`)
+	cache.Get(`key`)
+	if stats := cache.RecentStats(time.Minute); stats.Hits != 1 || stats.Sets != 1 || stats.Len != 1 {
+		fail(t, `unexpected recent stats %+v`, stats)
+	}
+}
+
+func Test_TTLHistogram(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.Set(`persistent`, `v`)
+	cache.SetNX(`short`, `v`, 50*time.Millisecond)
+	cache.SetNX(`middle`, `v`, 500*time.Millisecond)
+	cache.SetNX(`long`, `v`, time.Hour)
+
+	histogram := cache.TTLHistogram([]time.Duration{time.Second, 100 * time.Millisecond})
+	if fmt.Sprint(histogram.Counts) != `[1 1 1]` || histogram.Persistent != 1 {
+		fail(t, `unexpected histogram %+v`, histogram)
+	}
+}
+
+func Test_EntryInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 10)
+	cache.Set(`key`, `v1`)
+	created, _ := cache.EntryInfo(`key`)
+	<-time.After(time.Millisecond)
+	cache.Get(`key`)
+	cache.SetNX(`key`, `v2`, time.Minute)
+	cache.Get(`key`)
+
+	info, ok := cache.EntryInfo(`key`)
+	if !ok {
+		fail(t, `expected entry info`)
+	}
+	if info.Hits != 2 || !info.CreatedAt.Equal(created.CreatedAt) || !info.UpdatedAt.After(info.CreatedAt) {
+		fail(t, `unexpected entry info %+v`, info)
+	}
+	if info.AccessedAt.Before(info.UpdatedAt) || info.ExpiresAt.IsZero() {
+		fail(t, `unexpected entry info %+v`, info)
+	}
+	if _, ok := cache.EntryInfo(`missing`); ok {
+		fail(t, `expected missing entry`)
+	}
+}
+
+func Test_Logger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu  sync.Mutex
+		buf bytes.Buffer
+	)
+	logger := slog.New(slog.NewTextHandler(&lockedWriter{mu: &mu, w: &buf}, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	cache := NewCache[string, string](ctx, 10, WithLogger(logger), WithTTLEpochGranularity(-time.Second))
+	cache.SetNX(`key`, `value`, 0)
+	cache.collectExpired()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, msg := range []string{`non-positive TTL epoch granularity`, `expired entries collected`, `bulk expiration`} {
+		if !strings.Contains(buf.String(), msg) {
+			fail(t, `expected %q logged, got %s`, msg, buf.String())
+		}
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func Test_EstimatedBytes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, []byte](ctx, 10)
+	cache.Set(`key`, make([]byte, 1024))
+	if size := cache.EstimatedBytes(); size < 1024+3 || size > 2048 {
+		fail(t, `unexpected estimated size %d`, size)
+	}
+
+	sized := NewCache[string, []byte](ctx, 10, WithSizer(func(_ string, value []byte) int64 {
+		return int64(len(value))
+	}))
+	sized.Set(`k1`, make([]byte, 10))
+	sized.Set(`k2`, make([]byte, 20))
+	if size := sized.EstimatedBytes(); size != 30 {
+		fail(t, `unexpected estimated size %d`, size)
+	}
+}
+
+func Test_TinyLFUScanResistance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 100, WithEvictionPolicy(TinyLFU))
+	for round := 0; round < 5; round++ {
+		for key := 0; key < 50; key++ {
+			cache.Set(key, key)
+			cache.Get(key)
+		}
+	}
+	for key := 1000; key < 2000; key++ {
+		cache.Set(key, key)
+	}
+
+	hot := 0
+	for key := 0; key < 50; key++ {
+		if cache.Contains(key) {
+			hot++
+		}
+	}
+	if hot < 45 {
+		fail(t, `expected hot keys survive scan, got %d of 50`, hot)
+	}
+	if cache.Len() > 100 {
+		fail(t, `unexpected cache size %d`, cache.Len())
+	}
+}
+
+// fifoPolicy is minimal custom policy evicting oldest inserted keys.
+type fifoPolicy[K comparable, V any] struct {
+	items    map[K]V
+	order    []K
+	capacity int
+	onEvict  func(key K, value V)
+}
+
+func (p *fifoPolicy[K, V]) Set(key K, value V) {
+	if _, ok := p.items[key]; !ok {
+		p.order = append(p.order, key)
+	}
+	p.items[key] = value
+	if len(p.items) > p.capacity {
+		p.Evict(1)
+	}
+}
+
+func (p *fifoPolicy[K, V]) Get(key K) (V, bool)  { return p.Peek(key) }
+func (p *fifoPolicy[K, V]) Peek(key K) (V, bool) { v, ok := p.items[key]; return v, ok }
+func (p *fifoPolicy[K, V]) Keys() []K            { return append([]K(nil), p.order...) }
+func (p *fifoPolicy[K, V]) Len() int             { return len(p.items) }
+
+func (p *fifoPolicy[K, V]) Remove(key K) {
+	delete(p.items, key)
+	for i, k := range p.order {
+		if k == key {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *fifoPolicy[K, V]) Evict(count int) {
+	for ; count > 0 && len(p.order) > 0; count-- {
+		key := p.order[0]
+		value := p.items[key]
+		p.Remove(key)
+		p.onEvict(key, value)
+	}
+}
+
+func Test_CustomPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var evicted []string
+	cache := NewCache[string, string](ctx, 2,
+		WithCustomPolicy(func(capacity int, onEvict func(key string, value any)) Policy[string, any] {
+			return &fifoPolicy[string, any]{items: make(map[string]any), capacity: capacity, onEvict: onEvict}
+		}),
+		WithOnEvict(func(key, _ string) { evicted = append(evicted, key) }),
+	)
+	cache.Set(`k1`, `v1`)
+	cache.SetNX(`k2`, `v2`, time.Minute)
+	cache.Get(`k1`)
+	cache.Set(`k3`, `v3`)
+
+	if fmt.Sprint(evicted) != `[k1]` {
+		fail(t, `unexpected evicted keys %v`, evicted)
+	}
+	if value, ok := cache.Get(`k2`); !ok || value != `v2` {
+		fail(t, `unexpected value %v`, value)
+	}
+}
+
+func Test_HyperbolicPriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 10, WithEvictionPolicy(Hyperbolic))
+	for key := 0; key < 10; key++ {
+		cache.Set(key, key)
+	}
+	for i := 0; i < 10; i++ {
+		for key := 1; key < 10; key++ {
+			cache.Get(key)
+		}
+	}
+	cache.Set(10, 10)
+
+	if cache.Contains(0) {
+		fail(t, `expected never accessed key evicted`)
+	}
+}
+
+// hitRatio replays trace against cache with specified policy, missed keys are inserted.
+func hitRatio(policy evictionPolicy, capacity int, trace []int) float64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, capacity, WithEvictionPolicy(policy))
+	hits := 0
+	for _, key := range trace {
+		if _, ok := cache.Get(key); ok {
+			hits++
+			continue
+		}
+		cache.Set(key, key)
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func Test_ARCTrace(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	// hot working set interleaved with long one-time scans.
+	scan := make([]int, 0, 20000)
+	next := 1000
+	for round := 0; round < 100; round++ {
+		for i := 0; i < 100; i++ {
+			scan = append(scan, random.Intn(50))
+		}
+		for i := 0; i < 100; i++ {
+			scan = append(scan, next)
+			next++
+		}
+	}
+
+	lru, arc := hitRatio(LRU, 100, scan), hitRatio(ARC, 100, scan)
+	if arc <= lru {
+		fail(t, `expected ARC beat LRU on scan trace, got %.3f vs %.3f`, arc, lru)
+	}
+	if arc < 0.45 {
+		fail(t, `unexpected ARC hit ratio on scan trace %.3f`, arc)
+	}
+
+	// skewed trace favourable to recency.
+	zipf := rand.NewZipf(random, 1.1, 1, 10000)
+	skewed := make([]int, 0, 50000)
+	for i := 0; i < 50000; i++ {
+		skewed = append(skewed, int(zipf.Uint64()))
+	}
+
+	lru, arc = hitRatio(LRU, 500, skewed), hitRatio(ARC, 500, skewed)
+	if arc < lru*0.95 {
+		fail(t, `expected ARC close to LRU on skewed trace, got %.3f vs %.3f`, arc, lru)
+	}
+	t.Logf(`skewed trace hit ratios: ARC %.3f, LRU %.3f`, arc, lru)
+}
+
+func Test_Weigher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, string](ctx, 100,
+		WithWeigher(func(key string, value string) int64 { return int64(len(value)) }),
+		WithMaxWeight(10),
+	)
+	cache.Set(`a`, `aaaa`)
+	cache.Set(`b`, `bbbb`)
+	if cache.Weight() != 8 {
+		fail(t, `unexpected weight %d`, cache.Weight())
+	}
+
+	cache.Set(`b`, `bb`)
+	if cache.Weight() != 6 {
+		fail(t, `expected replaced entry weight released, got %d`, cache.Weight())
+	}
+
+	cache.Set(`c`, `cccccc`)
+	if cache.Contains(`a`) {
+		fail(t, `expected least recently used entry evicted by weight`)
+	}
+	if !cache.Contains(`b`) || !cache.Contains(`c`) {
+		fail(t, `expected entries fitting max weight remain`)
+	}
+	if cache.Weight() != 8 {
+		fail(t, `unexpected weight after eviction %d`, cache.Weight())
+	}
+
+	cache.Remove(`b`)
+	if cache.Weight() != 6 {
+		fail(t, `expected removed entry weight released, got %d`, cache.Weight())
+	}
+
+	counted := NewCache[int, int](ctx, 100, WithMaxWeight(3))
+	for key := 0; key < 5; key++ {
+		counted.Set(key, key)
+	}
+	if counted.Len() != 3 || counted.Weight() != 3 {
+		fail(t, `expected each entry weigh 1, got len %d weight %d`, counted.Len(), counted.Weight())
+	}
+}
+
+func Test_MaxBytes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const budget = 16 << 10
+
+	cache := NewCache[int, []byte](ctx, 1000, WithMaxBytes(budget))
+	for key := 0; key < 100; key++ {
+		cache.Set(key, make([]byte, 1024))
+	}
+
+	if cache.Len() >= 16 || cache.Len() == 0 {
+		fail(t, `unexpected number of entries within byte budget %d`, cache.Len())
+	}
+	if size := cache.EstimatedBytes(); size > budget || size != cache.Weight() {
+		fail(t, `unexpected estimated size %d, tracked %d`, size, cache.Weight())
+	}
+	if !cache.Contains(99) {
+		fail(t, `expected most recent entry remains`)
+	}
+
+	sized := NewCache[int, string](ctx, 1000,
+		WithSizer(func(key int, value string) int64 { return int64(len(value)) }),
+		WithMaxBytes(10),
+	)
+	sized.Set(1, `aaaaa`)
+	sized.Set(2, `bbbbb`)
+	sized.Set(3, `c`)
+	if sized.Contains(1) || sized.Weight() != 6 {
+		fail(t, `expected sizer bound cache, got weight %d`, sized.Weight())
+	}
+}
+
+func Test_MaxEntrySize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var rejected []string
+	cache := NewCache[string, string](ctx, 10,
+		WithWeigher(func(key string, value string) int64 { return int64(len(value)) }),
+		WithMaxWeight(10),
+		WithMaxEntrySize(4),
+		WithOnReject(func(key string, value string) { rejected = append(rejected, key) }),
+	)
+	cache.Set(`a`, `aaaa`)
+	cache.Set(`b`, `bbbbbbbb`)
+	if cache.Contains(`b`) {
+		fail(t, `expected oversized entry refused`)
+	}
+	if !cache.Contains(`a`) || cache.Weight() != 4 {
+		fail(t, `expected other entries intact, got weight %d`, cache.Weight())
+	}
+
+	cache.SetNX(`a`, `aaaaa`, time.Minute)
+	if cache.Contains(`a`) {
+		fail(t, `expected stale value removed on oversized update`)
+	}
+	if len(rejected) != 2 || rejected[0] != `b` || rejected[1] != `a` {
+		fail(t, `unexpected rejected keys %v`, rejected)
+	}
+	if cache.Weight() != 0 {
+		fail(t, `unexpected weight %d`, cache.Weight())
+	}
+}
+
+func Test_Resize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for name, policy := range map[string]evictionPolicy{`LRU`: LRU, `LFU`: LFU, `ARC`: ARC, `TinyLFU`: TinyLFU, `Hyperbolic`: Hyperbolic} {
+		t.Run(fmt.Sprintf(`cache(%s) resize`, name), func(t *testing.T) {
+			evicted := 0
+			cache := NewCache[int, int](ctx, 10, WithEvictionPolicy(policy),
+				WithOnEvict(func(key int, value int) { evicted++ }))
+			for key := 0; key < 10; key++ {
+				cache.Set(key, key)
+			}
+
+			cache.Resize(4)
+			if cache.Len() != 4 || evicted != 6 {
+				fail(t, `expected shrink to 4 entries, got %d, evicted %d`, cache.Len(), evicted)
+			}
+
+			cache.Resize(20)
+			for key := 10; key < 26; key++ {
+				cache.Set(key, key)
+			}
+			if cache.Len() != 20 {
+				fail(t, `expected grow to 20 entries, got %d`, cache.Len())
+			}
+		})
+	}
+
+	t.Run(`cache(LRU) shrink evicts least recently used`, func(t *testing.T) {
+		cache := NewCache[int, int](ctx, 3)
+		cache.Set(1, 1)
+		cache.Set(2, 2)
+		cache.Set(3, 3)
+		cache.Get(1)
+
+		cache.Resize(1)
+		if !cache.Contains(1) || cache.Len() != 1 {
+			fail(t, `expected most recently used key remain`)
+		}
+	})
+}
+
+func Test_Unbounded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	evicted := 0
+	cache := NewCache[int, int](ctx, 0, WithEvictionPolicy(LRU),
+		WithTTLEpochGranularity(5*time.Millisecond),
+		WithOnEvict(func(key int, value int) { evicted++ }),
+		WithAdmissionFunc(func(key int, value int) bool { return false }),
+	)
+	for key := 0; key < 1000; key++ {
+		cache.Set(key, key)
+	}
+	cache.SetNX(1000, 1000, 5*time.Millisecond)
+	if cache.Len() != 1001 || evicted != 0 {
+		fail(t, `expected no policy evictions in unbounded cache, got len %d, evicted %d`, cache.Len(), evicted)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if cache.Contains(1000) || cache.Len() != 1000 {
+		fail(t, `expected entry removed by TTL`)
+	}
+
+	cache.Resize(10)
+	if cache.Len() != 1000 {
+		fail(t, `expected resize of unbounded cache ignored`)
+	}
+}
+
+func Test_Watermarks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	evicted := 0
+	cache := NewCache[int, int](ctx, 100, WithWatermarks(0.9, 0.5),
+		WithOnEvict(func(key int, value int) { evicted++ }))
+	for key := 0; key < 89; key++ {
+		cache.Set(key, key)
+	}
+	if cache.Len() != 89 || evicted != 0 {
+		fail(t, `expected no eviction below high watermark, got len %d`, cache.Len())
+	}
+
+	cache.Set(89, 89)
+	if cache.Len() != 50 || evicted != 40 {
+		fail(t, `expected eviction down to low watermark, got len %d, evicted %d`, cache.Len(), evicted)
+	}
+	if !cache.Contains(89) || cache.Contains(0) {
+		fail(t, `expected least recently used entries evicted`)
+	}
+
+	weighted := NewCache[int, int](ctx, 100, WithMaxWeight(10), WithWatermarks(1, 0.6))
+	for key := 0; key < 10; key++ {
+		weighted.Set(key, key)
+	}
+	if weighted.Weight() != 6 {
+		fail(t, `expected weight evicted down to low watermark, got %d`, weighted.Weight())
+	}
+}
+
+func Test_Admission(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hotAfterScan := func(opts ...Option) int {
+		cache := NewCache[int, int](ctx, 100, opts...)
+		for round := 0; round < 5; round++ {
+			for key := 0; key < 50; key++ {
+				cache.Set(key, key)
+				cache.Get(key)
+			}
+		}
+		for key := 1000; key < 2000; key++ {
+			if _, ok := cache.Get(key); !ok {
+				cache.Set(key, key)
+			}
+		}
+
+		hot := 0
+		for key := 0; key < 50; key++ {
+			if cache.Contains(key) {
+				hot++
+			}
+		}
+		if cache.Len() > 100 {
+			fail(t, `unexpected cache size %d`, cache.Len())
+		}
+		return hot
+	}
+
+	if hot := hotAfterScan(); hot != 0 {
+		fail(t, `expected scan flush hot keys out of plain LRU, got %d of 50`, hot)
+	}
+	for name, policy := range map[string]evictionPolicy{`LRU`: LRU, `ARC`: ARC, `Hyperbolic`: Hyperbolic} {
+		hot := hotAfterScan(WithEvictionPolicy(policy), WithAdmission(NewTinyLFUAdmission(100)))
+		if hot < 45 {
+			fail(t, `expected hot keys of %s survive scan with admission, got %d of 50`, name, hot)
+		}
+	}
+}
+
+func Test_Disabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sets := 0
+	for name, cache := range map[string]*Cache[string, int]{
+		`option`:      NewCache[string, int](ctx, 10, WithDisabled(true), WithOnSet(func(key string, value int) { sets++ })),
+		`constructor`: NewDisabledCache[string, int](),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cache.Set(`key`, 1)
+			cache.SetNX(`key`, 1, time.Minute)
+			if _, ok := cache.Get(`key`); ok {
+				fail(t, `expected disabled cache always miss`)
+			}
+			if value, loaded := cache.GetOrSet(`key`, 2, time.Minute); loaded || value != 2 {
+				fail(t, `expected value passed through, got %d`, value)
+			}
+
+			computed := 0
+			for i := 0; i < 2; i++ {
+				cache.GetOrCompute(`key`, func() (int, time.Duration, error) {
+					computed++
+					return 3, time.Minute, nil
+				})
+			}
+			if computed != 2 || cache.Len() != 0 || cache.Pin(`key`) {
+				fail(t, `expected disabled cache store nothing`)
+			}
+		})
+	}
+	if sets != 0 {
+		fail(t, `unexpected set callbacks %d`, sets)
+	}
+}
+
+func Test_Evict(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	evicted := []int{}
+	cache := NewCache[int, int](ctx, 10, WithOnEvict(func(key int, value int) { evicted = append(evicted, key) }))
+	for key := 0; key < 5; key++ {
+		cache.Set(key, key)
+	}
+	cache.Pin(0)
+
+	if n := cache.Evict(2); n != 2 || cache.Len() != 3 {
+		fail(t, `expected 2 entries evicted, got %d`, n)
+	}
+	if len(evicted) != 2 || evicted[0] != 1 || evicted[1] != 2 {
+		fail(t, `expected least recently used entries evicted, got %v`, evicted)
+	}
+	if n := cache.Evict(10); n != 2 || !cache.Contains(0) {
+		fail(t, `expected all but pinned entries evicted, got %d`, n)
+	}
+	if n := cache.Evict(-1); n != 0 {
+		fail(t, `unexpected evicted entries %d`, n)
+	}
+}
+
+func Test_EvictionOvershoot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	evicted := 0
+	cache := NewCache[int, int](ctx, 100, WithEvictionOvershoot(0.05),
+		WithOnEvict(func(key int, value int) { evicted++ }))
+	for key := 0; key < 100; key++ {
+		cache.Set(key, key)
+	}
+	if evicted != 0 {
+		fail(t, `unexpected eviction within capacity`)
+	}
+
+	cache.Set(100, 100)
+	if cache.Len() != 95 || evicted != 6 {
+		fail(t, `expected 5%% of capacity evicted at once, got len %d, evicted %d`, cache.Len(), evicted)
+	}
+	for key := 101; key < 106; key++ {
+		cache.Set(key, key)
+	}
+	if evicted != 6 {
+		fail(t, `expected no eviction until capacity is reached again, evicted %d`, evicted)
+	}
+}
+
+func Test_EvictionBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var evicted []int
+	cache := NewCache[int, int](ctx, 100, WithEvictionBatch(10),
+		WithOnEvict(func(key int, value int) { evicted = append(evicted, key) }))
+	for key := 0; key < 109; key++ {
+		cache.Set(key, key)
+	}
+	if cache.Len() != 109 || len(evicted) != 0 {
+		fail(t, `expected cache grows over capacity by batch, got len %d`, cache.Len())
+	}
+
+	cache.Set(109, 109)
+	if cache.Len() != 100 || len(evicted) != 10 {
+		fail(t, `expected batch evicted at once, got len %d, evicted %d`, cache.Len(), len(evicted))
+	}
+	for _, key := range evicted {
+		if key >= 10 || cache.Contains(key) {
+			fail(t, `expected least recently used keys evicted, got %v`, evicted)
+		}
+	}
+	if cache.Evict(50) != 50 || cache.Len() != 50 {
+		fail(t, `unexpected bulk eviction, len %d`, cache.Len())
+	}
+}
+
+func Test_ConcurrentGet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 100)
+	for key := 0; key < 50; key++ {
+		cache.Set(key, key)
+	}
+
+	const (
+		readers = 8
+		reads   = 1000
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < reads; j++ {
+				if value, ok := cache.Get(j % 100); ok != (j%100 < 50) || ok && value != j%100 {
+					fail(t, `unexpected lookup result %d, %v`, value, ok)
+				}
+				if j%10 == 0 {
+					cache.Set(j%50, j%50)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	if stats.Hits != readers*reads/2 || stats.Misses != readers*reads/2 {
+		fail(t, `expected all buffered lookups applied, got %d hits, %d misses`, stats.Hits, stats.Misses)
+	}
+
+	cache.Get(0)
+	cache.Set(100, 100)
+	info, _ := cache.EntryInfo(0)
+	if info.Hits != readers*reads/100+1 {
+		fail(t, `unexpected hits of entry %d`, info.Hits)
+	}
+}
+
+func Test_Locking(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for name, mode := range map[string]LockingMode{`SpinLock`: SpinLock, `RWMutexLock`: RWMutexLock} {
+		t.Run(name, func(t *testing.T) {
+			cache := NewCache[int, int](ctx, 100, WithLocking(mode), WithTTLEpochGranularity(time.Millisecond))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 500; j++ {
+						key := (i*500 + j) % 150
+						cache.SetNX(key, key, time.Duration(key%5+1)*time.Millisecond)
+						cache.Get(key)
+						cache.GetTTL(key)
+						cache.Len()
+						cache.Items()
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if cache.Len() > 100 {
+				fail(t, `unexpected cache size %d`, cache.Len())
+			}
+		})
+	}
+
+	t.Run(`NoLock`, func(t *testing.T) {
+		cache := NewCache[string, int](ctx, 10, WithLocking(NoLock), WithTTLEpochGranularity(5*time.Millisecond))
+		cache.SetNX(`key`, 1, 5*time.Millisecond)
+		cache.Set(`persistent`, 2)
+
+		time.Sleep(30 * time.Millisecond)
+		if cache.Contains(`key`) {
+			fail(t, `expected expiration applied lazily by lookup`)
+		}
+		if !cache.Contains(`persistent`) || cache.Len() != 1 {
+			fail(t, `expected persistent entry remains`)
+		}
+	})
+}
+
+func Test_ExpireBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const size = 4 * expireBatchSize
+	cache := NewCache[int, int](ctx, 2*size, WithTTLEpochGranularity(5*time.Millisecond))
+	for i := 0; i < size; i++ {
+		cache.SetNX(i, i, 5*time.Millisecond)
+	}
+	cache.SetNX(size, size, time.Hour)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// NOTE: lookups proceed while janitor sweeps expired entries.
+		for deadline := time.Now().Add(30 * time.Millisecond); time.Now().Before(deadline); {
+			cache.Get(rand.Intn(size))
+			runtime.Gosched()
+		}
+	}()
+	wg.Wait()
+	time.Sleep(30 * time.Millisecond)
+
+	if cache.Len() != 1 {
+		fail(t, `expected all expired entries removed, got %d entries`, cache.Len())
+	}
+	if _, ok := cache.Get(size); !ok {
+		fail(t, `expected not expired entry remains`)
+	}
+}
+
+func Test_TTLBucketRemoval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 100, WithTTLEpochGranularity(10*time.Millisecond))
+	for i := 0; i < 20; i++ {
+		cache.SetNX(i, i, 10*time.Millisecond)
+	}
+	// NOTE: remove keys from the middle of bucket, then reschedule rest of
+	// keys, each of them must be found in its slot.
+	for i := 0; i < 20; i += 3 {
+		cache.Remove(i)
+	}
+	for i := 0; i < 20; i++ {
+		if i%3 != 0 && i%2 == 0 {
+			cache.Expire(i, time.Hour)
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		_, ok := cache.Get(i)
+		if expected := i%3 != 0 && i%2 == 0; ok != expected {
+			fail(t, `unexpected presence of key %d: %v`, i, ok)
+		}
+	}
+	if histogram := cache.TTLHistogram([]time.Duration{time.Hour}); histogram.Counts[0] != cache.Len() || histogram.Persistent != 0 {
+		fail(t, `expected %d scheduled keys, got %v`, cache.Len(), histogram)
+	}
+}
+
+func Test_TimingWheel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// NOTE: with 1ms granularity TTL of 100ms is placed to second level of
+	// wheel and cascaded to first level before expiration.
+	cache := NewCache[string, int](ctx, 10, WithTTLEpochGranularity(time.Millisecond))
+	cache.SetNX(`short`, 1, 5*time.Millisecond)
+	cache.SetNX(`cascaded`, 2, 100*time.Millisecond)
+	cache.SetNX(`long`, 3, time.Hour)
+
+	time.Sleep(40 * time.Millisecond)
+	if cache.Contains(`short`) || !cache.Contains(`cascaded`) {
+		fail(t, `expected only short entry expired`)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if cache.Contains(`cascaded`) || !cache.Contains(`long`) {
+		fail(t, `expected cascaded entry expired and long entry remains`)
+	}
+	if ttl, ok := cache.GetTTL(`long`); !ok || ttl < 59*time.Minute {
+		fail(t, `unexpected TTL of long entry: %v`, ttl)
+	}
+}
+
+func Test_GetAllocs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, policy := range []evictionPolicy{LRU, LFU, ARC, TinyLFU, Hyperbolic} {
+		cache := NewCache[string, int](ctx, 100, WithEvictionPolicy(policy),
+			WithAdmission(NewTinyLFUAdmission(100)), WithDefaultTTL(time.Hour))
+		cache.Set(`key`, 1)
+		// NOTE: runs cover drain of read buffer under cache lock.
+		if allocs := testing.AllocsPerRun(1000, func() {
+			cache.Get(`key`)
+			cache.Get(`missing`)
+		}); allocs != 0 {
+			fail(t, `expected zero allocations per Get with policy %d, got %v`, policy, allocs)
+		}
+	}
+
+	sliding := NewCache[int, int](ctx, 100, WithSlidingTTL())
+	sliding.SetNX(1, 1, time.Hour)
+	if allocs := testing.AllocsPerRun(1000, func() { sliding.Get(1) }); allocs != 0 {
+		fail(t, `expected zero allocations per sliding Get, got %v`, allocs)
+	}
+}
+
+type hitListener struct {
+	countingListener
+	applied atomic.Int64
+}
+
+func (l *hitListener) RecordHit() { l.applied.Add(1) }
+
+func Test_ReadBufferDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := &hitListener{}
+	cache := NewCache[int, int](ctx, 100, WithMetricsListener(listener),
+		WithTTLEpochGranularity(5*time.Millisecond))
+	for key := 0; key < 10; key++ {
+		cache.Set(key, key)
+	}
+	for key := 0; key < 10; key++ {
+		cache.Get(key)
+	}
+	if listener.applied.Load() != 0 {
+		fail(t, `expected reads buffered`)
+	}
+
+	// NOTE: reads spread over stripes are applied by janitor, though no
+	// stripe is full.
+	time.Sleep(30 * time.Millisecond)
+	if hits := listener.applied.Load(); hits != 10 {
+		fail(t, `expected buffered reads applied periodically, got %d hits`, hits)
+	}
+}
+
+func Test_ReadMostly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10, WithReadMostly(), WithTTLEpochGranularity(5*time.Millisecond))
+	cache.Set(`flag`, 1)
+	cache.SetNX(`temporary`, 2, 5*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+	if _, ok := cache.Get(`flag`); ok {
+		fail(t, `expected entries evicted in order of writes`)
+	}
+	if value, ok := cache.Get(`9`); !ok || value != 9 {
+		fail(t, `unexpected value %d of key 9`, value)
+	}
+
+	cache.Set(`9`, 90)
+	cache.Remove(`8`)
+	if value, _ := cache.Get(`9`); value != 90 || cache.Contains(`8`) {
+		fail(t, `expected writes published to readers`)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		fail(t, `unexpected lookup stats %+v`, stats)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				cache.Get(strconv.Itoa(j % 10))
+			}
+		}()
+	}
+	cache.SetNX(`expiring`, 3, 5*time.Millisecond)
+	wg.Wait()
+
+	time.Sleep(30 * time.Millisecond)
+	if cache.Contains(`expiring`) {
+		fail(t, `expected expiration published by janitor`)
+	}
+}
+
+func Test_Close(t *testing.T) {
+	evicted := map[string]int{}
+	cache := NewCache[string, int](context.Background(), 10, WithEvictOnClose(),
+		WithOnEvict(func(key string, value int) { evicted[key] = value }))
+	cache.Set(`k1`, 1)
+	cache.SetNX(`k2`, 2, time.Hour)
+	cache.Set(`pinned`, 3)
+	cache.Pin(`pinned`)
+
+	if err := cache.Close(); err != nil {
+		fail(t, `unexpected error: %v`, err)
+	}
+	if len(evicted) != 3 || evicted[`pinned`] != 3 {
+		fail(t, `expected eviction callbacks for remaining entries, got %v`, evicted)
+	}
+
+	cache.Set(`k3`, 3)
+	if _, ok := cache.Get(`k1`); ok || cache.Contains(`k3`) || cache.Len() != 0 {
+		fail(t, `expected closed cache stores nothing`)
+	}
+	if err := cache.Close(); err != nil || len(evicted) != 3 {
+		fail(t, `expected repeated close is no-op`)
+	}
+}
+
+func Test_WithoutJanitor(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	cache := NewCache[string, int](context.Background(), 10, WithoutJanitor(),
+		WithTTLEpochGranularity(5*time.Millisecond))
+	if runtime.NumGoroutine() != goroutines {
+		fail(t, `expected no background goroutine`)
+	}
+
+	cache.SetNX(`key`, 1, 5*time.Millisecond)
+	cache.Set(`persistent`, 2)
+	time.Sleep(30 * time.Millisecond)
+	if cache.Len() != 1 || cache.Contains(`key`) {
+		fail(t, `expected expired entry collected lazily`)
+	}
+
+	// NOTE: epochs of idle cache are skipped, entries scheduled after it
+	// expire on time.
+	cache.SetNX(`key`, 1, 10*time.Millisecond)
+	if !cache.Contains(`key`) {
+		fail(t, `expected entry present before expiration`)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.Get(`key`); ok {
+		fail(t, `expected entry expired`)
+	}
+}
+
+func Test_Cleanup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	expired := 0
+	cache := NewCache[int, int](ctx, 10, WithTTLEpochGranularity(time.Hour),
+		WithOnExpire(func(key, value int) { expired++ }))
+	cache.SetNX(1, 1, time.Millisecond)
+	cache.SetNX(2, 2, time.Millisecond)
+	cache.SetNX(3, 3, time.Minute)
+	cache.Set(4, 4)
+
+	time.Sleep(5 * time.Millisecond)
+	if removed := cache.Cleanup(); removed != 2 || expired != 2 {
+		fail(t, `expected 2 expired entries removed, got %d`, removed)
+	}
+	if cache.Len() != 2 || !cache.Contains(3) || !cache.Contains(4) {
+		fail(t, `expected not expired entries remain`)
+	}
+	if removed := cache.Cleanup(); removed != 0 {
+		fail(t, `unexpected removal by repeated cleanup`)
+	}
+}
+
+func Test_PauseExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10, WithTTLEpochGranularity(5*time.Millisecond))
+	cache.PauseExpiry()
+	cache.SetNX(`short`, 1, 5*time.Millisecond)
+	cache.SetNX(`long`, 2, 60*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	if !cache.Contains(`short`) {
+		fail(t, `expected expiration suspended`)
+	}
+
+	cache.ResumeExpiry()
+	time.Sleep(20 * time.Millisecond)
+	if cache.Contains(`short`) || !cache.Contains(`long`) {
+		fail(t, `expected only expired entry collected after resume`)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if cache.Contains(`long`) {
+		fail(t, `expected entry inserted during pause expired`)
+	}
+}
+
+func Test_SetGranularity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10, WithTTLEpochGranularity(time.Hour))
+	cache.SetNX(`short`, 1, 20*time.Millisecond)
+	cache.SetNX(`long`, 2, time.Hour)
+
+	cache.SetGranularity(0)
+	cache.SetGranularity(5 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	if cache.Len() != 1 || !cache.Contains(`long`) {
+		fail(t, `expected entry expired by new granularity`)
+	}
+
+	cache.SetNX(`next`, 3, 10*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	if cache.Len() != 1 {
+		fail(t, `expected entry set after rescale expired`)
+	}
+}
+
+func Test_InitialEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10, WithInitialEntries(map[string]SeedEntry[int]{
+		`persistent`: {Value: 1},
+		`expiring`:   {Value: 2, TTL: time.Hour},
+	}))
+	if cache.Len() != 2 {
+		fail(t, `expected cache populated by initial entries`)
+	}
+	if value, ok := cache.Get(`persistent`); !ok || value != 1 {
+		fail(t, `expected persistent initial entry`)
+	}
+	if ttl, ok := cache.GetTTL(`expiring`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected initial entry with TTL`)
+	}
+	if ttl, ok := cache.GetTTL(`persistent`); !ok || ttl != 0 {
+		fail(t, `expected initial entry without TTL`)
+	}
+}
+
+func Test_Healthy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10, WithTTLEpochGranularity(10*time.Millisecond))
+	cache.SetNX(`key`, 1, time.Hour)
+	cache.Pin(`key`)
+	cache.Set(`other`, 2)
+	if err := cache.Healthy(); err != nil {
+		fail(t, `expected healthy cache, got %v`, err)
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	if err := cache.Healthy(); !errors.Is(err, errJanitorStopped) {
+		fail(t, `expected stopped janitor, got %v`, err)
+	}
+	if err := cache.Close(); err != nil || !errors.Is(cache.Healthy(), ErrClosed) {
+		fail(t, `expected closed cache unhealthy`)
+	}
+
+	clock := &fakeClock{now: time.Now()}
+	stalled := NewCache[string, int](context.Background(), 10, WithClock(clock))
+	defer stalled.Close()
+	clock.Advance(time.Minute)
+	if err := stalled.Healthy(); !errors.Is(err, errJanitorStalled) {
+		fail(t, `expected stalled janitor, got %v`, err)
+	}
+}
+
+func Test_Snapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10)
+	cache.Set(`persistent`, 1)
+	cache.SetNX(`expiring`, 2, time.Hour)
+	cache.SetNX(`pinned`, 3, time.Hour)
+	cache.Pin(`pinned`)
+	cache.SetWithDeadline(`expired`, 4, time.Now().Add(-time.Second))
+
+	var buf bytes.Buffer
+	if err := cache.Snapshot(&buf); err != nil {
+		fail(t, `unexpected snapshot error: %v`, err)
+	}
+
+	restored := NewCache[string, int](ctx, 10)
+	restored.Set(`other`, 5)
+	if err := restored.RestoreSnapshot(&buf); err != nil {
+		fail(t, `unexpected restore error: %v`, err)
+	}
+	if restored.Len() != 4 || restored.Contains(`expired`) {
+		fail(t, `expected restored entries except expired one, got %d`, restored.Len())
+	}
+	if value, ok := restored.Get(`persistent`); !ok || value != 1 {
+		fail(t, `expected restored persistent entry`)
+	}
+	if ttl, ok := restored.GetTTL(`expiring`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected restored remaining TTL, got %s`, ttl)
+	}
+	if !restored.Unpin(`pinned`) {
+		fail(t, `expected restored entry pinned`)
+	}
+
+	if err := restored.RestoreSnapshot(strings.NewReader(`garbage`)); err == nil {
+		fail(t, `expected error of malformed snapshot`)
+	}
+}
+
+// writeHook is writer, which calls hook on each write.
+type writeHook struct {
+	bytes.Buffer
+	hook func()
+}
+
+func (w *writeHook) Write(p []byte) (int, error) {
+	w.hook()
+	return w.Buffer.Write(p)
+}
+
+func Test_StreamingSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 0)
+	size := 3 * snapshotChunkSize
+	for i := 0; i < size; i++ {
+		cache.Set(i, i)
+	}
+
+	// NOTE: write to cache during snapshot deadlocks, if snapshot holds
+	// cache lock while encoding.
+	w := &writeHook{hook: func() { cache.Set(-1, -1) }}
+	if err := cache.Snapshot(w); err != nil {
+		fail(t, `unexpected snapshot error: %v`, err)
+	}
+
+	restored := NewCache[int, int](ctx, 0)
+	if err := restored.RestoreSnapshot(&w.Buffer); err != nil {
+		fail(t, `unexpected restore error: %v`, err)
+	}
+	if restored.Len() != size {
+		fail(t, `expected all entries restored, got %d`, restored.Len())
+	}
+	if value, ok := restored.Get(size - 1); !ok || value != size-1 {
+		fail(t, `expected entry of last chunk restored`)
+	}
+}
+
+func Test_Load(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := NewCache[string, int](ctx, 0)
+	source.Set(`first`, 1)
+	source.SetNX(`second`, 2, time.Hour)
+	source.Set(`third`, 3)
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		fail(t, `unexpected snapshot error: %v`, err)
+	}
+
+	snapshot := buf.Bytes()
+	cache := NewCache[string, int](ctx, 3)
+	cache.Set(`first`, 10)
+	if err := cache.Load(bytes.NewReader(snapshot), GobCodec{}); err != nil {
+		fail(t, `unexpected load error: %v`, err)
+	}
+	if value, ok := cache.Peek(`first`); !ok || value != 10 || cache.Len() != 3 {
+		fail(t, `expected present entry kept, got %d`, value)
+	}
+
+	cache = NewCache[string, int](ctx, 1)
+	if err := cache.Load(bytes.NewReader(snapshot), GobCodec{}); err != nil || cache.Len() != 1 {
+		fail(t, `expected loaded entries bounded by capacity, got %d`, cache.Len())
+	}
+
+	cache = NewCache[string, int](ctx, 10)
+	stream := `[{"Key":"first","Value":1},{"Key":"second","Value":2,"TTL":3600000000000}] [{"Key":"third","Value":3,"Pinned":true}]`
+	if err := cache.Load(strings.NewReader(stream), JSONCodec{}); err != nil {
+		fail(t, `unexpected load error: %v`, err)
+	}
+	if cache.Len() != 3 {
+		fail(t, `expected all chunks loaded, got %d`, cache.Len())
+	}
+	if ttl, ok := cache.GetTTL(`second`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected loaded TTL, got %s`, ttl)
+	}
+	if !cache.Unpin(`third`) {
+		fail(t, `expected loaded entry pinned`)
+	}
+	if err := cache.Load(strings.NewReader(`{`), JSONCodec{}); err == nil {
+		fail(t, `expected error of malformed stream`)
+	}
+}
+
+// truncatableBuffer is operation log compacted by snapshot.
+type truncatableBuffer struct {
+	bytes.Buffer
+}
+
+func (b *truncatableBuffer) Truncate(size int64) error {
+	b.Buffer.Truncate(int(size))
+	return nil
+}
+
+func Test_OperationLog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var log bytes.Buffer
+	cache := NewCache[string, int](ctx, 10, WithOperationLog(&log))
+	cache.Set(`persistent`, 1)
+	cache.SetNX(`expiring`, 2, time.Hour)
+	cache.Set(`removed`, 3)
+	cache.Remove(`removed`)
+	cache.SetWithDeadline(`expired`, 4, time.Now().Add(-time.Second))
+	cache.Set(`updated`, 5)
+	cache.Set(`updated`, 6)
+	cache.SetNX(`persisted`, 7, time.Hour)
+	cache.Persist(`persisted`)
+
+	// NOTE: torn record left by crash is ignored.
+	torn := append(bytes.Clone(log.Bytes()), 42, 1, 2)
+	replayed := NewCache[string, int](ctx, 10)
+	if err := replayed.ReplayLog(bytes.NewReader(torn)); err != nil {
+		fail(t, `unexpected replay error: %v`, err)
+	}
+	if replayed.Len() != 4 || replayed.Contains(`removed`) || replayed.Contains(`expired`) {
+		fail(t, `expected state recovered from log, got %v`, replayed.Keys())
+	}
+	if value, _ := replayed.Get(`updated`); value != 6 {
+		fail(t, `expected last value of key recovered, got %d`, value)
+	}
+	if ttl, ok := replayed.GetTTL(`expiring`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected recovered TTL, got %s`, ttl)
+	}
+	if ttl, ok := replayed.GetTTL(`persisted`); !ok || ttl != 0 {
+		fail(t, `expected recovered removal of TTL, got %s`, ttl)
+	}
+
+	var removals atomic.Int64
+	quiet := NewCache[string, int](ctx, 10, WithOnRemoval(func(string, int, Reason) { removals.Add(1) }))
+	quiet.Set(`removed`, 0)
+	if err := quiet.ReplayLog(bytes.NewReader(log.Bytes())); err != nil {
+		fail(t, `unexpected replay error: %v`, err)
+	}
+	if n := removals.Load(); n != 0 || quiet.Contains(`removed`) {
+		fail(t, `expected replayed removals without callbacks, got %d`, n)
+	}
+	corrupted := binary.AppendUvarint(nil, 1<<40)
+	if err := replayed.ReplayLog(bytes.NewReader(corrupted)); !errors.Is(err, errLogCorrupted) {
+		fail(t, `expected corrupted log error, got %v`, err)
+	}
+
+	cache.Clear()
+	replayed = NewCache[string, int](ctx, 10)
+	if err := replayed.ReplayLog(&log); err != nil || replayed.Len() != 0 {
+		fail(t, `expected cleared cache recovered, got %v`, err)
+	}
+
+	var compacted truncatableBuffer
+	cache = NewCache[string, int](ctx, 10, WithOperationLog(&compacted))
+	cache.Set(`key`, 1)
+	if err := cache.Snapshot(io.Discard); err != nil || compacted.Len() != 0 {
+		fail(t, `expected log compacted by snapshot, got %v`, err)
+	}
+	cache.Set(`next`, 2)
+	if compacted.Len() == 0 {
+		fail(t, `expected operation logged after compaction`)
+	}
+
+	size := compacted.Len()
+	if err := cache.Snapshot(failingWriter{}); err == nil || compacted.Len() != size {
+		fail(t, `expected log kept by failed snapshot, got %v`, err)
+	}
+
+	// NOTE: operations made during snapshot are kept by compacted log.
+	var snapshot bytes.Buffer
+	during := writerFunc(func(p []byte) (int, error) {
+		cache.Set(`during`, 3)
+		return snapshot.Write(p)
+	})
+	if err := cache.Snapshot(during); err != nil {
+		fail(t, `unexpected snapshot error: %v`, err)
+	}
+	replayed = NewCache[string, int](ctx, 10)
+	if err := replayed.ReplayLog(&compacted.Buffer); err != nil || replayed.Len() != 1 || !replayed.Contains(`during`) {
+		fail(t, `expected only operations during snapshot kept, got %v`, replayed.Keys())
+	}
+}
+
+// writerFunc is writer implemented by function.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// failingWriter is writer, which fails each write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New(`write failed`)
+}
+
+func Test_PersistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `cache.gob`)
+
+	cache := NewCache[string, int](context.Background(), 10, WithPersistFile(path))
+	if cache.Len() != 0 {
+		fail(t, `expected empty cache without persist file`)
+	}
+	cache.Set(`persistent`, 1)
+	cache.SetNX(`expiring`, 2, time.Hour)
+	if err := cache.Close(); err != nil {
+		fail(t, `unexpected close error: %v`, err)
+	}
+
+	restored := NewCache[string, int](context.Background(), 10, WithPersistFile(path))
+	defer restored.Close()
+	if value, ok := restored.Get(`persistent`); !ok || value != 1 {
+		fail(t, `expected entry restored from persist file`)
+	}
+	if ttl, ok := restored.GetTTL(`expiring`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected TTL restored from persist file, got %s`, ttl)
+	}
+
+	broken := NewCache[string, int](context.Background(), 10, WithPersistFile(t.TempDir()))
+	if err := broken.Close(); err == nil {
+		fail(t, `expected error of save to directory`)
+	}
+}
+
+func Test_OverflowStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		fail(t, `unexpected store error: %v`, err)
+	}
+	cache := NewCache[string, int](ctx, 2, WithOverflowStore(store))
+	cache.SetNX(`first`, 1, time.Hour)
+	cache.Set(`second`, 2)
+	cache.Set(`third`, 3)
+	if cache.Len() != 2 || cache.Contains(`first`) {
+		fail(t, `expected entry evicted from memory`)
+	}
+
+	if value, ok := cache.Get(`first`); !ok || value != 1 {
+		fail(t, `expected evicted entry read back from store`)
+	}
+	if ttl, ok := cache.GetTTL(`first`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected TTL of entry read back from store, got %s`, ttl)
+	}
+
+	// NOTE: second is evicted by promotion of first.
+	cache.Remove(`second`)
+	if _, ok := cache.Get(`second`); ok {
+		fail(t, `expected removed entry deleted from store`)
+	}
+
+	cache.SetWithDeadline(`expired`, 4, time.Now().Add(10*time.Millisecond))
+	cache.Set(`fourth`, 5)
+	cache.Set(`fifth`, 6)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get(`expired`); ok {
+		fail(t, `expected expired entry not read back from store`)
+	}
+}
+
+// slowStore is overflow store, which writes block until released.
+type slowStore struct {
+	OverflowStore
+	release chan struct{}
+}
+
+func (s *slowStore) Put(key, value []byte, deadline time.Time) error {
+	<-s.release
+	return s.OverflowStore.Put(key, value, deadline)
+}
+
+func Test_EvictionSpill(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := NewDirStore(t.TempDir())
+	if err != nil {
+		fail(t, `unexpected store error: %v`, err)
+	}
+	store := &slowStore{OverflowStore: dir, release: make(chan struct{})}
+	cache := NewCache[string, int](ctx, 1, WithEvictionSpill(store))
+	cache.Set(`first`, 1)
+	cache.Set(`second`, 2)
+	cache.Set(`third`, 3)
+	if cache.Len() != 1 {
+		fail(t, `expected eviction not blocked by store`)
+	}
+
+	// NOTE: queued spill is visible before it is written.
+	if value, ok := cache.Get(`first`); !ok || value != 1 {
+		fail(t, `expected queued entry read back`)
+	}
+	cache.Remove(`second`)
+	if _, ok := cache.Get(`second`); ok {
+		fail(t, `expected removed entry not read back`)
+	}
+
+	close(store.release)
+	if err := cache.Close(); err != nil {
+		fail(t, `unexpected close error: %v`, err)
+	}
+	key, _ := encodeGob(`third`)
+	if _, _, ok, _ := dir.Get(key); !ok {
+		fail(t, `expected spilled entry written to store on close`)
+	}
+}
+
+func Test_Loader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	cache := NewCache[string, int](ctx, 10, WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+		loads.Add(1)
+		<-release
+		if key == `missing` {
+			return 0, 0, fmt.Errorf(`not found`)
+		}
+		return len(key), time.Hour, nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, ok := cache.Get(`key`); !ok || value != 3 {
+				t.Errorf(`expected loaded value, got %d`, value)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads.Load() != 1 {
+		fail(t, `expected single load of key, got %d`, loads.Load())
+	}
+	if ttl, ok := cache.GetTTL(`key`); !ok || ttl <= 0 || ttl > time.Hour {
+		fail(t, `expected loaded value cached with TTL`)
+	}
+
+	if _, ok := cache.Get(`missing`); ok || cache.Contains(`missing`) {
+		fail(t, `expected failed load reported as miss`)
+	}
+}
+
+func Test_NegativeCaching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errNotFound := errors.New(`not found`)
+	loads := map[string]int{}
+	cache := NewCache[string, int](ctx, 10,
+		WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+			loads[key]++
+			if key == `timeout` {
+				return 0, 0, context.DeadlineExceeded
+			}
+			return 0, 0, errNotFound
+		}),
+		WithNegativeCaching(20*time.Millisecond, func(err error) bool {
+			return errors.Is(err, errNotFound)
+		}),
+	)
+
+	for i := 0; i < 3; i++ {
+		cache.Get(`missing`)
+		cache.Get(`timeout`)
+	}
+	if loads[`missing`] != 1 || loads[`timeout`] != 3 {
+		fail(t, `expected only accepted failure cached, got %v`, loads)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	cache.Get(`missing`)
+	if loads[`missing`] != 2 {
+		fail(t, `expected failure expired, got %v`, loads)
+	}
+
+	cache.Set(`missing`, 1)
+	cache.Remove(`missing`)
+	cache.Get(`missing`)
+	if loads[`missing`] != 3 {
+		fail(t, `expected failure dropped by set, got %v`, loads)
+	}
+}
+
+func Test_GetCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	cache := NewCache[string, int](ctx, 10, WithLoader(func(ctx context.Context, key string) (int, time.Duration, error) {
+		close(started)
+		<-release
+		return 1, time.Hour, nil
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if value, ok, err := cache.GetCtx(ctx, `key`); !ok || err != nil || value != 1 {
+			t.Errorf(`expected loaded value, got %d, %v`, value, err)
+		}
+	}()
+	<-started
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	if _, ok, err := cache.GetCtx(waitCtx, `key`); ok || !errors.Is(err, context.DeadlineExceeded) {
+		fail(t, `expected wait for load stopped by deadline, got %v`, err)
+	}
+	if _, err := cache.GetOrComputeCtx(waitCtx, `other`, func() (int, time.Duration, error) {
+		t.Error(`unexpected computation with done context`)
+		return 0, 0, nil
+	}); !errors.Is(err, context.DeadlineExceeded) {
+		fail(t, `expected computation not started, got %v`, err)
+	}
+
+	close(release)
+	<-done
+	if value, ok, err := cache.GetCtx(waitCtx, `key`); !ok || err != nil || value != 1 {
+		fail(t, `expected cached value returned regardless of context`)
+	}
+}
+
+func Test_BulkLoader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls [][]string
+	cache := NewCache[string, int](ctx, 10, WithBulkLoader(func(_ context.Context, keys []string) (map[string]int, error) {
+		calls = append(calls, keys)
+		values := make(map[string]int, len(keys))
+		for _, key := range keys {
+			if key != `missing` {
+				values[key] = len(key)
+			}
+		}
+		return values, nil
+	}))
+	cache.Set(`a`, 1)
+
+	values := cache.GetMany([]string{`a`, `bb`, `ccc`, `missing`})
+	if len(calls) != 1 || len(calls[0]) != 3 {
+		fail(t, `expected single load of missed keys, got %v`, calls)
+	}
+	if len(values) != 3 || values[`a`] != 1 || values[`bb`] != 2 || values[`ccc`] != 3 {
+		fail(t, `expected cached and loaded values, got %v`, values)
+	}
+	if !cache.Contains(`ccc`) || cache.Contains(`missing`) {
+		fail(t, `expected loaded values cached`)
+	}
+
+	cache.GetMany([]string{`a`, `bb`})
+	if len(calls) != 1 {
+		fail(t, `expected no load without misses`)
+	}
+}
+
+func Test_LoaderRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	attempts := map[string]int{}
+	cache := NewCache[string, int](ctx, 10,
+		WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+			attempts[key]++
+			if key == `flaky` && attempts[key] == 3 {
+				return 1, time.Hour, nil
+			}
+			return 0, 0, fmt.Errorf(`unavailable`)
+		}),
+		WithLoaderRetry(3, time.Millisecond, 2*time.Millisecond),
+	)
+
+	if value, ok := cache.Get(`flaky`); !ok || value != 1 || attempts[`flaky`] != 3 {
+		fail(t, `expected load succeeded on last attempt, got %v`, attempts)
+	}
+	if _, ok := cache.Get(`down`); ok || attempts[`down`] != 3 {
+		fail(t, `expected attempts capped, got %v`, attempts)
+	}
+
+	doneCtx, doneCancel := context.WithCancel(ctx)
+	doneCancel()
+	if _, _, err := cache.GetCtx(doneCtx, `cancelled`); err == nil || attempts[`cancelled`] > 1 {
+		fail(t, `expected no retry with done context, got %v`, attempts)
+	}
+}
+
+func Test_LockKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[string, int](ctx, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := cache.LockKey(`counter`)
+			defer unlock()
+			value, _ := cache.Get(`counter`)
+			runtime.Gosched()
+			cache.Set(`counter`, value+1)
+		}()
+	}
+	wg.Wait()
+	if value, _ := cache.Get(`counter`); value != 50 {
+		fail(t, `expected serialized increments, got %d`, value)
+	}
+
+	// NOTE: locks of different keys are independent.
+	unlock := cache.LockKey(`first`)
+	cache.LockKey(`second`)()
+	unlock()
+	for i := range cache.keyLocks.shards {
+		if len(cache.keyLocks.shards[i].locks) != 0 {
+			fail(t, `expected released mutexes removed`)
+		}
+	}
+}
+
+func Test_InvalidationBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := NewLocalBus()
+	first := NewCache[string, int](ctx, 10, WithInvalidationBus(bus))
+	second := NewCache[string, int](ctx, 10, WithInvalidationBus(bus))
+
+	// NOTE: values filled by GetOrCompute are not published.
+	fill := func(key string) {
+		second.GetOrCompute(key, func() (int, time.Duration, error) { return 1, time.Minute, nil })
+	}
+	// invalidated waits for asynchronous publishing of invalidation.
+	invalidated := func(key string) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if !second.Contains(key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	fill(`key`)
+	first.Set(`key`, 2)
+	if !invalidated(`key`) {
+		fail(t, `expected key set by peer invalidated`)
+	}
+	if value, ok := first.Get(`key`); !ok || value != 2 {
+		fail(t, `expected own invalidation ignored`)
+	}
+
+	fill(`removed`)
+	first.Remove(`removed`)
+	if !invalidated(`removed`) {
+		fail(t, `expected key removed by peer invalidated`)
+	}
+
+	fill(`loaded`)
+	if _, err := first.GetOrCompute(`loaded`, func() (int, time.Duration, error) { return 2, time.Minute, nil }); err != nil {
+		fail(t, `unexpected compute error: %v`, err)
+	}
+	if err := first.Close(); err != nil {
+		fail(t, `unexpected close error: %v`, err)
+	}
+	if !second.Contains(`loaded`) {
+		fail(t, `expected computed value not published`)
+	}
+	if _, ok := first.Get(`key`); ok {
+		fail(t, `expected closed cache to be empty`)
+	}
+}
+
+// mapStore is backing store kept in map, which fails writes of key "fail".
+type mapStore struct {
+	lock    sync.Mutex
+	values  map[string]int
+	deletes int
+}
+
+func (s *mapStore) Write(_ context.Context, key string, value int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if key == `fail` {
+		return errors.New(`store unavailable`)
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *mapStore) Delete(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.deletes++
+	delete(s.values, key)
+	return nil
+}
+
+func Test_WriteThrough(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mapStore{values: map[string]int{}}
+	cache := NewCache[string, int](ctx, 10, WithWriteThrough[string, int](store))
+
+	cache.Set(`first`, 1)
+	cache.SetNX(`second`, 2, time.Minute)
+	cache.SetMany(map[string]int{`third`: 3}, time.Minute)
+	if _, loaded := cache.GetOrSet(`fourth`, 4, time.Minute); loaded {
+		fail(t, `expected missing key set`)
+	}
+	for key, value := range map[string]int{`first`: 1, `second`: 2, `third`: 3, `fourth`: 4} {
+		if store.values[key] != value {
+			fail(t, `expected %s written through to store`, key)
+		}
+		if v, ok := cache.Peek(key); !ok || v != value {
+			fail(t, `expected %s set to cache`, key)
+		}
+	}
+
+	cache.Set(`fail`, 1)
+	if cache.Contains(`fail`) {
+		fail(t, `expected failed write not set to cache`)
+	}
+
+	// NOTE: writes do not wait for lock of key held by caller.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		unlock := cache.LockKey(`first`)
+		defer unlock()
+		value, _ := cache.Get(`first`)
+		cache.Set(`first`, value+1)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		fail(t, `expected Set under LockKey not blocked`)
+	}
+	if store.values[`first`] != 2 {
+		fail(t, `expected incremented value written through, got %d`, store.values[`first`])
+	}
+
+	cache.GetOrCompute(`computed`, func() (int, time.Duration, error) { return 5, time.Minute, nil })
+	if _, ok := store.values[`computed`]; ok {
+		fail(t, `expected computed value not written back`)
+	}
+
+	cache.Delete(`first`)
+	if _, ok := cache.Pop(`second`); !ok {
+		fail(t, `expected popped value`)
+	}
+	cache.Remove(`third`)
+	if _, ok := store.values[`first`]; ok || cache.Contains(`first`) {
+		fail(t, `expected deleted key deleted from store and cache`)
+	}
+	if store.values[`second`] != 2 || store.values[`third`] != 3 || store.deletes != 1 {
+		fail(t, `expected popped and removed keys kept by store`)
+	}
+}
+
+// batchStore is backing store written by batches, which fails first batch.
+type batchStore struct {
+	mapStore
+	batches int
+}
+
+func (s *batchStore) WriteBatch(_ context.Context, writes map[string]int, deletes []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.batches++; s.batches == 1 {
+		return errors.New(`store unavailable`)
+	}
+	for key, value := range writes {
+		s.values[key] = value
+	}
+	for _, key := range deletes {
+		delete(s.values, key)
+	}
+	return nil
+}
+
+func Test_WriteBehind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mapStore{values: map[string]int{`removed`: 1}}
+	cache := NewCache[string, int](ctx, 1,
+		WithWriteBehind[string, int](store, time.Hour, 10, 1),
+		WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+			value, ok := store.values[key]
+			if !ok {
+				return 0, 0, errors.New(`not found`)
+			}
+			return value, time.Minute, nil
+		}))
+
+	cache.Set(`first`, 1)
+	cache.Set(`first`, 2)
+	if len(store.values) != 1 {
+		fail(t, `expected writes queued`)
+	}
+	// NOTE: evicted key is loaded after its queued write is flushed.
+	cache.Set(`second`, 1)
+	if value, ok := cache.Get(`first`); !ok || value != 2 {
+		fail(t, `expected coalesced write flushed before load, got %d`, value)
+	}
+	cache.Delete(`removed`)
+	if err := cache.Close(); err != nil {
+		fail(t, `unexpected close error: %v`, err)
+	}
+	if len(store.values) != 2 || store.values[`first`] != 2 || store.values[`second`] != 1 {
+		fail(t, `expected queued mutations flushed on close, got %v`, store.values)
+	}
+
+	batches := &batchStore{mapStore: mapStore{values: map[string]int{}}}
+	cache = NewCache[string, int](ctx, 10, WithWriteBehind[string, int](batches, time.Hour, 2, 2))
+	cache.Set(`first`, 1)
+	cache.Set(`second`, 2)
+	cache.Set(`third`, 3)
+	if err := cache.Close(); err != nil {
+		fail(t, `unexpected close error: %v`, err)
+	}
+	if len(batches.values) != 3 {
+		fail(t, `expected failed batch retried, got %v`, batches.values)
+	}
+}
+
+func Test_Tiered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		fail(t, `unexpected store error: %v`, err)
+	}
+	l1 := NewCache[string, int](ctx, 1)
+	tiered := NewTiered(CacheLayer(l1), StoreLayer[string, int](store),
+		WithLayerTTLScale(0.5, 1), WithPromotion(func(key string) bool { return key != `cold` }))
+
+	tiered.Set(ctx, `first`, 1, time.Hour)
+	if ttl, _ := l1.GetTTL(`first`); ttl > 30*time.Minute || ttl < 29*time.Minute {
+		fail(t, `expected TTL of L1 scaled, got %s`, ttl)
+	}
+	tiered.Set(ctx, `cold`, 2, time.Hour)
+	if l1.Contains(`first`) {
+		fail(t, `expected first key evicted from L1`)
+	}
+	if value, ok, err := tiered.Get(ctx, `first`); !ok || err != nil || value != 1 {
+		fail(t, `expected value read from L2`)
+	}
+	if !l1.Contains(`first`) {
+		fail(t, `expected value promoted to L1`)
+	}
+	if value, ok, _ := tiered.Get(ctx, `cold`); !ok || value != 2 || l1.Contains(`cold`) {
+		fail(t, `expected cold value read from L2 without promotion`)
+	}
+	if _, ok, _ := tiered.Get(ctx, `missing`); ok {
+		fail(t, `expected missing value`)
+	}
+	stats := tiered.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Promotions != 1 || stats.L2.Sets != 2 {
+		fail(t, `unexpected stats: %+v`, stats)
+	}
+
+	store, err = NewDirStore(t.TempDir())
+	if err != nil {
+		fail(t, `unexpected store error: %v`, err)
+	}
+	l1 = NewCache[string, int](ctx, 1, WithDefaultTTL(time.Minute))
+	l2 := &failingLayer{Layer: StoreLayer[string, int](store)}
+	exclusive := NewTiered(CacheLayer(l1), l2, WithExclusiveLayers())
+
+	exclusive.Set(ctx, `first`, 1, time.Hour)
+	if _, _, ok, _ := l2.Get(ctx, `first`); ok {
+		fail(t, `expected value set only to L1`)
+	}
+	exclusive.Set(ctx, `second`, 2, time.Hour)
+	if _, _, ok, _ := l2.Get(ctx, `first`); !ok {
+		fail(t, `expected evicted value demoted to L2`)
+	}
+	if value, ok, _ := exclusive.Get(ctx, `first`); !ok || value != 1 {
+		fail(t, `expected demoted value read back`)
+	}
+	if _, _, ok, _ := l2.Get(ctx, `first`); ok {
+		fail(t, `expected promoted value removed from L2`)
+	}
+	if stats := exclusive.Stats(); stats.Demotions != 2 || stats.Promotions != 1 {
+		fail(t, `unexpected stats: %+v`, stats)
+	}
+
+	exclusive.Set(ctx, `persistent`, 3, 0)
+	if ttl, ok := l1.GetTTL(`persistent`); !ok || ttl != 0 {
+		fail(t, `expected value without TTL set to L1 without default TTL, got %s`, ttl)
+	}
+	if _, ttl, ok, _ := l2.Get(ctx, `first`); !ok || ttl <= 0 {
+		fail(t, `expected evicted value demoted with its TTL`)
+	}
+	l2.err = errors.New(`unavailable`)
+	if value, ok, err := exclusive.Get(ctx, `first`); !ok || value != 1 || !errors.Is(err, l2.err) {
+		fail(t, `expected failed removal of promoted value reported, got %v`, err)
+	}
+}
+
+// hookLayer is layer, which calls hook before Set.
+type hookLayer struct {
+	Layer[string, int]
+	hook func(key string)
+}
+
+func (l hookLayer) Set(ctx context.Context, key string, value int, ttl time.Duration) error {
+	l.hook(key)
+	return l.Layer.Set(ctx, key, value, ttl)
+}
+
+func Test_TieredDemotion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		fail(t, `unexpected store error: %v`, err)
+	}
+	l1 := NewCache[string, int](ctx, 1)
+	// NOTE: L2 calls L1, which deadlocks if demotion runs under its lock.
+	l2 := hookLayer{Layer: StoreLayer[string, int](store), hook: func(string) { l1.Len() }}
+	tiered := NewTiered(CacheLayer(l1), l2, WithExclusiveLayers())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tiered.Set(ctx, `first`, 1, time.Hour)
+		tiered.Set(ctx, `second`, 2, time.Hour)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		fail(t, `expected demotion run without lock of L1`)
+	}
+	if _, _, ok, _ := l2.Get(ctx, `first`); !ok {
+		fail(t, `expected evicted value demoted to L2`)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				fail(t, `expected L1 of another exclusive tiered cache rejected`)
+			}
+		}()
+		NewTiered(CacheLayer(l1), l2, WithExclusiveLayers())
+	}()
+
+	// NOTE: key demoted during its promotion is kept in L2.
+	var racing *Tiered[string, int]
+	racy := hookLayer{Layer: CacheLayer(NewCache[string, int](ctx, 10)), hook: func(key string) {
+		racing.Demote(ctx, key, 3, time.Hour)
+	}}
+	racing = NewTiered[string, int](racy, StoreLayer[string, int](store), WithExclusiveLayers())
+	if value, ok, err := racing.Get(ctx, `first`); !ok || err != nil || value != 1 {
+		fail(t, `expected value read from L2, got %v`, err)
+	}
+	if value, _, ok, _ := l2.Get(ctx, `first`); !ok || value != 3 {
+		fail(t, `expected value demoted during promotion kept in L2`)
+	}
+}
+
+// failingLayer is layer, which fails removal with err.
+type failingLayer struct {
+	Layer[string, int]
+	err error
+}
+
+func (l *failingLayer) Remove(ctx context.Context, key string) error {
+	if l.err != nil {
+		return l.err
+	}
+	return l.Layer.Remove(ctx, key)
+}
+
+func Test_ErrorVariants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Now()}
+	cache := NewCache[string, int](ctx, 1, WithClock(clock), WithMaxEntrySize(1),
+		WithSizer(func(_ string, value int) int64 { return int64(value) }))
+
+	if err := cache.SetE(`key`, 1); err != nil {
+		fail(t, `unexpected set error: %v`, err)
+	}
+	if value, err := cache.GetE(`key`); err != nil || value != 1 {
+		fail(t, `expected value, got %v`, err)
+	}
+	if _, err := cache.GetE(`missing`); !errors.Is(err, ErrNotFound) {
+		fail(t, `expected ErrNotFound, got %v`, err)
+	}
+	if err := cache.SetE(`large`, 2); !errors.Is(err, ErrCapacityExceeded) {
+		fail(t, `expected ErrCapacityExceeded, got %v`, err)
+	}
+
+	cache.SetNX(`short`, 1, time.Second)
+	clock.Advance(2 * time.Second)
+	if _, err := cache.GetE(`short`); !errors.Is(err, ErrExpired) {
+		fail(t, `expected ErrExpired, got %v`, err)
+	}
+	if cache.Contains(`short`) {
+		fail(t, `expected expired entry removed`)
+	}
+
+	cache.Close()
+	if _, err := cache.GetE(`key`); !errors.Is(err, ErrClosed) {
+		fail(t, `expected ErrClosed, got %v`, err)
+	}
+	if err := cache.SetE(`key`, 1); !errors.Is(err, ErrClosed) {
+		fail(t, `expected ErrClosed, got %v`, err)
+	}
+
+	sliding := NewCache[string, int](ctx, 10, WithClock(clock), WithSlidingTTL())
+	sliding.SetNX(`short`, 1, time.Second)
+	clock.Advance(2 * time.Second)
+	if _, err := sliding.GetE(`short`); !errors.Is(err, ErrExpired) {
+		fail(t, `expected ErrExpired in sliding mode, got %v`, err)
+	}
+
+	store := &mapStore{values: map[string]int{}}
+	closed := NewCache[string, int](ctx, 10, WithWriteThrough[string, int](store))
+	closed.Close()
+	if err := closed.SetE(`key`, 1); !errors.Is(err, ErrClosed) {
+		fail(t, `expected ErrClosed, got %v`, err)
+	}
+	closed.Set(`other`, 1)
+	if len(store.values) != 0 {
+		fail(t, `expected closed cache not written through, got %v`, store.values)
+	}
+}
+
+func Test_MarshalJSON(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Now()}
+	cache := NewCache[string, int](ctx, 10, WithClock(clock))
+	cache.Set(`forever`, 1)
+	cache.SetNX(`short`, 2, time.Second)
+	cache.SetNX(`long`, 3, time.Hour)
+	clock.Advance(2 * time.Second)
+
+	var decoded map[string]struct {
+		Value     *int       `json:"value"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		fail(t, `unexpected error: %v`, err)
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		fail(t, `unexpected error: %v`, err)
+	}
+	if len(decoded) != 2 {
+		fail(t, `expected expired entry skipped, got %s`, data)
+	}
+	if e := decoded[`forever`]; e.Value == nil || *e.Value != 1 || e.ExpiresAt != nil {
+		fail(t, `unexpected entry without expiration: %s`, data)
+	}
+	if e := decoded[`long`]; e.Value == nil || *e.Value != 3 || e.ExpiresAt == nil {
+		fail(t, `unexpected expiring entry: %s`, data)
+	}
+
+	redacted := NewCache[int, string](ctx, 10, WithJSONRedaction())
+	redacted.SetNX(1, `secret`, time.Hour)
+	data, err = json.Marshal(redacted)
+	if err != nil {
+		fail(t, `unexpected error: %v`, err)
+	}
+	if strings.Contains(string(data), `secret`) || !strings.Contains(string(data), `"1":{"expiresAt":`) {
+		fail(t, `expected redacted value, got %s`, data)
+	}
+}
+
+func Test_Clone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Now()}
+	cache := NewCache[string, []int](ctx, 10, WithClock(clock), WithPersistFile(filepath.Join(t.TempDir(), `cache`)),
+		WithValueCloner(func(value []int) []int { return append([]int(nil), value...) }))
+	cache.Set(`forever`, []int{1})
+	cache.SetNX(`short`, []int{2}, time.Second)
+	cache.SetNX(`pinned`, []int{3}, time.Second)
+	cache.Pin(`pinned`)
+
+	clone := cache.Clone(ctx)
+	defer clone.Close()
+	if clone.Len() != 3 {
+		fail(t, `expected 3 cloned entries, got %d`, clone.Len())
+	}
+	if clone.persistFile != `` {
+		fail(t, `expected persist file not shared`)
+	}
+
+	value, _ := clone.Get(`forever`)
+	value[0] = 10
+	if value, _ := cache.Get(`forever`); value[0] != 1 {
+		fail(t, `expected value deep-copied, got %v`, value)
+	}
+	clone.Remove(`forever`)
+	if !cache.Contains(`forever`) {
+		fail(t, `expected clone mutation not shared`)
+	}
+
+	if item := clone.Items()[`short`]; !item.ExpiresAt.Equal(cache.Items()[`short`].ExpiresAt) {
+		fail(t, `expected TTL state copied, got %v`, item.ExpiresAt)
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := clone.GetE(`short`); !errors.Is(err, ErrExpired) {
+		fail(t, `expected cloned entry expired, got %v`, err)
+	}
+	if !clone.Contains(`pinned`) {
+		fail(t, `expected pinned entry kept`)
+	}
+}
+
+func Test_ClockOfTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Now()}
+	cache := NewCache[string, int](ctx, 10, WithClock(clock))
+	cache.SetNX(`key`, 1, time.Hour)
+	item := cache.Items()[`key`]
+	clock.Advance(30 * time.Minute)
+	if ttl := item.TTL(); ttl != 30*time.Minute {
+		fail(t, `expected TTL measured by cache clock, got %s`, ttl)
+	}
+
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		fail(t, `unexpected store error: %v`, err)
+	}
+	layer := StoreLayer[string, int](store, WithClock(clock))
+	layer.Set(ctx, `key`, 1, time.Hour)
+	clock.Advance(15 * time.Minute)
+	if _, ttl, ok, _ := layer.Get(ctx, `key`); !ok || ttl != 45*time.Minute {
+		fail(t, `expected TTL measured by layer clock, got %s`, ttl)
+	}
+	clock.Advance(time.Hour)
+	if _, _, ok, _ := layer.Get(ctx, `key`); ok {
+		fail(t, `expected value expired by layer clock`)
+	}
+}
+
+func Test_ShutdownWithoutLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cache *Cache[int, int]
+	cache = NewCache[int, int](ctx, 10, WithEvictOnClose(), WithAsyncCallbacks(1, 1),
+		WithOnRemoval(func(key, value int, reason Reason) {
+			cache.Set(key, value)
+		}))
+	for key := 0; key < 5; key++ {
+		cache.Set(key, key)
+	}
+	closed := make(chan struct{})
+	go func() {
+		cache.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		fail(t, `expected callbacks calling cache do not deadlock close`)
+	}
+
+	expiring := NewCache[int, int](ctx, 10, WithManualTicks(), WithExpiredBuffer(1))
+	for key := 0; key < 3; key++ {
+		expiring.SetNX(key, key, time.Second)
+	}
+	expiring.Tick(2 * time.Second)
+	if len(expiring.Expired()) != 1 || expiring.ExpiredDropped() != 2 {
+		fail(t, `expected expired entries over buffer dropped, got %d`, expiring.ExpiredDropped())
+	}
+}
+
+func Test_ChainedCallbacks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls []string
+	cache := NewCache[string, int](ctx, 10,
+		WithOnSet(func(key string, _ int) { calls = append(calls, `first `+key) }),
+		WithOnSet[string, int](nil),
+		WithOnSet(func(key string, _ int) { calls = append(calls, `second `+key) }),
+		WithOnRemoval(func(key string, _ int, _ Reason) { calls = append(calls, `removal `+key) }),
+		WithOnRemoval(func(key string, _ int, reason Reason) { calls = append(calls, reason.String()+` `+key) }),
+	)
+
+	cache.Set(`key`, 1)
+	cache.Remove(`key`)
+	want := []string{`first key`, `second key`, `removal key`, Removed.String() + ` key`}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		fail(t, `expected callbacks called in order of options %v, got %v`, want, calls)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal(`expected panic on callback of other types`)
+		}
+	}()
+	NewCache[string, int](ctx, 10, WithOnSet(func(int, int) {}), WithOnSet(func(string, int) {}))
+}
+
+// fakeClock is clock advanced manually, its tickers never tick.
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(time.Duration) Ticker { return fakeTicker{} }
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type fakeTicker struct{}
+
+func (fakeTicker) C() <-chan time.Time { return nil }
+func (fakeTicker) Stop()               {}
+
+func Test_Clock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := NewCache[string, int](context.Background(), 10, WithClock(clock), WithoutJanitor())
+	cache.SetNX(`short`, 1, 10*time.Second)
+	cache.SetNX(`long`, 2, time.Hour)
+
+	clock.Advance(5 * time.Second)
+	if ttl, ok := cache.GetTTL(`short`); !ok || ttl != 5*time.Second {
+		fail(t, `unexpected TTL %v`, ttl)
+	}
+
+	clock.Advance(6 * time.Second)
+	if cache.Contains(`short`) || !cache.Contains(`long`) {
+		fail(t, `expected entry expired by clock`)
+	}
+	clock.Advance(time.Hour)
+	if _, ok := cache.Get(`long`); ok || cache.Len() != 0 {
+		fail(t, `expected all entries expired by clock`)
+	}
+}
+
+func Test_ManualTicks(t *testing.T) {
+	expired := 0
+	cache := NewCache[string, int](context.Background(), 10, WithManualTicks(),
+		WithOnExpire(func(key string, value int) { expired++ }))
+	cache.SetNX(`k1`, 1, 10*time.Second)
+	cache.SetNX(`k2`, 2, 30*time.Second)
+
+	cache.AdvanceEpoch(9)
+	if !cache.Contains(`k1`) || expired != 0 {
+		fail(t, `expected entry not expired before its deadline`)
+	}
+	cache.Tick(time.Second)
+	if cache.Contains(`k1`) || expired != 1 {
+		fail(t, `expected entry expired exactly at its deadline`)
+	}
+	if ttl, _ := cache.GetTTL(`k2`); ttl != 20*time.Second {
+		fail(t, `unexpected TTL %v`, ttl)
+	}
+	cache.Tick(time.Minute)
+	if cache.Len() != 0 || expired != 2 {
+		fail(t, `expected all entries expired`)
+	}
+
+	other := NewCache[string, int](context.Background(), 10, WithoutJanitor())
+	other.SetNX(`k1`, 1, time.Hour)
+	other.Tick(2 * time.Hour)
+	if !other.Contains(`k1`) {
+		fail(t, `expected tick ignored by cache not in manual mode`)
+	}
+}
+
+func Test_GracefulShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var evicted atomic.Int64
+	cache := NewCache[int, int](ctx, 10, WithEvictOnClose(), WithAsyncCallbacks(1, 100),
+		WithOnEvict(func(key, value int) {
+			time.Sleep(time.Millisecond)
+			evicted.Add(1)
+		}))
+	for key := 0; key < 20; key++ {
+		cache.Set(key, key)
+	}
+	cache.Close()
+	if n := evicted.Load(); n != 20 {
+		fail(t, `expected queued callbacks run before close returns, got %d`, n)
+	}
+	cancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	expiring := NewCache[int, int](ctx, 10, WithExpiredBuffer(10), WithTTLEpochGranularity(5*time.Millisecond))
+	expiring.SetNX(1, 1, 5*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+
+	var delivered []int
+	for entry := range expiring.Expired() {
+		delivered = append(delivered, entry.Key)
+	}
+	if len(delivered) != 1 || delivered[0] != 1 {
+		fail(t, `expected buffered entries delivered before channel is closed, got %v`, delivered)
+	}
+}
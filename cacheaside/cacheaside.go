@@ -0,0 +1,121 @@
+// Package cacheaside implements cache-aside pattern over cache: values are
+// read through cache on miss and invalidated in cache on write to backend.
+package cacheaside
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// Loader loads value by key from backend with its expiration time.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, time.Duration, error)
+
+// Writer writes value by key to backend.
+type Writer[K comparable, V any] func(ctx context.Context, key K, value V) error
+
+// errLoaded is returned by compute function of Get to report value set to
+// cache by Get itself.
+var errLoaded = errors.New("cacheaside: value loaded")
+
+// Aside is cache-aside wrapper of cache and backend.
+type Aside[K comparable, V any] struct {
+	cache *cache.Cache[K, V]
+	load  Loader[K, V]
+	write Writer[K, V]
+
+	// lock guards loads in progress by key, which are marked stale by
+	// writes of key.
+	lock    sync.Mutex
+	loading map[K]*inflight
+}
+
+// inflight is load of key in progress, stale is set if key is written or
+// invalidated during load.
+type inflight struct {
+	stale bool
+}
+
+// Wrap returns cache-aside wrapper of given cache, which loads missed values
+// by load and writes values by write.
+func Wrap[K comparable, V any](c *cache.Cache[K, V], load Loader[K, V], write Writer[K, V]) *Aside[K, V] {
+	return &Aside[K, V]{cache: c, load: load, write: write, loading: make(map[K]*inflight)}
+}
+
+// Get returns value by key from cache, missed value is loaded from backend
+// and set to cache. Concurrent callers of same missing key wait for single
+// load, see Cache.GetOrComputeCtx, so load is not cancelled by ctx of caller
+// which started it. Value loaded while key is written by Put or invalidated
+// may be stale, so it is returned, but not set to cache.
+func (a *Aside[K, V]) Get(ctx context.Context, key K) (V, error) {
+	value, err := a.cache.GetOrComputeCtx(ctx, key, func() (V, time.Duration, error) {
+		load := a.begin(key)
+		value, expiry, err := a.load(context.WithoutCancel(ctx), key)
+		if err != nil {
+			a.end(key, load, nil)
+			return value, expiry, err
+		}
+		a.end(key, load, func() { a.cache.SetNX(key, value, expiry) })
+		// NOTE: value is already set unless stale, so it is returned with
+		// errLoaded to keep GetOrComputeCtx from caching it.
+		return value, expiry, errLoaded
+	})
+	if errors.Is(err, errLoaded) {
+		err = nil
+	}
+	return value, err
+}
+
+// Put writes value by key to backend and invalidates it in cache, so next
+// Get loads written value. Cache is not modified if write fails.
+func (a *Aside[K, V]) Put(ctx context.Context, key K, value V) error {
+	if err := a.write(ctx, key, value); err != nil {
+		return err
+	}
+	a.Invalidate(key)
+	return nil
+}
+
+// Invalidate removes value by key from cache, e.g. when backend is modified
+// by other writer. Load of key in progress is not cached.
+func (a *Aside[K, V]) Invalidate(key K) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if load, ok := a.loading[key]; ok {
+		load.stale = true
+	}
+	a.cache.Remove(key)
+}
+
+// begin registers load of key.
+func (a *Aside[K, V]) begin(key K) *inflight {
+	load := &inflight{}
+	a.lock.Lock()
+	a.loading[key] = load
+	a.lock.Unlock()
+	return load
+}
+
+// end unregisters load of key and calls set unless load is stale. Set and
+// Invalidate are serialized, so loaded value is either not cached or
+// removed by Invalidate.
+func (a *Aside[K, V]) end(key K, load *inflight, set func()) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.loading[key] == load {
+		delete(a.loading, key)
+	}
+	if !load.stale && set != nil {
+		set()
+	}
+}
+
+// Cache returns wrapped cache.
+func (a *Aside[K, V]) Cache() *cache.Cache[K, V] {
+	return a.cache
+}
@@ -0,0 +1,148 @@
+package cacheaside
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+func Test_Aside(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := map[string]int{`key`: 1}
+	loads := 0
+	aside := Wrap(cache.NewCache[string, int](ctx, 10),
+		func(_ context.Context, key string) (int, time.Duration, error) {
+			loads++
+			value, ok := backend[key]
+			if !ok {
+				return 0, 0, errors.New(`not found`)
+			}
+			return value, time.Hour, nil
+		},
+		func(_ context.Context, key string, value int) error {
+			if key == `readonly` {
+				return errors.New(`read only`)
+			}
+			backend[key] = value
+			return nil
+		},
+	)
+
+	for i := 0; i < 2; i++ {
+		if value, err := aside.Get(ctx, `key`); err != nil || value != 1 {
+			t.Fatalf(`expected value read through cache, got %d, %v`, value, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf(`expected single load, got %d`, loads)
+	}
+
+	if err := aside.Put(ctx, `key`, 2); err != nil {
+		t.Fatalf(`unexpected write error: %v`, err)
+	}
+	if value, err := aside.Get(ctx, `key`); err != nil || value != 2 || loads != 2 {
+		t.Fatalf(`expected written value loaded after invalidation, got %d`, value)
+	}
+
+	if err := aside.Put(ctx, `readonly`, 1); err == nil {
+		t.Fatal(`expected write error`)
+	}
+	if _, err := aside.Get(ctx, `missing`); err == nil {
+		t.Fatal(`expected load error`)
+	}
+	if stats := aside.Cache().Stats(); stats.Hits == 0 || stats.Misses == 0 {
+		t.Fatalf(`expected stats of wrapped cache, got %+v`, stats)
+	}
+}
+
+func Test_AsidePutDuringLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lock sync.Mutex
+	backend := map[string]int{`key`: 1}
+	loading, resume := make(chan struct{}), make(chan struct{})
+	var aside *Aside[string, int]
+	aside = Wrap(cache.NewCache[string, int](ctx, 10),
+		func(_ context.Context, key string) (int, time.Duration, error) {
+			lock.Lock()
+			value := backend[key]
+			lock.Unlock()
+			if value == 1 {
+				close(loading)
+				<-resume
+			}
+			return value, time.Hour, nil
+		},
+		func(_ context.Context, key string, value int) error {
+			lock.Lock()
+			defer lock.Unlock()
+			backend[key] = value
+			return nil
+		},
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		aside.Get(ctx, `key`)
+	}()
+	<-loading
+	if err := aside.Put(ctx, `key`, 2); err != nil {
+		t.Fatalf(`unexpected write error: %v`, err)
+	}
+	close(resume)
+	<-done
+
+	if _, ok := aside.Cache().Peek(`key`); ok {
+		t.Fatalf(`expected stale load not set to cache`)
+	}
+	if value, err := aside.Get(ctx, `key`); err != nil || value != 2 {
+		t.Fatalf(`expected stale load not cached, got %d`, value)
+	}
+}
+
+func Test_AsideLoadCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loading, resume := make(chan struct{}), make(chan struct{})
+	aside := Wrap(cache.NewCache[string, int](ctx, 10),
+		func(ctx context.Context, _ string) (int, time.Duration, error) {
+			close(loading)
+			<-resume
+			return 1, time.Hour, ctx.Err()
+		},
+		func(context.Context, string, int) error { return nil },
+	)
+
+	first, cancelFirst := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		aside.Get(first, `key`)
+	}()
+	<-loading
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := aside.Get(ctx, `key`)
+		waited <- err
+	}()
+	cancelFirst()
+	close(resume)
+	<-done
+
+	if err := <-waited; err != nil {
+		t.Fatalf(`expected load not cancelled by first caller, got %v`, err)
+	}
+	if value, ok := aside.Cache().Peek(`key`); !ok || value != 1 {
+		t.Fatalf(`expected loaded value cached, got %d`, value)
+	}
+}
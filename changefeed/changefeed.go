@@ -0,0 +1,278 @@
+// Package changefeed exports mutations of cache to external sink, e.g.
+// Kafka topic, for downstream cache warming and analytics. Events are
+// buffered, written by batches in order of mutations and retried on
+// failure.
+package changefeed
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+	"github.com/moeryomenko/ttlcache/internal/backoff"
+)
+
+// Op is kind of mutation of entry.
+type Op string
+
+const (
+	// OpSet is insertion or update of entry.
+	OpSet Op = "set"
+	// OpExpire is expiration of entry by TTL.
+	OpExpire Op = "expire"
+	// OpEvict is eviction of entry by replacement policy.
+	OpEvict Op = "evict"
+	// OpRemove is explicit removal of entry.
+	OpRemove Op = "remove"
+	// OpClear is removal of entry by clearing of cache.
+	OpClear Op = "clear"
+)
+
+// Event is mutation of entry.
+type Event[K comparable, V any] struct {
+	Op    Op        `json:"op"`
+	Key   K         `json:"key"`
+	Value V         `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Sink writes batches of events, e.g. to message broker. Failed batch is
+// written again as whole, so sink should tolerate duplicates.
+type Sink[K comparable, V any] interface {
+	Write(ctx context.Context, events []Event[K, V]) error
+}
+
+// Option is an option that can be applied to exporter.
+type Option func(*config)
+
+type config struct {
+	batchSize  int
+	interval   time.Duration
+	bufferSize int
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	logger     *slog.Logger
+	clock      cache.Clock
+}
+
+const (
+	defaultBatchSize  = 100
+	defaultInterval   = time.Second
+	defaultBufferSize = 10000
+	defaultAttempts   = 3
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+// WithBatchSize sets maximal number of events written by single batch.
+func WithBatchSize(size int) Option {
+	return func(c *config) {
+		c.batchSize = size
+	}
+}
+
+// WithFlushInterval sets interval, after which buffered events are written
+// even if batch is not full.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.interval = interval
+	}
+}
+
+// WithBufferSize sets maximal number of buffered events, events exceeding
+// it are dropped, so slow sink does not block cache.
+func WithBufferSize(size int) Option {
+	return func(c *config) {
+		c.bufferSize = size
+	}
+}
+
+// WithRetry sets maximal number of attempts to write batch, retry is
+// delayed by backoff, which doubles after each attempt and is capped by max
+// backoff. Batch failed all attempts is dropped.
+func WithRetry(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(c *config) {
+		c.attempts, c.backoff, c.maxBackoff = attempts, max(backoff, 0), maxBackoff
+	}
+}
+
+// WithLogger sets logger of dropped events.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithClock sets source of time of events, it should be clock of cache set
+// by cache.WithClock.
+func WithClock(clock cache.Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// Exporter buffers mutations of cache and writes them to sink by single
+// writer, so events are written in order of mutations.
+type Exporter[K comparable, V any] struct {
+	sink Sink[K, V]
+	cfg  config
+
+	lock    sync.Mutex
+	buffer  []Event[K, V]
+	dropped uint64
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// New returns exporter of events to given sink, which writes events until
+// ctx is done or exporter is closed. Exporter is attached to cache by
+// options returned by Options.
+func New[K comparable, V any](ctx context.Context, sink Sink[K, V], opts ...Option) *Exporter[K, V] {
+	cfg := config{
+		batchSize:  defaultBatchSize,
+		interval:   defaultInterval,
+		bufferSize: defaultBufferSize,
+		attempts:   defaultAttempts,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.batchSize, cfg.attempts = max(cfg.batchSize, 1), max(cfg.attempts, 1)
+
+	e := &Exporter[K, V]{
+		sink:    sink,
+		cfg:     cfg,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.run(ctx)
+	return e
+}
+
+// Options returns options of cache, which report its mutations to exporter.
+// Callbacks set by cache.WithOnSet and cache.WithOnRemoval are kept, they
+// are called along with callbacks of exporter.
+func (e *Exporter[K, V]) Options() []cache.Option {
+	return []cache.Option{
+		cache.WithOnSet(func(key K, value V) { e.record(OpSet, key, value) }),
+		cache.WithOnRemoval(func(key K, value V, reason cache.Reason) {
+			switch reason {
+			case cache.Expired:
+				e.record(OpExpire, key, value)
+			case cache.Evicted:
+				e.record(OpEvict, key, value)
+			case cache.Removed:
+				e.record(OpRemove, key, value)
+			case cache.Cleared:
+				e.record(OpClear, key, value)
+			}
+		}),
+	}
+}
+
+// Dropped returns number of events dropped by overflow of buffer or by
+// failed writes.
+func (e *Exporter[K, V]) Dropped() uint64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.dropped
+}
+
+// Close writes buffered events and stops exporter.
+func (e *Exporter[K, V]) Close() {
+	e.once.Do(func() { close(e.done) })
+	<-e.stopped
+}
+
+func (e *Exporter[K, V]) record(op Op, key K, value V) {
+	e.lock.Lock()
+	if len(e.buffer) >= e.cfg.bufferSize {
+		e.dropped++
+		e.lock.Unlock()
+		return
+	}
+	e.buffer = append(e.buffer, Event[K, V]{Op: op, Key: key, Value: value, Time: e.now()})
+	full := len(e.buffer) >= e.cfg.batchSize
+	e.lock.Unlock()
+
+	if full {
+		select {
+		case e.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// now returns time of event by clock of cache.
+func (e *Exporter[K, V]) now() time.Time {
+	if e.cfg.clock == nil {
+		return time.Now()
+	}
+	return e.cfg.clock.Now()
+}
+
+func (e *Exporter[K, V]) run(ctx context.Context) {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.notify:
+		case <-e.done:
+			e.flush(context.WithoutCancel(ctx))
+			return
+		case <-ctx.Done():
+			return
+		}
+		e.flush(ctx)
+	}
+}
+
+// flush writes buffered events by batches.
+func (e *Exporter[K, V]) flush(ctx context.Context) {
+	for {
+		e.lock.Lock()
+		n := min(len(e.buffer), e.cfg.batchSize)
+		batch := make([]Event[K, V], n)
+		copy(batch, e.buffer)
+		e.buffer = append(e.buffer[:0], e.buffer[n:]...)
+		e.lock.Unlock()
+		if n == 0 {
+			return
+		}
+
+		if err := e.write(ctx, batch); err != nil {
+			e.lock.Lock()
+			e.dropped += uint64(len(batch))
+			e.lock.Unlock()
+			if e.cfg.logger != nil {
+				e.cfg.logger.LogAttrs(ctx, slog.LevelWarn, "changefeed: batch dropped",
+					slog.Int("events", len(batch)), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// write writes batch with retries.
+func (e *Exporter[K, V]) write(ctx context.Context, batch []Event[K, V]) error {
+	delay := e.cfg.backoff
+	for attempt := 1; ; attempt++ {
+		err := e.sink.Write(ctx, batch)
+		if err == nil || attempt >= e.cfg.attempts || !backoff.Wait(ctx, delay) {
+			return err
+		}
+		delay = min(2*delay, max(e.cfg.maxBackoff, e.cfg.backoff))
+	}
+}
@@ -0,0 +1,96 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// flakyProducer fails first write of each batch.
+type flakyProducer struct {
+	lock     sync.Mutex
+	failed   bool
+	messages []Message
+}
+
+func (p *flakyProducer) WriteMessages(_ context.Context, msgs ...Message) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.failed = !p.failed; p.failed {
+		return errors.New(`leader not available`)
+	}
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+// fixedClock is clock, which is stopped at given time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func (fixedClock) NewTicker(time.Duration) cache.Ticker { return nil }
+
+func Test_Exporter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	producer := &flakyProducer{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	exporter := New[string, int](ctx, NewKafkaSink[string, int](producer),
+		WithBatchSize(2), WithFlushInterval(time.Hour), WithRetry(2, time.Millisecond, time.Millisecond), WithClock(fixedClock(now)))
+	sets := 0
+	opts := append([]cache.Option{cache.WithOnSet(func(string, int) { sets++ })}, exporter.Options()...)
+	c := cache.NewCache[string, int](ctx, 1, opts...)
+
+	c.Set(`first`, 1)
+	c.Set(`second`, 2)
+	c.Remove(`second`)
+	exporter.Close()
+
+	want := []struct {
+		op  Op
+		key string
+	}{{OpSet, `first`}, {OpEvict, `first`}, {OpSet, `second`}, {OpRemove, `second`}}
+	if len(producer.messages) != len(want) {
+		t.Fatalf(`expected %d messages, got %d`, len(want), len(producer.messages))
+	}
+	for i, msg := range producer.messages {
+		var event Event[string, int]
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatalf(`unexpected decode error: %v`, err)
+		}
+		if event.Op != want[i].op || event.Key != want[i].key || string(msg.Key) != want[i].key {
+			t.Fatalf(`expected %s of %s at %d, got %s of %s`, want[i].op, want[i].key, i, event.Op, event.Key)
+		}
+		if !event.Time.Equal(now) {
+			t.Fatalf(`expected event stamped by clock, got %v`, event.Time)
+		}
+	}
+	if sets != 2 {
+		t.Fatalf(`expected callback of cache kept, got %d calls`, sets)
+	}
+	if exporter.Dropped() != 0 {
+		t.Fatalf(`expected failed writes retried, got %d dropped`, exporter.Dropped())
+	}
+
+	full := New[string, int](ctx, NewKafkaSink[string, int](producer), WithBufferSize(1), WithFlushInterval(time.Hour))
+	full.record(OpSet, `first`, 1)
+	full.record(OpSet, `second`, 2)
+	if full.Dropped() != 1 {
+		t.Fatalf(`expected event over buffer dropped, got %d`, full.Dropped())
+	}
+	full.Close()
+
+	// NOTE: negative backoff is clamped instead of panicking in jitter.
+	clamped := New[string, int](ctx, NewKafkaSink[string, int](producer), WithRetry(2, -time.Second, 0))
+	if err := clamped.write(ctx, []Event[string, int]{{Op: OpSet, Key: `first`}}); err != nil {
+		t.Fatalf(`expected failed write retried, got %v`, err)
+	}
+	clamped.Close()
+}
@@ -0,0 +1,54 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Message is message of Kafka topic.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Producer writes messages to Kafka topic, it must write whole batch or
+// fail, since failed batch is retried by exporter. *kafka.Writer of
+// github.com/segmentio/kafka-go satisfies it by adapter:
+//
+//	type producer struct{ w *kafka.Writer }
+//
+//	func (p producer) WriteMessages(ctx context.Context, msgs ...changefeed.Message) error {
+//		batch := make([]kafka.Message, len(msgs))
+//		for i, msg := range msgs {
+//			batch[i] = kafka.Message{Key: msg.Key, Value: msg.Value}
+//		}
+//		return p.w.WriteMessages(ctx, batch...)
+//	}
+type Producer interface {
+	WriteMessages(ctx context.Context, msgs ...Message) error
+}
+
+// kafkaSink writes events as JSON messages keyed by key of entry, so events
+// of the same key go to the same partition and keep their order.
+type kafkaSink[K comparable, V any] struct {
+	producer Producer
+}
+
+// NewKafkaSink returns sink, which writes each event as JSON message keyed
+// by string form of entry key produced by fmt.Sprint.
+func NewKafkaSink[K comparable, V any](producer Producer) Sink[K, V] {
+	return kafkaSink[K, V]{producer: producer}
+}
+
+func (s kafkaSink[K, V]) Write(ctx context.Context, events []Event[K, V]) error {
+	msgs := make([]Message, len(events))
+	for i, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("changefeed: encode event: %w", err)
+		}
+		msgs[i] = Message{Key: []byte(fmt.Sprint(event.Key)), Value: value}
+	}
+	return s.producer.WriteMessages(ctx, msgs...)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is source of time of cache, it allows to control expiration of
+// entries in tests, see WithClock.
+type Clock interface {
+	// Now returns current time.
+	Now() time.Time
+	// NewTicker returns ticker, which delivers ticks with given period.
+	NewTicker(period time.Duration) Ticker
+}
+
+// Ticker delivers ticks of Clock.
+type Ticker interface {
+	// C returns channel of ticks.
+	C() <-chan time.Time
+	// Stop stops ticker.
+	Stop()
+}
+
+// systemClock is Clock of system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(period time.Duration) Ticker {
+	return systemTicker{time.NewTicker(period)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// manualClock is clock advanced by Cache.Tick, its tickers never tick.
+type manualClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newManualClock(now time.Time) *manualClock {
+	return &manualClock{now: now}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *manualClock) NewTicker(time.Duration) Ticker { return stoppedTicker{} }
+
+func (c *manualClock) advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(max(d, 0))
+}
+
+// stoppedTicker never ticks.
+type stoppedTicker struct{}
+
+func (stoppedTicker) C() <-chan time.Time { return nil }
+func (stoppedTicker) Stop()               {}
@@ -0,0 +1,57 @@
+package cache
+
+import "context"
+
+// Clone returns new cache bound to ctx with configuration and entries of
+// cache, e.g. to fork cache for canary pipeline. Entries are copied under
+// single acquisition of cache lock with their remaining time to live and
+// pins, values are copied by cloner set by WithValueCloner. Clone has
+// current capacity and TTL epoch granularity of cache, its callbacks and
+// policies, but it does not share state outside of memory with cache: its
+// operation log, persist file, overflow store, invalidation bus and
+// backing store are not configured, and initial entries are not seeded.
+// Statistics and eviction policy state of clone start from scratch, and
+// callback set by WithOnSet is called for copied entries.
+func (c *Cache[K, V]) Clone(ctx context.Context) *Cache[K, V] {
+	c.acquire()
+	capacity, granularity := c.capacity, c.ttl.period()
+	entries := c.snapshot(c.keys())
+	c.release()
+
+	opts := append(c.options[:len(c.options):len(c.options)],
+		WithTTLEpochGranularity(granularity), withoutSharedState())
+	clone := NewCache[K, V](ctx, capacity, opts...)
+	if c.cloner != nil {
+		for i := range entries {
+			entries[i].Value = c.cloner(entries[i].Value)
+		}
+	}
+
+	clone.acquire()
+	defer clone.release()
+
+	now := clone.clock.Now()
+	for _, e := range entries {
+		if e.TTL > 0 {
+			clone.setWithDeadline(e.Key, e.Value, now.Add(e.TTL))
+		} else {
+			clone.set(e.Key, e.Value)
+		}
+		if e.Pinned {
+			clone.pin(e.Key)
+		}
+	}
+	return clone
+}
+
+// withoutSharedState resets options of clone, which make it share state
+// with original cache outside of memory.
+func withoutSharedState() Option {
+	return func(c *config) {
+		c.opLog, c.persistFile = nil, ""
+		c.overflow, c.asyncSpill = nil, false
+		c.bus = nil
+		c.backing, c.writeBehind = nil, nil
+		c.initialEntries = nil
+	}
+}
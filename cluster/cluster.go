@@ -0,0 +1,168 @@
+// Package cluster implements client of cluster of cache servers, which
+// shards keys across nodes by consistent hashing and replicates them.
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+	"github.com/moeryomenko/ttlcache/internal/ring"
+)
+
+// Node is cache server of cluster, e.g. remote server reached by NewNode of
+// module github.com/moeryomenko/ttlcache/grpc or cache in the same process
+// returned by CacheNode.
+type Node interface {
+	// Get returns value by key and its remaining time to live, zero TTL
+	// means that value does not expire. ok is false if key is missing.
+	Get(ctx context.Context, key string) (value []byte, ttl time.Duration, ok bool, err error)
+	// Set stores value by key, non-positive TTL means default expiration.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes value by key, missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Option is an option that can be applied to client.
+type Option func(*config)
+
+type config struct {
+	replication int
+	replicas    int
+}
+
+// WithReplication sets number of nodes holding each key, one by default.
+func WithReplication(n int) Option {
+	return func(c *config) {
+		c.replication = n
+	}
+}
+
+// WithReplicas sets number of virtual nodes of each node on hash ring.
+func WithReplicas(replicas int) Option {
+	return func(c *config) {
+		c.replicas = replicas
+	}
+}
+
+// Client shards keys across nodes of cluster. Each key is held by several
+// nodes following its owner on hash ring, reads fail over to next replica
+// if node fails or misses key. Keys are hashed and sent by their string
+// form produced by fmt.Sprint, values are sent in encoding/gob format.
+type Client[K comparable, V any] struct {
+	nodes       map[string]Node
+	ring        *ring.Ring
+	replication int
+}
+
+// New returns client of cluster of given nodes by their names.
+func New[K comparable, V any](nodes map[string]Node, opts ...Option) *Client[K, V] {
+	cfg := config{replication: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	r := ring.New(cfg.replicas)
+	for name := range nodes {
+		r.Add(name)
+	}
+	return &Client[K, V]{nodes: nodes, ring: r, replication: max(cfg.replication, 1)}
+}
+
+// Get returns value by key from first replica holding it. Error is returned
+// only if no replica holds key and some of them failed.
+func (c *Client[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var v V
+	name := fmt.Sprint(key)
+	var errs []error
+	for _, node := range c.replicas(name) {
+		data, _, ok, err := c.nodes[node].Get(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cluster: node %s: %w", node, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+			return v, false, fmt.Errorf("cluster: decode value: %w", err)
+		}
+		return v, true, nil
+	}
+	return v, false, errors.Join(errs...)
+}
+
+// Set writes value by key to all replicas with given time to live. Error is
+// returned only if all replicas failed, so value is available while single
+// replica holds it.
+func (c *Client[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return fmt.Errorf("cluster: encode value: %w", err)
+	}
+	name := fmt.Sprint(key)
+	replicas := c.replicas(name)
+	var errs []error
+	for _, node := range replicas {
+		if err := c.nodes[node].Set(ctx, name, buf.Bytes(), ttl); err != nil {
+			errs = append(errs, fmt.Errorf("cluster: node %s: %w", node, err))
+		}
+	}
+	if len(errs) < len(replicas) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// Delete removes value by key from all replicas. Error is returned if any
+// replica failed, since it may serve stale value.
+func (c *Client[K, V]) Delete(ctx context.Context, key K) error {
+	name := fmt.Sprint(key)
+	var errs []error
+	for _, node := range c.replicas(name) {
+		if err := c.nodes[node].Delete(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("cluster: node %s: %w", node, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client[K, V]) replicas(key string) []string {
+	return c.ring.GetN(key, c.replication)
+}
+
+// cacheNode is node backed by cache in the same process.
+type cacheNode struct {
+	cache *cache.Cache[string, []byte]
+}
+
+// CacheNode returns node backed by cache in the same process, e.g. to embed
+// node of cluster into application or to test cluster without network.
+func CacheNode(c *cache.Cache[string, []byte]) Node {
+	return cacheNode{cache: c}
+}
+
+func (n cacheNode) Get(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	value, expiresAt, ok := n.cache.GetWithExpiry(key)
+	if !ok || expiresAt.IsZero() {
+		return value, 0, ok, nil
+	}
+	return value, max(expiresAt.Sub(n.cache.Now()), time.Millisecond), true, nil
+}
+
+func (n cacheNode) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl > 0 {
+		n.cache.SetNX(key, value, ttl)
+	} else {
+		n.cache.Set(key, value)
+	}
+	return nil
+}
+
+func (n cacheNode) Delete(ctx context.Context, key string) error {
+	n.cache.Pop(key)
+	return nil
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// downNode is node, which is unavailable.
+type downNode struct {
+	Node
+	down bool
+}
+
+func (n *downNode) Get(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	if n.down {
+		return nil, 0, false, errors.New(`unavailable`)
+	}
+	return n.Node.Get(ctx, key)
+}
+
+func Test_Client(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	caches := map[string]*cache.Cache[string, []byte]{}
+	nodes := map[string]Node{}
+	for _, name := range []string{`a`, `b`, `c`} {
+		caches[name] = cache.NewCache[string, []byte](ctx, 100)
+		nodes[name] = &downNode{Node: CacheNode(caches[name])}
+	}
+	client := New[int, string](nodes, WithReplication(2))
+
+	for i := 0; i < 30; i++ {
+		if err := client.Set(ctx, i, strconv.Itoa(i), time.Hour); err != nil {
+			t.Fatalf(`unexpected set error: %v`, err)
+		}
+	}
+	total := 0
+	for name, c := range caches {
+		if c.Len() == 30 {
+			t.Fatalf(`expected keys sharded, node %s holds all keys`, name)
+		}
+		total += c.Len()
+	}
+	if total != 60 {
+		t.Fatalf(`expected each key held by 2 nodes, got %d entries`, total)
+	}
+
+	// NOTE: any single node can fail with replication of 2.
+	nodes[`a`].(*downNode).down = true
+	for i := 0; i < 30; i++ {
+		if value, ok, err := client.Get(ctx, i); !ok || err != nil || value != strconv.Itoa(i) {
+			t.Fatalf(`expected failover to replica, got %q, %v`, value, err)
+		}
+	}
+	nodes[`b`].(*downNode).down = true
+	failed := 0
+	for i := 0; i < 30; i++ {
+		if _, ok, err := client.Get(ctx, i); !ok && err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Fatal(`expected keys of failed nodes not available`)
+	}
+
+	if err := client.Delete(ctx, 0); err != nil {
+		t.Fatalf(`unexpected delete error: %v`, err)
+	}
+	for name, c := range caches {
+		if c.Contains(`0`) {
+			t.Fatalf(`expected key deleted from node %s`, name)
+		}
+	}
+}
@@ -1,10 +1,152 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
 
 type config struct {
 	policy      evictionPolicy
 	granularity time.Duration
+	clock       Clock
+	defaultTTL  time.Duration
+	sliding     bool
+	jitter      float64
+	maxTTL      time.Duration
+	// onEvict is func(key K, value V), typed by NewCache.
+	onEvict any
+	// onExpire is func(key K, value V), typed by NewCache.
+	onExpire any
+	// onRemoval is func(key K, value V, reason Reason), typed by NewCache.
+	onRemoval any
+	// onSet is func(key K, value V), typed by NewCache.
+	onSet any
+	// onRemove is func(key K, value V), typed by NewCache.
+	onRemove any
+	// onReject is func(key K, value V), typed by NewCache.
+	onReject any
+	// admission is func(key K, value V) bool, typed by NewCache.
+	admission       any
+	admissionFilter Admission
+	metrics         MetricsListener
+	logger          *slog.Logger
+	// sizer is func(key K, value V) int64, typed by NewCache.
+	sizer any
+	// customPolicy is PolicyFactory[K], typed by NewCache.
+	customPolicy any
+	// loader is func(ctx context.Context, key K) (V, time.Duration, error),
+	// typed by NewCache.
+	loader any
+	// bulkLoader is func(ctx context.Context, keys []K) (map[K]V, error),
+	// typed by NewCache.
+	bulkLoader  any
+	loaderRetry retryPolicy
+	// backing is BackingStore[K, V], typed by NewCache, it is written
+	// behind if writeBehind is set.
+	backing     any
+	writeBehind *writeBehindPolicy
+	// negativeTTL is expiration time of loader failures accepted by
+	// cacheable.
+	negativeTTL time.Duration
+	cacheable   func(err error) bool
+	// cloner is func(value V) V, typed by NewCache.
+	cloner any
+	// initialEntries is map[K]SeedEntry[V], typed by NewCache.
+	initialEntries any
+	// weigher is func(key K, value V) int64, typed by NewCache.
+	weigher   any
+	maxWeight int64
+	maxBytes  int64
+	// maxEntrySize is limit of single entry size, measured by weigher if
+	// configured, otherwise by sizer.
+	maxEntrySize int64
+	// highWatermark and lowWatermark are shares of capacity and max weight.
+	highWatermark float64
+	lowWatermark  float64
+	// overshoot is share of capacity and max weight evicted additionally.
+	overshoot float64
+	// evictionBatch is number of entries over capacity evicted at once.
+	evictionBatch int
+
+	disabled   bool
+	locking    LockingMode
+	readMostly bool
+	noJanitor  bool
+	// manualTicks replaces clock by clock advanced by Cache.Tick.
+	manualTicks bool
+
+	evictOnClose bool
+	redactJSON   bool
+	opLog        io.Writer
+	persistFile  string
+	overflow     OverflowStore
+	asyncSpill   bool
+	bus          Bus
+
+	expiredBuffer   int
+	callbackWorkers int
+	callbackQueue   int
+}
+
+// retryPolicy is maximal number of attempts of loaders, first retry is
+// delayed by backoff, which doubles up to maxBackoff.
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// writeBehindPolicy is interval and size of batches flushed to backing
+// store and maximal number of attempts of each mutation.
+type writeBehindPolicy struct {
+	interval  time.Duration
+	batchSize int
+	attempts  int
 }
 
 const defaultEpochGranularity = 1 * time.Second
+
+// defaultFlushInterval is flush interval of write-behind mode, if it is
+// not set.
+const defaultFlushInterval = 1 * time.Second
+
+// expireBatchSize is number of expired entries removed by janitor under
+// single acquisition of cache lock.
+const expireBatchSize = 256
+
+// snapshotChunkSize is number of entries copied by Cache.Snapshot under
+// single acquisition of cache lock.
+const snapshotChunkSize = 1024
+
+// maxLogRecordSize is maximal size of record of operation log, larger
+// records are not written, since replay treats their size as corruption.
+const maxLogRecordSize = 64 << 20
+
+// minNegativeLimit is minimal number of cached loader failures, limit is
+// capacity of cache if it is larger.
+const minNegativeLimit = 1024
+
+// spillQueueSize is number of keys, which writes to overflow store are
+// queued by WithEvictionSpill, evictions block while queue is full.
+const spillQueueSize = 1024
+
+// invalidationQueueSize is number of invalidations queued for publishing
+// by WithInvalidationBus, cache operations block while queue is full.
+const invalidationQueueSize = 1024
+
+// janitorStallEpochs is number of TTL epochs without janitor run, after
+// which janitor is reported stalled by Cache.Healthy.
+const janitorStallEpochs = 3
+
+// bulkThresholdDivisor defines share of capacity expired or evicted
+// during single epoch, which is logged as bulk operation.
+const bulkThresholdDivisor = 10
+
+func logWarn(logger *slog.Logger, msg string, attrs ...slog.Attr) {
+	if logger == nil {
+		return
+	}
+	logger.LogAttrs(context.Background(), slog.LevelWarn, msg, attrs...)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// dispatcher is bounded pool of workers running callbacks.
+type dispatcher struct {
+	// lock guards closing of tasks against dispatch.
+	lock    sync.RWMutex
+	closed  bool
+	tasks   chan func()
+	workers sync.WaitGroup
+	// dropped is number of callbacks dropped by full queue.
+	dropped atomic.Uint64
+}
+
+func newDispatcher(workers, queueSize int) *dispatcher {
+	d := &dispatcher{
+		tasks: make(chan func(), max(queueSize, 0)),
+	}
+
+	d.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+
+	return d
+}
+
+// dispatch queues callback to workers, callback is dropped if queue is
+// full, since it is called under cache lock and must not wait for
+// callbacks, which may call cache.
+func (d *dispatcher) dispatch(fn func()) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	if d.closed {
+		// NOTE: workers are stopped, run callback in place.
+		fn()
+		return
+	}
+	select {
+	case d.tasks <- fn:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// close stops workers after they run all queued callbacks and waits for
+// them, callbacks dispatched after close run in place.
+func (d *dispatcher) close() {
+	d.lock.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.tasks)
+	}
+	d.lock.Unlock()
+
+	d.workers.Wait()
+}
+
+func (d *dispatcher) work() {
+	defer d.workers.Done()
+
+	for fn := range d.tasks {
+		fn()
+	}
+}
@@ -0,0 +1,31 @@
+package cache
+
+import "errors"
+
+// Errors returned by error-returning variants of cache operations, e.g.
+// GetE and SetE.
+var (
+	// ErrNotFound is returned when key is not present in cache.
+	ErrNotFound = errors.New("cache: key not found")
+	// ErrExpired is returned when expiration time of entry has passed,
+	// but entry is not yet removed by janitor.
+	ErrExpired = errors.New("cache: key expired")
+	// ErrCapacityExceeded is returned when entry is not stored, since it
+	// is refused by admission or exceeds limits of cache.
+	ErrCapacityExceeded = errors.New("cache: capacity exceeded")
+	// ErrClosed is returned when cache is closed.
+	ErrClosed = errors.New("cache: cache is closed")
+)
+
+var (
+	errComputePanicked = errors.New("cache: compute function panicked")
+
+	errLogCorrupted      = errors.New("cache: operation log is corrupted")
+	errLogRecordTooLarge = errors.New("cache: operation log record is too large")
+
+	errJanitorStopped   = errors.New("cache: janitor is stopped")
+	errJanitorStalled   = errors.New("cache: janitor is stalled")
+	errTTLIndexOverflow = errors.New("cache: TTL index has more keys than cache entries")
+	errIndexMismatch    = errors.New("cache: index does not match cache entries")
+	errNegativeWeight   = errors.New("cache: total weight is negative")
+)
@@ -0,0 +1,436 @@
+// Package gossip implements invalidation bus of cache, which spreads
+// messages between peers by epidemic gossip over UDP, so small clusters
+// keep near-caches coherent without central message broker, see
+// cache.WithInvalidationBus.
+package gossip
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+const (
+	defaultFanout      = 3
+	defaultHops        = 4
+	defaultInterval    = time.Second
+	defaultPeerTimeout = 30 * time.Second
+	// headerSize is size of kind, message ID and number of remaining hops.
+	headerSize = 10
+	// maxPacketSize is maximal size of UDP datagram.
+	maxPacketSize = 65507
+	// seenTTL is time, during which duplicates of message are ignored.
+	seenTTL  = time.Minute
+	seenSize = 1 << 16
+	// recentSize is number of recent messages listed by digest, which are
+	// sent again to peers missed them.
+	recentSize = 1024
+)
+
+// kinds of packets.
+const (
+	// kindMessage is published message: ID, hops and payload.
+	kindMessage byte = iota
+	// kindJoin announces sender as peer.
+	kindJoin
+	// kindDigest lists IDs of recent messages of sender.
+	kindDigest
+	// kindRequest lists IDs of messages missed by sender.
+	kindRequest
+)
+
+var errTooLarge = errors.New("gossip: message exceeds datagram size")
+
+// Option is an option that can be applied to bus.
+type Option func(*Bus)
+
+// WithFanout sets number of random peers, which each message is sent to by
+// publisher and forwarded to by each peer receiving it first time.
+func WithFanout(n int) Option {
+	return func(b *Bus) {
+		b.fanout = n
+	}
+}
+
+// WithHops sets number of times message is forwarded, it should be about
+// logarithm of cluster size by fanout.
+func WithHops(n int) Option {
+	return func(b *Bus) {
+		b.hops = n
+	}
+}
+
+// WithSecret sets secret shared by peers. Packets are authenticated by
+// HMAC-SHA256 of secret, packets failed authentication are dropped and
+// senders of authenticated packets are accepted as peers. Without secret
+// only peers added by Join are accepted.
+func WithSecret(secret []byte) Option {
+	return func(b *Bus) {
+		b.secret = secret
+	}
+}
+
+// WithInterval sets interval of digest of recent messages, which is sent
+// to all peers, so they request messages missed by gossip. Digest also
+// keeps peer alive, see WithPeerTimeout.
+func WithInterval(interval time.Duration) Option {
+	return func(b *Bus) {
+		b.interval = interval
+	}
+}
+
+// WithPeerTimeout sets time, after which peer silent since then is
+// removed. Peers added by Join are never removed.
+func WithPeerTimeout(timeout time.Duration) Option {
+	return func(b *Bus) {
+		b.peerTimeout = timeout
+	}
+}
+
+// Bus is gossip bus of peers. Peers are added by Join and learned from
+// authenticated packets, see WithSecret. Delivery is best effort: messages
+// are not acknowledged, but peers exchange digests of recent messages and
+// request missed ones, so invalidation is missed by peer only if it is
+// unreachable longer than about minute, e.g. during network partition, and
+// entries should have bounded TTL.
+type Bus struct {
+	conn        net.PacketConn
+	fanout      int
+	hops        int
+	secret      []byte
+	interval    time.Duration
+	peerTimeout time.Duration
+	seen        *cache.Cache[uint64, struct{}]
+	// recent is recent messages by their IDs, listed by digest.
+	recent *cache.Cache[uint64, []byte]
+
+	lock     sync.RWMutex
+	peers    map[string]*peer
+	next     int
+	handlers map[int]func(msg []byte)
+
+	done chan struct{}
+	once sync.Once
+}
+
+// peer is member of bus.
+type peer struct {
+	addr net.Addr
+	// seed reports whether peer is added by Join.
+	seed bool
+	// lastSeen is time of last packet received from peer.
+	lastSeen time.Time
+}
+
+// New returns bus over given connection, e.g. opened by net.ListenPacket
+// with network "udp". Bus receives messages until ctx is done or bus is
+// closed.
+func New(ctx context.Context, conn net.PacketConn, opts ...Option) *Bus {
+	b := &Bus{
+		conn:        conn,
+		fanout:      defaultFanout,
+		hops:        defaultHops,
+		interval:    defaultInterval,
+		peerTimeout: defaultPeerTimeout,
+		seen:        cache.NewCache[uint64, struct{}](ctx, seenSize),
+		recent:      cache.NewCache[uint64, []byte](ctx, recentSize),
+		peers:       make(map[string]*peer),
+		handlers:    make(map[int]func(msg []byte)),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.fanout, b.hops = max(b.fanout, 1), max(b.hops, 0)
+	if b.interval <= 0 {
+		b.interval = defaultInterval
+	}
+
+	context.AfterFunc(ctx, func() { b.Close() })
+	go b.receive()
+	go b.gossip()
+	return b
+}
+
+// Join adds peers by their UDP addresses and announces bus to them. Peers
+// accept bus if they are configured with the same secret or joined it.
+// Peers, which addresses are not resolved, are skipped and their errors are
+// returned joined with errors of announcements.
+func (b *Bus) Join(addrs ...string) error {
+	var errs []error
+	for _, addr := range addrs {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if key := udpAddr.String(); key != b.conn.LocalAddr().String() {
+			b.lock.Lock()
+			b.peers[key] = &peer{addr: udpAddr, seed: true, lastSeen: time.Now()}
+			b.lock.Unlock()
+		}
+		if _, err := b.conn.WriteTo(b.seal([]byte{kindJoin}), udpAddr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops bus and closes its connection.
+func (b *Bus) Close() error {
+	var err error
+	b.once.Do(func() {
+		close(b.done)
+		b.seen.Close()
+		b.recent.Close()
+		err = b.conn.Close()
+	})
+	return err
+}
+
+// Publish sends message to random peers, which forward it further.
+func (b *Bus) Publish(msg []byte) error {
+	if headerSize+len(msg)+b.macSize() > maxPacketSize {
+		return errTooLarge
+	}
+	body := make([]byte, headerSize+len(msg))
+	body[0] = kindMessage
+	id := rand.Uint64()
+	binary.BigEndian.PutUint64(body[1:], id)
+	body[9] = byte(min(b.hops, 255))
+	copy(body[headerSize:], msg)
+
+	b.seen.SetNX(id, struct{}{}, seenTTL)
+	b.recent.SetNX(id, body, seenTTL)
+	return b.send(b.seal(body), nil)
+}
+
+// Subscribe registers handler of messages published by peers.
+func (b *Bus) Subscribe(handler func(msg []byte)) (func(), error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		delete(b.handlers, id)
+	}, nil
+}
+
+func (b *Bus) receive() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := b.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		body, ok := b.open(buf[:n])
+		if !ok || len(body) == 0 || !b.accept(from) {
+			continue
+		}
+
+		body = append([]byte(nil), body...)
+		switch body[0] {
+		case kindMessage:
+			b.handle(body, from)
+		case kindDigest:
+			b.handleDigest(body[1:], from)
+		case kindRequest:
+			b.handleRequest(body[1:], from)
+		}
+	}
+}
+
+// handle delivers message received first time and forwards it further.
+func (b *Bus) handle(body []byte, from net.Addr) {
+	if len(body) < headerSize {
+		return
+	}
+	id := binary.BigEndian.Uint64(body[1:])
+	if _, seen := b.seen.GetOrSet(id, struct{}{}, seenTTL); seen {
+		return
+	}
+	b.recent.SetNX(id, append([]byte(nil), body...), seenTTL)
+	b.deliver(body[headerSize:])
+	if hops := body[9]; hops > 0 {
+		body[9] = hops - 1
+		b.send(b.seal(body), from)
+	}
+}
+
+// handleDigest requests messages listed by digest of peer, which are not
+// seen yet.
+func (b *Bus) handleDigest(ids []byte, from net.Addr) {
+	request := []byte{kindRequest}
+	for ; len(ids) >= 8; ids = ids[8:] {
+		if !b.seen.Contains(binary.BigEndian.Uint64(ids)) {
+			request = append(request, ids[:8]...)
+		}
+	}
+	if len(request) > 1 {
+		b.conn.WriteTo(b.seal(request), from)
+	}
+}
+
+// handleRequest sends again messages requested by peer, they are not
+// forwarded further.
+func (b *Bus) handleRequest(ids []byte, from net.Addr) {
+	for ; len(ids) >= 8; ids = ids[8:] {
+		body, ok := b.recent.Peek(binary.BigEndian.Uint64(ids))
+		if !ok {
+			continue
+		}
+		body = append([]byte(nil), body...)
+		body[9] = 0
+		b.conn.WriteTo(b.seal(body), from)
+	}
+}
+
+// gossip periodically sends digest of recent messages to peers and removes
+// silent peers.
+func (b *Bus) gossip() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.done:
+			return
+		}
+		b.expire(time.Now())
+
+		digest := []byte{kindDigest}
+		for _, id := range b.recent.Keys() {
+			digest = binary.BigEndian.AppendUint64(digest, id)
+		}
+		packet := b.seal(digest)
+		for _, addr := range b.addrs() {
+			b.conn.WriteTo(packet, addr)
+		}
+	}
+}
+
+func (b *Bus) deliver(msg []byte) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+}
+
+// send sends packet to random peers except given one.
+func (b *Bus) send(packet []byte, except net.Addr) error {
+	b.lock.RLock()
+	peers := make([]net.Addr, 0, len(b.peers))
+	for key, peer := range b.peers {
+		if except == nil || key != except.String() {
+			peers = append(peers, peer.addr)
+		}
+	}
+	b.lock.RUnlock()
+
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	var errs []error
+	for _, peer := range peers[:min(b.fanout, len(peers))] {
+		if _, err := b.conn.WriteTo(packet, peer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addrs returns addresses of all peers.
+func (b *Bus) addrs() []net.Addr {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	addrs := make([]net.Addr, 0, len(b.peers))
+	for _, peer := range b.peers {
+		addrs = append(addrs, peer.addr)
+	}
+	return addrs
+}
+
+// accept reports whether packet of given sender is accepted: sender is
+// known peer or, if packets are authenticated, it is added as peer.
+func (b *Bus) accept(addr net.Addr) bool {
+	key := addr.String()
+	if key == b.conn.LocalAddr().String() {
+		return false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if p, ok := b.peers[key]; ok {
+		p.lastSeen = time.Now()
+		return true
+	}
+	if b.secret == nil {
+		return false
+	}
+	b.peers[key] = &peer{addr: addr, lastSeen: time.Now()}
+	return true
+}
+
+// expire removes peers silent longer than peer timeout, except ones added
+// by Join.
+func (b *Bus) expire(now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for key, p := range b.peers {
+		if !p.seed && now.Sub(p.lastSeen) > b.peerTimeout {
+			delete(b.peers, key)
+		}
+	}
+}
+
+func (b *Bus) macSize() int {
+	if b.secret == nil {
+		return 0
+	}
+	return sha256.Size
+}
+
+// seal returns packet of given body, which is signed if bus has secret.
+func (b *Bus) seal(body []byte) []byte {
+	if b.secret == nil {
+		return body
+	}
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write(body)
+	return mac.Sum(append([]byte(nil), body...))
+}
+
+// open returns body of given packet, ok is false if packet failed
+// authentication.
+func (b *Bus) open(packet []byte) (body []byte, ok bool) {
+	if b.secret == nil {
+		return packet, true
+	}
+	if len(packet) < sha256.Size {
+		return nil, false
+	}
+	body, sum := packet[:len(packet)-sha256.Size], packet[len(packet)-sha256.Size:]
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write(body)
+	return body, hmac.Equal(sum, mac.Sum(nil))
+}
@@ -0,0 +1,157 @@
+package gossip
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+func Test_Bus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	buses := make([]*Bus, 4)
+	caches := make([]*cache.Cache[string, int], len(buses))
+	for i := range buses {
+		conn, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+		if err != nil {
+			t.Fatalf(`unexpected listen error: %v`, err)
+		}
+		buses[i] = New(ctx, conn, WithFanout(3), WithHops(2), WithSecret([]byte(`secret`)))
+		caches[i] = cache.NewCache[string, int](ctx, 10, cache.WithInvalidationBus(buses[i]))
+		caches[i].GetOrCompute(`key`, func() (int, time.Duration, error) { return 1, time.Minute, nil })
+	}
+	// NOTE: first peer learns others from their authenticated joins.
+	for _, bus := range buses[1:] {
+		if err := bus.Join(buses[0].conn.LocalAddr().String()); err != nil {
+			t.Fatalf(`unexpected join error: %v`, err)
+		}
+		bus.Publish([]byte(`hello`))
+	}
+
+	var deliveries atomic.Int32
+	buses[2].Subscribe(func(msg []byte) {
+		if string(msg) != `hello` {
+			deliveries.Add(1)
+		}
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	caches[1].Remove(`key`)
+	deadline := time.Now().Add(2 * time.Second)
+	for i, c := range caches {
+		if i == 1 {
+			continue
+		}
+		for c.Contains(`key`) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if c.Contains(`key`) {
+			t.Fatal(`expected key invalidated on all peers`)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := deliveries.Load(); n != 1 {
+		t.Fatalf(`expected duplicates of gossip ignored, got %d deliveries`, n)
+	}
+}
+
+// listen returns bus listening on loopback address.
+func listen(t *testing.T, ctx context.Context, opts ...Option) *Bus {
+	t.Helper()
+
+	conn, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatalf(`unexpected listen error: %v`, err)
+	}
+	return New(ctx, conn, opts...)
+}
+
+// peersOf returns number of peers of bus.
+func peersOf(b *Bus) int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return len(b.peers)
+}
+
+func Test_Membership(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seed := listen(t, ctx)
+	stranger := listen(t, ctx)
+	var deliveries atomic.Int32
+	seed.Subscribe(func([]byte) { deliveries.Add(1) })
+
+	// NOTE: without secret only peers added by Join are accepted.
+	stranger.Join(seed.conn.LocalAddr().String())
+	stranger.Publish([]byte(`spoofed`))
+	time.Sleep(50 * time.Millisecond)
+	if peersOf(seed) != 0 || deliveries.Load() != 0 {
+		t.Fatalf(`expected unknown sender rejected, got %d peers`, peersOf(seed))
+	}
+
+	secure := listen(t, ctx, WithSecret([]byte(`secret`)), WithInterval(10*time.Millisecond), WithPeerTimeout(50*time.Millisecond))
+	forged := listen(t, ctx, WithSecret([]byte(`other`)))
+	forged.Join(secure.conn.LocalAddr().String())
+	time.Sleep(50 * time.Millisecond)
+	if peersOf(secure) != 0 {
+		t.Fatal(`expected peer failed authentication rejected`)
+	}
+
+	member := listen(t, ctx, WithSecret([]byte(`secret`)))
+	member.Join(secure.conn.LocalAddr().String())
+	deadline := time.Now().Add(time.Second)
+	for peersOf(secure) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if peersOf(secure) != 1 {
+		t.Fatal(`expected authenticated peer joined`)
+	}
+
+	member.Close()
+	deadline = time.Now().Add(time.Second)
+	for peersOf(secure) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if peersOf(secure) != 0 {
+		t.Fatal(`expected silent peer expired`)
+	}
+}
+
+func Test_AntiEntropy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := listen(t, ctx, WithInterval(10*time.Millisecond))
+	second := listen(t, ctx, WithInterval(10*time.Millisecond))
+	received := make(chan string, 2)
+	second.Subscribe(func(msg []byte) { received <- string(msg) })
+
+	// NOTE: message published without peers is missed by second peer
+	// until digest of first peer is exchanged.
+	first.Publish([]byte(`missed`))
+	// NOTE: unresolved address does not stop join of other peers.
+	if err := first.Join(`127.0.0.1:invalid`, second.conn.LocalAddr().String()); err == nil {
+		t.Fatal(`expected resolve error of invalid address`)
+	}
+	second.Join(first.conn.LocalAddr().String())
+
+	select {
+	case msg := <-received:
+		if msg != `missed` {
+			t.Fatalf(`expected missed message, got %q`, msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`expected missed message requested by digest`)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(received) != 0 {
+		t.Fatal(`expected message delivered once`)
+	}
+}
@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/moeryomenko/ttlcache/cluster"
+	"google.golang.org/grpc"
+)
+
+// node is node of cluster reached by client of cache service.
+type node struct {
+	client CacheClient
+}
+
+// NewNode returns node of cluster served by remote cache server on given
+// connection, e.g. created by grpc.NewClient.
+func NewNode(cc grpc.ClientConnInterface) cluster.Node {
+	return node{client: NewCacheClient(cc)}
+}
+
+func (n node) Get(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	resp, err := n.client.Get(ctx, &GetRequest{Key: key})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return resp.GetValue(), time.Duration(resp.GetTtlMs()) * time.Millisecond, resp.GetFound(), nil
+}
+
+func (n node) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	req := &SetRequest{Key: key, Value: value}
+	if ttl > 0 {
+		// NOTE: zero TTL means default expiration of server.
+		req.TtlMs = max(ttl.Milliseconds(), 1)
+	}
+	_, err := n.client.Set(ctx, req)
+	return err
+}
+
+func (n node) Delete(ctx context.Context, key string) error {
+	_, err := n.client.Delete(ctx, &DeleteRequest{Key: key})
+	return err
+}
@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+	"github.com/moeryomenko/ttlcache/cluster"
+	"google.golang.org/grpc"
+)
+
+func Test_Node(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	caches := map[string]*cache.Cache[string, []byte]{}
+	servers := map[string]*grpc.Server{}
+	nodes := map[string]cluster.Node{}
+	for _, name := range []string{`a`, `b`, `c`} {
+		caches[name] = cache.NewCache[string, []byte](ctx, 100)
+		srv, conn := serve(t, NewServer(caches[name]))
+		servers[name], nodes[name] = srv, NewNode(conn)
+	}
+	client := cluster.New[int, string](nodes, cluster.WithReplication(2))
+
+	for i := 0; i < 30; i++ {
+		if err := client.Set(ctx, i, strconv.Itoa(i), time.Hour); err != nil {
+			t.Fatalf(`unexpected set error: %v`, err)
+		}
+	}
+	total := 0
+	for name, c := range caches {
+		if c.Len() == 30 {
+			t.Fatalf(`expected keys sharded, node %s holds all keys`, name)
+		}
+		if ttl, ok := c.GetTTL(c.Keys()[0]); !ok || ttl <= 0 || ttl > time.Hour {
+			t.Fatalf(`expected TTL replicated to node %s, got %v`, name, ttl)
+		}
+		total += c.Len()
+	}
+	if total != 60 {
+		t.Fatalf(`expected each key held by 2 nodes, got %d entries`, total)
+	}
+
+	// NOTE: any single node can fail with replication of 2.
+	servers[`a`].Stop()
+	for i := 0; i < 30; i++ {
+		if value, ok, err := client.Get(ctx, i); !ok || err != nil || value != strconv.Itoa(i) {
+			t.Fatalf(`expected failover to replica, got %q, %v`, value, err)
+		}
+	}
+	servers[`b`].Stop()
+	failed := 0
+	for i := 0; i < 30; i++ {
+		if _, ok, err := client.Get(ctx, i); !ok && err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Fatal(`expected keys of failed nodes not available`)
+	}
+
+	if err := client.Delete(ctx, 0); err == nil {
+		t.Fatal(`expected delete error of failed nodes`)
+	}
+	if caches[`c`].Contains(`0`) {
+		t.Fatal(`expected key deleted from available node`)
+	}
+}
@@ -0,0 +1,84 @@
+// Package grpc implements service defined by cache.proto, so cache runs as
+// standalone caching sidecar. Package is separate module, so root module
+// stays free of dependencies on google.golang.org/grpc.
+//
+// Code in cache.pb.go and cache_grpc.pb.go is generated by protoc-gen-go and
+// protoc-gen-go-grpc, regenerate it after changes of cache.proto:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//		--go-grpc_out=. --go-grpc_opt=paths=source_relative cache.proto
+//
+// Server is registered on gRPC server by RegisterCacheServer:
+//
+//	srv := grpc.NewServer()
+//	cachegrpc.RegisterCacheServer(srv, cachegrpc.NewServer(c))
+package grpc
+
+import (
+	"context"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// Server is server of cache service backed by cache.
+type Server struct {
+	UnimplementedCacheServer
+
+	cache *cache.Cache[string, []byte]
+}
+
+var _ CacheServer = (*Server)(nil)
+
+// NewServer returns server of given cache. Default expiration of values
+// set without TTL is configured by cache.WithDefaultTTL.
+func NewServer(c *cache.Cache[string, []byte]) *Server {
+	return &Server{cache: c}
+}
+
+// Get returns value by key with its remaining time to live.
+func (s *Server) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	value, expiresAt, ok := s.cache.GetWithExpiry(req.Key)
+	if !ok {
+		return &GetResponse{}, nil
+	}
+	resp := &GetResponse{Value: value, Found: true}
+	if !expiresAt.IsZero() {
+		resp.TtlMs = max(expiresAt.Sub(s.cache.Now()).Milliseconds(), 1)
+	}
+	return resp, nil
+}
+
+// Set sets value by key with given time to live.
+func (s *Server) Set(ctx context.Context, req *SetRequest) (*SetResponse, error) {
+	if req.TtlMs > 0 {
+		s.cache.SetNX(req.Key, req.Value, time.Duration(req.TtlMs)*time.Millisecond)
+	} else {
+		s.cache.Set(req.Key, req.Value)
+	}
+	return &SetResponse{}, nil
+}
+
+// Delete removes value by key.
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	_, ok := s.cache.Pop(req.Key)
+	return &DeleteResponse{Deleted: ok}, nil
+}
+
+// GetMany returns values by keys.
+func (s *Server) GetMany(ctx context.Context, req *GetManyRequest) (*GetManyResponse, error) {
+	return &GetManyResponse{Values: s.cache.GetMany(req.Keys)}, nil
+}
+
+// Stats returns statistics of cache.
+func (s *Server) Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error) {
+	stats := s.cache.Stats()
+	return &StatsResponse{
+		Hits:        stats.Hits,
+		Misses:      stats.Misses,
+		Sets:        stats.Sets,
+		Evictions:   stats.Evictions,
+		Expirations: stats.Expirations,
+		Len:         int64(stats.Len),
+	}, nil
+}
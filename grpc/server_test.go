@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// serve serves given server over in-memory listener and returns connection
+// to it.
+func serve(t *testing.T, server CacheServer) (*grpc.Server, *grpc.ClientConn) {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterCacheServer(srv, server)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(`passthrough:///bufnet`,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf(`unexpected dial error: %v`, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, conn
+}
+
+func Test_Server(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, conn := serve(t, NewServer(cache.NewCache[string, []byte](ctx, 10)))
+	server := NewCacheClient(conn)
+
+	if _, err := server.Set(ctx, &SetRequest{Key: `key`, Value: []byte(`value`), TtlMs: time.Hour.Milliseconds()}); err != nil {
+		t.Fatalf(`unexpected set error: %v`, err)
+	}
+	if _, err := server.Set(ctx, &SetRequest{Key: `persistent`, Value: []byte(`value`)}); err != nil {
+		t.Fatalf(`unexpected set error: %v`, err)
+	}
+
+	resp, err := server.Get(ctx, &GetRequest{Key: `key`})
+	if err != nil || !resp.Found || string(resp.Value) != `value` {
+		t.Fatalf(`expected value, got %+v, %v`, resp, err)
+	}
+	if resp.TtlMs <= 0 || resp.TtlMs > time.Hour.Milliseconds() {
+		t.Fatalf(`expected remaining TTL, got %d`, resp.TtlMs)
+	}
+	if resp, _ := server.Get(ctx, &GetRequest{Key: `persistent`}); resp.TtlMs != 0 {
+		t.Fatalf(`expected zero TTL of persistent value, got %d`, resp.TtlMs)
+	}
+	if resp, _ := server.Get(ctx, &GetRequest{Key: `missing`}); resp.Found {
+		t.Fatal(`expected missing value`)
+	}
+
+	many, _ := server.GetMany(ctx, &GetManyRequest{Keys: []string{`key`, `missing`}})
+	if len(many.Values) != 1 || string(many.Values[`key`]) != `value` {
+		t.Fatalf(`expected single found value, got %v`, many.Values)
+	}
+
+	if resp, _ := server.Delete(ctx, &DeleteRequest{Key: `key`}); !resp.Deleted {
+		t.Fatal(`expected value deleted`)
+	}
+	if resp, _ := server.Delete(ctx, &DeleteRequest{Key: `key`}); resp.Deleted {
+		t.Fatal(`expected missing value not deleted`)
+	}
+
+	stats, _ := server.Stats(ctx, &StatsRequest{})
+	if stats.Sets != 2 || stats.Len != 1 {
+		t.Fatalf(`unexpected stats: %+v`, stats)
+	}
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"hash/maphash"
+	"maps"
+	"sync"
+	"sync/atomic"
+
+	"github.com/moeryomenko/ttlcache/internal/policies"
+)
+
+// indexShards is number of shards of entry index, must be power of two.
+const indexShards = 64
+
+// index is sharded map of all entries, which allows lookups without cache
+// lock. Index is modified only under cache lock, so it always mirrors
+// content of policy and pinned entries.
+//
+// In copy-on-write mode index is immutable map instead, modifications are
+// made to its copy, which replaces it atomically by publish, so lookups
+// take no lock at all.
+type index[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards [indexShards]indexShard[K, V]
+
+	cow      bool
+	snapshot atomic.Pointer[map[K]*entry[V]]
+	// next is copy of snapshot modified under cache lock until publish.
+	next map[K]*entry[V]
+}
+
+type indexShard[K comparable, V any] struct {
+	lock  sync.RWMutex
+	items map[K]*entry[V]
+}
+
+func newIndex[K comparable, V any](seed maphash.Seed, cow bool) *index[K, V] {
+	idx := &index[K, V]{seed: seed, cow: cow}
+	if cow {
+		idx.snapshot.Store(&map[K]*entry[V]{})
+		return idx
+	}
+	for i := range idx.shards {
+		idx.shards[i].items = make(map[K]*entry[V])
+	}
+	return idx
+}
+
+func (idx *index[K, V]) load(key K) (*entry[V], bool) {
+	return idx.loadHashed(idx.hash(key), key)
+}
+
+// loadHashed looks up key by its precomputed hash, see hash.
+func (idx *index[K, V]) loadHashed(hash uint64, key K) (*entry[V], bool) {
+	if idx.cow {
+		item, ok := (*idx.snapshot.Load())[key]
+		return item, ok
+	}
+	shard := &idx.shards[hash&(indexShards-1)]
+	shard.lock.RLock()
+	item, ok := shard.items[key]
+	shard.lock.RUnlock()
+	return item, ok
+}
+
+func (idx *index[K, V]) store(key K, item *entry[V]) {
+	if idx.cow {
+		idx.modify()[key] = item
+		return
+	}
+	shard := idx.shard(key)
+	shard.lock.Lock()
+	shard.items[key] = item
+	shard.lock.Unlock()
+}
+
+func (idx *index[K, V]) delete(key K) {
+	if idx.cow {
+		delete(idx.modify(), key)
+		return
+	}
+	shard := idx.shard(key)
+	shard.lock.Lock()
+	delete(shard.items, key)
+	shard.lock.Unlock()
+}
+
+func (idx *index[K, V]) clear() {
+	if idx.cow {
+		idx.next = make(map[K]*entry[V])
+		return
+	}
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.lock.Lock()
+		clear(shard.items)
+		shard.lock.Unlock()
+	}
+}
+
+// len returns number of indexed entries. Must be called under cache lock.
+func (idx *index[K, V]) len() int {
+	if idx.cow {
+		if idx.next != nil {
+			return len(idx.next)
+		}
+		return len(*idx.snapshot.Load())
+	}
+	n := 0
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.lock.RLock()
+		n += len(shard.items)
+		shard.lock.RUnlock()
+	}
+	return n
+}
+
+// keys returns keys of indexed entries, each shard is locked only while
+// its keys are copied, so keys are not consistent across shards.
+func (idx *index[K, V]) keys() []K {
+	if idx.cow {
+		snapshot := *idx.snapshot.Load()
+		keys := make([]K, 0, len(snapshot))
+		for key := range snapshot {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	var keys []K
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.lock.RLock()
+		for key := range shard.items {
+			keys = append(keys, key)
+		}
+		shard.lock.RUnlock()
+	}
+	return keys
+}
+
+// modify returns copy of snapshot, which is modified until publish.
+func (idx *index[K, V]) modify() map[K]*entry[V] {
+	if idx.next == nil {
+		idx.next = maps.Clone(*idx.snapshot.Load())
+	}
+	return idx.next
+}
+
+// publish replaces snapshot by its modified copy. Must be called under
+// cache lock.
+func (idx *index[K, V]) publish() {
+	if idx.next == nil {
+		return
+	}
+	next := idx.next
+	idx.next = nil
+	idx.snapshot.Store(&next)
+}
+
+func (idx *index[K, V]) hash(key K) uint64 {
+	return policies.HashKey(idx.seed, key)
+}
+
+func (idx *index[K, V]) shard(key K) *indexShard[K, V] {
+	return &idx.shards[idx.hash(key)&(indexShards-1)]
+}
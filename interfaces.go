@@ -2,24 +2,88 @@ package cache
 
 import "github.com/moeryomenko/ttlcache/internal/policies"
 
-// replacementCacher is internal common interface of cache.
-type replacementCacher[K comparable, V any] interface {
+// Policy is common interface of replacement policy, which stores cache
+// entries and evicts them over capacity. Policy must report each eviction,
+// including evictions made by Set, to callback given to its factory.
+// Policy is always called under cache lock, Peek, Keys and Len may be
+// called concurrently under shared lock in RWMutexLock mode.
+type Policy[K comparable, V any] interface {
 	// Set inserts or updates the specified key-value pair.
 	Set(key K, value V)
 	// Get returns the value for specified key if it is present in the cache.
 	Get(key K) (V, bool)
+	// Peek returns the value for specified key without updating replacement
+	// policy state.
+	Peek(key K) (V, bool)
 	// Remove removes item from cache by given key.
 	Remove(key K)
 	// Evict evicts given numbers of key from cache by given policy.
 	Evict(count int)
+	// Keys returns keys of all items in cache.
+	Keys() []K
 	// Len returns current size of cache.
 	Len() int
 }
 
+// Resizer is optionally implemented by Policy, which supports change of
+// capacity by Cache.Resize.
+type Resizer interface {
+	// Resize changes capacity and evicts items over new capacity.
+	Resize(capacity int)
+}
+
+// Admission is filter, which decides whether new key is inserted to full
+// cache in place of eviction victim. Keys are passed as hashes. Admission
+// is always called under cache lock.
+type Admission interface {
+	// Record records access of key.
+	Record(key uint64)
+	// Admit reports whether candidate key is more valuable than victim key.
+	Admit(candidate, victim uint64) bool
+}
+
+// victimer is implemented by policies, which can tell next eviction victim.
+type victimer[K comparable] interface {
+	// Victim returns key, which is evicted next.
+	Victim() (K, bool)
+}
+
+// MetricsListener receives cache events for telemetry. Methods are called
+// under cache lock, so they must be fast and must not call cache methods.
+type MetricsListener interface {
+	// RecordHit records lookup of present key.
+	RecordHit()
+	// RecordMiss records lookup of missing key.
+	RecordMiss()
+	// RecordEviction records entry eviction by replacement policy.
+	RecordEviction()
+	// RecordExpiration records entry expiration by TTL.
+	RecordExpiration()
+	// RecordSet records entry insertion or update.
+	RecordSet()
+}
+
 // dummy test for policies.
 var (
-	_ replacementCacher[int, any] = (*policies.LRUCache[int, any])(nil)
-	_ replacementCacher[int, any] = (*policies.LFUCache[int, any])(nil)
-	_ replacementCacher[int, any] = (*policies.ARCCache[int, any])(nil)
-	_ replacementCacher[int, any] = (policies.NoEvictionCache[int, any])(nil)
+	_ Policy[int, any] = (*policies.LRUCache[int, any])(nil)
+	_ Policy[int, any] = (*policies.LFUCache[int, any])(nil)
+	_ Policy[int, any] = (*policies.ARCCache[int, any])(nil)
+	_ Policy[int, any] = (*policies.TinyLFUCache[int, any])(nil)
+	_ Policy[int, any] = (*policies.HyperbolicCache[int, any])(nil)
+	_ Policy[int, any] = (policies.NoEvictionCache[int, any])(nil)
+
+	_ Resizer = (*policies.LRUCache[int, any])(nil)
+	_ Resizer = (*policies.LFUCache[int, any])(nil)
+	_ Resizer = (*policies.ARCCache[int, any])(nil)
+	_ Resizer = (*policies.TinyLFUCache[int, any])(nil)
+	_ Resizer = (*policies.HyperbolicCache[int, any])(nil)
+	_ Resizer = (policies.NoEvictionCache[int, any])(nil)
+
+	_ victimer[int] = (*policies.LRUCache[int, any])(nil)
+	_ victimer[int] = (*policies.LFUCache[int, any])(nil)
+	_ victimer[int] = (*policies.ARCCache[int, any])(nil)
+	_ victimer[int] = (*policies.TinyLFUCache[int, any])(nil)
+	_ victimer[int] = (*policies.HyperbolicCache[int, any])(nil)
+
+	_ Admission = (*policies.TinyLFUAdmission)(nil)
 )
@@ -0,0 +1,28 @@
+// Package backoff implements delays of retries.
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Jitter returns delay randomized in [d/2, d], so retries of concurrent
+// callers are spread.
+func Jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Wait waits for delay of given backoff randomized by Jitter. Returns false
+// if ctx is done before.
+func Wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(Jitter(d))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
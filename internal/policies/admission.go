@@ -0,0 +1,82 @@
+package policies
+
+import "math/bits"
+
+// doorkeeperHashes is number of bits set for each key in doorkeeper.
+const doorkeeperHashes = 3
+
+// TinyLFUAdmission is admission filter, which admits candidate only if its
+// estimated frequency is higher than frequency of eviction victim. First
+// access of key is recorded only by doorkeeper bloom filter, so one-hit
+// keys do not pollute frequency sketch.
+// See: https://arxiv.org/abs/1512.00727.
+type TinyLFUAdmission struct {
+	doorkeeper []uint64
+	mask       uint64
+	sketch     *countMinSketch
+	additions  int
+	sampleSize int
+}
+
+// NewTinyLFUAdmission returns TinyLFU admission filter for cache of given capacity.
+func NewTinyLFUAdmission(capacity int) *TinyLFUAdmission {
+	// NOTE: doorkeeper has about 16 bits per cached item, sketch is twice
+	// wider than capacity, so scans of unique keys do not saturate it.
+	width := uint64(1) << bits.Len64(uint64(max(capacity, 8)*16-1))
+	return &TinyLFUAdmission{
+		doorkeeper: make([]uint64, width/64),
+		mask:       width - 1,
+		sketch:     newCountMinSketch(2 * capacity),
+		sampleSize: 10 * max(capacity, 1),
+	}
+}
+
+// Record records access of hashed key.
+func (a *TinyLFUAdmission) Record(hash uint64) {
+	if a.contains(hash) {
+		a.sketch.Increment(hash)
+	} else {
+		a.add(hash)
+	}
+
+	a.additions++
+	if a.additions >= a.sampleSize {
+		clear(a.doorkeeper)
+		a.additions = 0
+	}
+}
+
+// Admit reports whether hashed candidate key is accessed more frequently
+// than hashed victim key.
+func (a *TinyLFUAdmission) Admit(candidate, victim uint64) bool {
+	return a.estimate(candidate) > a.estimate(victim)
+}
+
+func (a *TinyLFUAdmission) estimate(hash uint64) int {
+	estimate := int(a.sketch.Estimate(hash))
+	if a.contains(hash) {
+		estimate++
+	}
+	return estimate
+}
+
+func (a *TinyLFUAdmission) contains(hash uint64) bool {
+	for i := 0; i < doorkeeperHashes; i++ {
+		bit := a.bit(hash, i)
+		if a.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *TinyLFUAdmission) add(hash uint64) {
+	for i := 0; i < doorkeeperHashes; i++ {
+		bit := a.bit(hash, i)
+		a.doorkeeper[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (a *TinyLFUAdmission) bit(hash uint64, i int) uint64 {
+	return mix(hash+uint64(i)*0x9e3779b97f4a7c15) & a.mask
+}
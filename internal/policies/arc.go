@@ -3,89 +3,109 @@ package policies
 // ARCCache is improved LRU cache, that tracks both recency and frequency of use.
 // See: https://ieeexplore.ieee.org/document/1297303.
 type ARCCache[K comparable, V any] struct {
-	// t1 is lru for recently accessed items.
+	// t1 is lru for items accessed once recently.
 	t1 *LRUCache[K, V]
-	// b1 is lru for eviction from t1.
-	b1 *LRUCache[K, V]
-	// t2 is lru for frequently accessed times.
+	// b1 is ghost lru, holds only keys evicted from t1.
+	b1 *LRUCache[K, struct{}]
+	// t2 is lru for items accessed at least twice recently.
 	t2 *LRUCache[K, V]
-	// b2 is lru for evicted from t2.
-	b2 *LRUCache[K, V]
+	// b2 is ghost lru, holds only keys evicted from t2.
+	b2 *LRUCache[K, struct{}]
 
 	capacity int
-	prefer   int
+	// target is adaptive target size of t1.
+	target  int
+	onEvict func(key K, value V)
 }
 
-func NewARCCache[K comparable, V any](capacity int) *ARCCache [K, V]{
+// NewARCCache returns ARC cache, onEvict is called for each evicted item and may be nil.
+func NewARCCache[K comparable, V any](capacity int, onEvict func(key K, value V)) *ARCCache[K, V] {
 	return &ARCCache[K, V]{
 		capacity: capacity,
-		t1:       NewLRUCache[K, V](capacity),
-		b1:       NewLRUCache[K, V](capacity),
-		t2:       NewLRUCache[K, V](capacity),
-		b2:       NewLRUCache[K, V](capacity),
+		onEvict:  onEvict,
+		t1:       NewLRUCache[K, V](capacity, nil),
+		b1:       NewLRUCache[K, struct{}](capacity, nil),
+		t2:       NewLRUCache[K, V](capacity, nil),
+		b2:       NewLRUCache[K, struct{}](capacity, nil),
 	}
 }
 
 func (c *ARCCache[K, V]) Set(key K, value V) {
-	if contains(c.t1, key) {
+	// Case I: cache hit, item becomes frequent.
+	if _, ok := c.t1.items[key]; ok {
 		c.t1.Remove(key)
 		c.t2.Set(key, value)
 		return
 	}
 
-	if contains(c.t2, key) {
+	if _, ok := c.t2.items[key]; ok {
 		c.t2.Set(key, value)
 		return
 	}
 
-	if contains(c.b1, key) {
-		delta := 1
-		b1Len := c.b1.Len()
-		b2Len := c.b2.Len()
-
-		if b2Len > b1Len {
-			delta = b2Len / b1Len
-		}
-
-		if c.prefer+delta >= c.capacity {
-			c.prefer = c.capacity
-		} else {
-			c.prefer += delta
-		}
-
-		if c.t1.Len()+c.t2.Len() >= c.capacity {
-			c.replcae(true)
+	// Case II: ghost hit in b1, recency list deserves more space.
+	if _, ok := c.b1.items[key]; ok {
+		c.target = min(c.capacity, c.target+max(c.b2.Len()/c.b1.Len(), 1))
+		c.b1.Remove(key)
+		if c.Len() >= c.capacity {
+			c.replace(false)
 		}
-
-		c.b2.Remove(key)
-
 		c.t2.Set(key, value)
 		return
 	}
 
-	if c.t1.Len()+c.t2.Len() >= c.capacity {
-		c.replcae(false)
-	}
-
-	if c.b1.Len() > c.capacity-c.prefer {
-		removeOldest(c.b1)
+	// Case III: ghost hit in b2, frequency list deserves more space.
+	if _, ok := c.b2.items[key]; ok {
+		c.target = max(0, c.target-max(c.b1.Len()/c.b2.Len(), 1))
+		c.b2.Remove(key)
+		if c.Len() >= c.capacity {
+			c.replace(true)
+		}
+		c.t2.Set(key, value)
+		return
 	}
 
-	if c.b2.Len() > c.prefer {
-		removeOldest(c.b2)
+	// Case IV: complete miss.
+	if c.t1.Len()+c.b1.Len() >= c.capacity {
+		if c.t1.Len() < c.capacity {
+			c.b1.Evict(1)
+			if c.Len() >= c.capacity {
+				c.replace(false)
+			}
+		} else {
+			k, v, _ := removeOldest(c.t1)
+			c.evicted(k, v)
+		}
+	} else if c.Len() >= c.capacity {
+		if c.Len()+c.b1.Len()+c.b2.Len() >= 2*c.capacity {
+			c.b2.Evict(1)
+		}
+		c.replace(false)
 	}
 
 	c.t1.Set(key, value)
 }
 
+// Get returns the value for specified key, hit in t1 moves item to t2.
 func (c *ARCCache[K, V]) Get(key K) (V, bool) {
-	if val, ok := c.t1.Get(key); ok {
+	if val, ok := c.t1.Peek(key); ok {
+		c.t1.Remove(key)
+		c.t2.Set(key, val)
 		return val, ok
 	}
 
 	return c.t2.Get(key)
 }
 
+// Peek returns the value for specified key without moving it between lists.
+func (c *ARCCache[K, V]) Peek(key K) (V, bool) {
+	if val, ok := c.t1.Peek(key); ok {
+		return val, ok
+	}
+
+	return c.t2.Peek(key)
+}
+
 func (c *ARCCache[K, V]) Remove(key K) {
 	c.t1.Remove(key)
 	c.t2.Remove(key)
@@ -94,41 +114,76 @@ func (c *ARCCache[K, V]) Remove(key K) {
 }
 
 func (c *ARCCache[K, V]) Evict(count int) {
-	c.t1.Evict(count)
-	c.t2.Evict(count)
+	for i := 0; i < count && c.Len() > 0; i++ {
+		c.replace(false)
+	}
+}
+
+func (c *ARCCache[K, V]) Keys() []K {
+	return append(c.t1.Keys(), c.t2.Keys()...)
 }
 
 func (c *ARCCache[K, V]) Len() int {
 	return c.t1.Len() + c.t2.Len()
 }
 
-func (c *ARCCache[K, V]) replcae(direction bool) {
-	var v V
+// Victim returns key, which is evicted next by replace.
+func (c *ARCCache[K, V]) Victim() (K, bool) {
 	t1Len := c.t1.Len()
-	if t1Len > 0 && (t1Len > c.prefer || (t1Len == c.prefer && direction)) {
-		k, ok := removeOldest(c.t1)
-		if ok {
-			c.b1.Set(k, v)
-		}
-	} else {
-		k, ok := removeOldest(c.t2)
-		if ok {
-			c.b2.Set(k, v)
+	if t1Len > 0 && (t1Len > c.target || c.t2.Len() == 0) {
+		return c.t1.Victim()
+	}
+	return c.t2.Victim()
+}
+
+// Resize changes capacity, evicts items over it and trims ghost lists.
+func (c *ARCCache[K, V]) Resize(capacity int) {
+	c.capacity = capacity
+	c.target = min(c.target, capacity)
+	c.t1.capacity, c.t2.capacity = capacity, capacity
+	for c.Len() > capacity {
+		c.replace(false)
+	}
+	c.b1.Resize(max(capacity-c.t1.Len(), 0))
+	c.b2.Resize(max(2*capacity-c.Len()-c.b1.Len(), 0))
+	c.b1.capacity, c.b2.capacity = capacity, capacity
+}
+
+// replace evicts least recently used item either from t1 or t2 depending on target
+// and remembers its key in corresponding ghost list, inB2 reports whether
+// item being inserted was found in b2.
+func (c *ARCCache[K, V]) replace(inB2 bool) {
+	t1Len := c.t1.Len()
+	if t1Len > 0 && (t1Len > c.target || (t1Len == c.target && inB2) || c.t2.Len() == 0) {
+		if k, v, ok := removeOldest(c.t1); ok {
+			c.b1.Set(k, struct{}{})
+			c.evicted(k, v)
 		}
+		return
+	}
+
+	if k, v, ok := removeOldest(c.t2); ok {
+		c.b2.Set(k, struct{}{})
+		c.evicted(k, v)
 	}
 }
 
-func removeOldest[K comparable, V any](cache *LRUCache[K, V]) (K, bool) {
+func (c *ARCCache[K, V]) evicted(key K, value V) {
+	if c.onEvict != nil {
+		c.onEvict(key, value)
+	}
+}
+
+func removeOldest[K comparable, V any](cache *LRUCache[K, V]) (K, V, bool) {
 	ent := cache.evictList.Back()
 	if ent != nil {
 		cache.removeElement(ent)
-		return ent.Value.(*lruItem[K, V]).key, true
+		item := ent.Value.(*lruItem[K, V])
+		return item.key, item.value, true
 	}
-	var k K
-	return k, false
-}
-
-func contains[K comparable, V any](cache *LRUCache[K, V], key K) bool {
-	_, ok := cache.Get(key)
-	return ok
+	var (
+		k K
+		v V
+	)
+	return k, v, false
 }
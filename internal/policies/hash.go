@@ -0,0 +1,36 @@
+package policies
+
+import "hash/maphash"
+
+// HashKey returns hash of comparable key, fast path covers string and
+// integer keys, other keys are hashed by hashComparable.
+func HashKey[K comparable](seed maphash.Seed, key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return maphash.String(seed, k)
+	case int:
+		return mix(uint64(k))
+	case int64:
+		return mix(uint64(k))
+	case int32:
+		return mix(uint64(k))
+	case uint:
+		return mix(uint64(k))
+	case uint64:
+		return mix(k)
+	case uint32:
+		return mix(uint64(k))
+	default:
+		return hashComparable(seed, key)
+	}
+}
+
+// mix is finalizer of splitmix64, spreads bits of integer key.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,14 @@
+//go:build !go1.24
+
+package policies
+
+import (
+	"fmt"
+	"hash/maphash"
+)
+
+// hashComparable hashes key by its default formatting, it allocates, since
+// hashing of arbitrary comparable value requires go1.24.
+func hashComparable[K comparable](seed maphash.Seed, key K) uint64 {
+	return maphash.String(seed, fmt.Sprint(key))
+}
@@ -0,0 +1,11 @@
+//go:build go1.24
+
+package policies
+
+import "hash/maphash"
+
+// hashComparable hashes key by its memory representation without
+// allocation.
+func hashComparable[K comparable](seed maphash.Seed, key K) uint64 {
+	return maphash.Comparable(seed, key)
+}
@@ -0,0 +1,161 @@
+package policies
+
+import "math/rand"
+
+// hyperbolicSamples is number of items sampled to choose eviction victim.
+const hyperbolicSamples = 64
+
+// HyperbolicCache evicts item with the lowest priority, which is number of
+// accesses divided by item age, victim is chosen from random sample of items.
+// See: https://www.usenix.org/conference/atc17/technical-sessions/presentation/blankstein.
+type HyperbolicCache[K comparable, V any] struct {
+	items map[K]*hyperbolicItem[K, V]
+	// slots holds items in random order for sampling.
+	slots    []*hyperbolicItem[K, V]
+	capacity int
+	// clock is logical time, incremented by each access.
+	clock   uint64
+	onEvict func(key K, value V)
+}
+
+type hyperbolicItem[K comparable, V any] struct {
+	key        K
+	value      V
+	count      uint64
+	insertedAt uint64
+	slot       int
+}
+
+// NewHyperbolicCache returns hyperbolic cache, onEvict is called for each evicted item and may be nil.
+func NewHyperbolicCache[K comparable, V any](capacity int, onEvict func(key K, value V)) *HyperbolicCache[K, V] {
+	return &HyperbolicCache[K, V]{
+		items:    make(map[K]*hyperbolicItem[K, V], capacity),
+		slots:    make([]*hyperbolicItem[K, V], 0, capacity),
+		capacity: capacity,
+		onEvict:  onEvict,
+	}
+}
+
+func (c *HyperbolicCache[K, V]) Set(key K, value V) {
+	c.clock++
+	if item, ok := c.items[key]; ok {
+		item.value = value
+		item.count++
+		return
+	}
+
+	if len(c.items) >= c.capacity {
+		c.Evict(1)
+	}
+
+	item := &hyperbolicItem[K, V]{
+		key:        key,
+		value:      value,
+		count:      1,
+		insertedAt: c.clock,
+		slot:       len(c.slots),
+	}
+	c.items[key] = item
+	c.slots = append(c.slots, item)
+}
+
+func (c *HyperbolicCache[K, V]) Get(key K) (V, bool) {
+	c.clock++
+	item, ok := c.items[key]
+	if !ok {
+		var v V
+		return v, false
+	}
+
+	item.count++
+	return item.value, true
+}
+
+// Peek returns the value for specified key without updating access count.
+func (c *HyperbolicCache[K, V]) Peek(key K) (V, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		var v V
+		return v, false
+	}
+	return item.value, true
+}
+
+func (c *HyperbolicCache[K, V]) Remove(key K) {
+	if item, ok := c.items[key]; ok {
+		c.removeItem(item)
+	}
+}
+
+func (c *HyperbolicCache[K, V]) Evict(count int) {
+	for i := 0; i < count && len(c.slots) > 0; i++ {
+		victim := c.victim()
+		c.removeItem(victim)
+		if c.onEvict != nil {
+			c.onEvict(victim.key, victim.value)
+		}
+	}
+}
+
+func (c *HyperbolicCache[K, V]) Keys() []K {
+	keys := make([]K, 0, len(c.slots))
+	for _, item := range c.slots {
+		keys = append(keys, item.key)
+	}
+	return keys
+}
+
+func (c *HyperbolicCache[K, V]) Len() int {
+	return len(c.items)
+}
+
+// sample returns i-th candidate for eviction, small caches are scanned entirely.
+func (c *HyperbolicCache[K, V]) sample(i int) *hyperbolicItem[K, V] {
+	if len(c.slots) <= hyperbolicSamples {
+		return c.slots[i]
+	}
+	return c.slots[rand.Intn(len(c.slots))]
+}
+
+// Victim returns key with the lowest priority among sampled items.
+func (c *HyperbolicCache[K, V]) Victim() (K, bool) {
+	if len(c.slots) == 0 {
+		var k K
+		return k, false
+	}
+	return c.victim().key, true
+}
+
+// victim returns item with the lowest priority among sampled items.
+func (c *HyperbolicCache[K, V]) victim() *hyperbolicItem[K, V] {
+	victim := c.sample(0)
+	for j := 1; j < min(hyperbolicSamples, len(c.slots)); j++ {
+		if candidate := c.sample(j); c.lessPriority(candidate, victim) {
+			victim = candidate
+		}
+	}
+	return victim
+}
+
+// Resize changes capacity and evicts items with the lowest priority over it.
+func (c *HyperbolicCache[K, V]) Resize(capacity int) {
+	c.capacity = capacity
+	if over := len(c.items) - capacity; over > 0 {
+		c.Evict(over)
+	}
+}
+
+// lessPriority reports whether priority count/age of item a is less than of item b.
+func (c *HyperbolicCache[K, V]) lessPriority(a, b *hyperbolicItem[K, V]) bool {
+	ageA := float64(c.clock - a.insertedAt + 1)
+	ageB := float64(c.clock - b.insertedAt + 1)
+	return float64(a.count)/ageA < float64(b.count)/ageB
+}
+
+func (c *HyperbolicCache[K, V]) removeItem(item *hyperbolicItem[K, V]) {
+	last := c.slots[len(c.slots)-1]
+	c.slots[item.slot] = last
+	last.slot = item.slot
+	c.slots = c.slots[:len(c.slots)-1]
+	delete(c.items, item.key)
+}
@@ -8,6 +8,7 @@ type LFUCache[K comparable, V any] struct {
 	items    map[K]*lfuItem[K, V]
 	freqList *list.List
 	capacity int
+	onEvict  func(key K, value V)
 }
 
 type lfuItem[K comparable, V any] struct {
@@ -21,11 +22,13 @@ type freqEntry[K comparable, V any] struct {
 	items map[*lfuItem[K, V]]struct{}
 }
 
-func NewLFUCache[K comparable, V any](capacity int) *LFUCache[K, V] {
+// NewLFUCache returns LFU cache, onEvict is called for each evicted item and may be nil.
+func NewLFUCache[K comparable, V any](capacity int, onEvict func(key K, value V)) *LFUCache[K, V] {
 	cache := &LFUCache[K, V]{
 		items:    make(map[K]*lfuItem[K, V], capacity),
 		freqList: list.New(),
 		capacity: capacity,
+		onEvict:  onEvict,
 	}
 
 	cache.freqList.PushFront(&freqEntry[K, V]{
@@ -69,12 +72,31 @@ func (c *LFUCache[K, V]) Get(key K) (V, bool) {
 	return it.value, true
 }
 
+// Peek returns the value for specified key without updating frequency.
+func (c *LFUCache[K, V]) Peek(key K) (V, bool) {
+	it, ok := c.items[key]
+	if !ok {
+		var v V
+		return v, false
+	}
+
+	return it.value, true
+}
+
 func (c *LFUCache[K, V]) Remove(key K) {
 	if it, ok := c.items[key]; ok {
 		c.removeItem(it)
 	}
 }
 
+func (c *LFUCache[K, V]) Keys() []K {
+	keys := make([]K, 0, len(c.items))
+	for key := range c.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func (c *LFUCache[K, V]) Len() int {
 	return len(c.items)
 }
@@ -92,12 +114,34 @@ func (c *LFUCache[K, V]) Evict(count int) {
 			}
 
 			c.removeItem(item)
+			if c.onEvict != nil {
+				c.onEvict(item.key, item.value)
+			}
 			i++
 		}
 		entry = entry.Next()
 	}
 }
 
+// Victim returns key with the lowest frequency, which is evicted next.
+func (c *LFUCache[K, V]) Victim() (K, bool) {
+	for entry := c.freqList.Front(); entry != nil; entry = entry.Next() {
+		for item := range entry.Value.(*freqEntry[K, V]).items {
+			return item.key, true
+		}
+	}
+	var k K
+	return k, false
+}
+
+// Resize changes capacity and evicts items over it.
+func (c *LFUCache[K, V]) Resize(capacity int) {
+	c.capacity = capacity
+	if over := len(c.items) - capacity; over > 0 {
+		c.Evict(over)
+	}
+}
+
 func (c *LFUCache[K, V]) removeItem(item *lfuItem[K, V]) {
 	entry := item.freqElement.Value.(*freqEntry[K, V])
 	delete(c.items, item.key)
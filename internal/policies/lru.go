@@ -6,13 +6,16 @@ type LRUCache[K comparable, V any] struct {
 	items     map[K]*list.Element
 	evictList *list.List
 	capacity  int
+	onEvict   func(key K, value V)
 }
 
-func NewLRUCache[K comparable, V any](capacity int) *LRUCache[K, V] {
+// NewLRUCache returns LRU cache, onEvict is called for each evicted item and may be nil.
+func NewLRUCache[K comparable, V any](capacity int, onEvict func(key K, value V)) *LRUCache[K, V] {
 	return &LRUCache[K, V]{
 		items:     make(map[K]*list.Element),
 		evictList: list.New(),
 		capacity:  capacity,
+		onEvict:   onEvict,
 	}
 }
 
@@ -57,6 +60,26 @@ func (c *LRUCache[K, V]) Get(key K) (V, bool) {
 	return it.value, true
 }
 
+// Peek returns the value for specified key without updating recency.
+func (c *LRUCache[K, V]) Peek(key K) (V, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		var v V
+		return v, false
+	}
+
+	return item.Value.(*lruItem[K, V]).value, true
+}
+
+// Keys returns keys from most to least recently used.
+func (c *LRUCache[K, V]) Keys() []K {
+	keys := make([]K, 0, len(c.items))
+	for ent := c.evictList.Front(); ent != nil; ent = ent.Next() {
+		keys = append(keys, ent.Value.(*lruItem[K, V]).key)
+	}
+	return keys
+}
+
 func (c *LRUCache[K, V]) Len() int {
 	return len(c.items)
 }
@@ -75,6 +98,28 @@ func (c *LRUCache[K, V]) Evict(count int) {
 		}
 
 		c.removeElement(ent)
+		if c.onEvict != nil {
+			item := ent.Value.(*lruItem[K, V])
+			c.onEvict(item.key, item.value)
+		}
+	}
+}
+
+// Victim returns least recently used key, which is evicted next.
+func (c *LRUCache[K, V]) Victim() (K, bool) {
+	ent := c.evictList.Back()
+	if ent == nil {
+		var k K
+		return k, false
+	}
+	return ent.Value.(*lruItem[K, V]).key, true
+}
+
+// Resize changes capacity and evicts least recently used items over it.
+func (c *LRUCache[K, V]) Resize(capacity int) {
+	c.capacity = capacity
+	if over := c.evictList.Len() - capacity; over > 0 {
+		c.Evict(over)
 	}
 }
 
@@ -15,6 +15,18 @@ func (c NoEvictionCache[K, V]) Get(key K) (V, bool) {
 	return value, ok
 }
 
+func (c NoEvictionCache[K, V]) Peek(key K) (V, bool) {
+	return c.Get(key)
+}
+
+func (c NoEvictionCache[K, V]) Keys() []K {
+	keys := make([]K, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func (c NoEvictionCache[K, V]) Len() int {
 	return len(c)
 }
@@ -24,3 +36,5 @@ func (c NoEvictionCache[K, V]) Remove(key K) {
 }
 
 func (c NoEvictionCache[K, V]) Evict(_ int) {}
+
+func (c NoEvictionCache[K, V]) Resize(_ int) {}
@@ -0,0 +1,84 @@
+package policies
+
+import "math/bits"
+
+const (
+	// sketchDepth is number of counter rows of count-min sketch.
+	sketchDepth = 4
+	// sketchMaxCount is saturation value of 4-bit counter.
+	sketchMaxCount = 15
+)
+
+// countMinSketch is probabilistic frequency estimator with 4-bit counters,
+// which are halved periodically to keep frequencies fresh.
+// See: https://arxiv.org/abs/1512.00727.
+type countMinSketch struct {
+	// rows contains counters packed by two per byte.
+	rows       [sketchDepth][]byte
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := uint64(1) << bits.Len64(uint64(max(capacity, 16)-1))
+	sketch := &countMinSketch{
+		mask:       width - 1,
+		sampleSize: 10 * max(capacity, 1),
+	}
+	for i := range sketch.rows {
+		sketch.rows[i] = make([]byte, width/2)
+	}
+	return sketch
+}
+
+// Increment increments estimated frequency of hashed key.
+func (s *countMinSketch) Increment(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.counter(i, idx) < sketchMaxCount {
+			s.rows[i][idx/2] += 1 << ((idx % 2) * 4)
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// Estimate returns estimated frequency of hashed key.
+func (s *countMinSketch) Estimate(hash uint64) byte {
+	estimate := byte(sketchMaxCount)
+	for i := range s.rows {
+		estimate = min(estimate, s.counter(i, s.index(hash, i)))
+	}
+	return estimate
+}
+
+// Clear resets all counters.
+func (s *countMinSketch) Clear() {
+	for i := range s.rows {
+		clear(s.rows[i])
+	}
+	s.additions = 0
+}
+
+func (s *countMinSketch) index(hash uint64, row int) uint64 {
+	hash = mix(hash + uint64(row)*0x9e3779b97f4a7c15)
+	return hash & s.mask
+}
+
+func (s *countMinSketch) counter(row int, idx uint64) byte {
+	return (s.rows[row][idx/2] >> ((idx % 2) * 4)) & 0x0f
+}
+
+// reset halves all counters, aging frequencies of old keys.
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j, b := range s.rows[i] {
+			s.rows[i][j] = (b >> 1) & 0x77
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,197 @@
+package policies
+
+import "hash/maphash"
+
+// TinyLFUCache is W-TinyLFU cache: new items are admitted to small window LRU,
+// items leaving window compete by estimated frequency with victim of main
+// segmented LRU, which is split to probation and protected segments.
+// See: https://arxiv.org/abs/1512.00727.
+type TinyLFUCache[K comparable, V any] struct {
+	// window is lru for recently inserted items.
+	window *LRUCache[K, V]
+	// probation is lru for items admitted to main segment.
+	probation *LRUCache[K, V]
+	// protected is lru for items accessed in probation segment.
+	protected *LRUCache[K, V]
+
+	sketch *countMinSketch
+	seed   maphash.Seed
+
+	windowCapacity    int
+	mainCapacity      int
+	protectedCapacity int
+	onEvict           func(key K, value V)
+}
+
+// NewTinyLFUCache returns W-TinyLFU cache, onEvict is called for each evicted item and may be nil.
+func NewTinyLFUCache[K comparable, V any](capacity int, onEvict func(key K, value V)) *TinyLFUCache[K, V] {
+	windowCapacity := max(capacity/100, 1)
+	mainCapacity := max(capacity-windowCapacity, 0)
+
+	return &TinyLFUCache[K, V]{
+		// NOTE: segments are bounded by TinyLFUCache itself.
+		window:            NewLRUCache[K, V](capacity+1, nil),
+		probation:         NewLRUCache[K, V](capacity+1, nil),
+		protected:         NewLRUCache[K, V](capacity+1, nil),
+		sketch:            newCountMinSketch(capacity),
+		seed:              maphash.MakeSeed(),
+		windowCapacity:    windowCapacity,
+		mainCapacity:      mainCapacity,
+		protectedCapacity: mainCapacity * 8 / 10,
+		onEvict:           onEvict,
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Set(key K, value V) {
+	c.sketch.Increment(HashKey(c.seed, key))
+
+	for _, segment := range []*LRUCache[K, V]{c.window, c.probation, c.protected} {
+		if _, ok := segment.Peek(key); ok {
+			segment.Set(key, value)
+			return
+		}
+	}
+
+	c.window.Set(key, value)
+	if c.window.Len() > c.windowCapacity {
+		if k, v, ok := removeOldest(c.window); ok {
+			c.admit(k, v)
+		}
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Get(key K) (V, bool) {
+	c.sketch.Increment(HashKey(c.seed, key))
+
+	if value, ok := c.window.Get(key); ok {
+		return value, ok
+	}
+
+	if value, ok := c.probation.Peek(key); ok {
+		c.probation.Remove(key)
+		c.protected.Set(key, value)
+		if c.protected.Len() > c.protectedCapacity {
+			if k, v, ok := removeOldest(c.protected); ok {
+				c.probation.Set(k, v)
+			}
+		}
+		return value, ok
+	}
+
+	return c.protected.Get(key)
+}
+
+// Peek returns the value for specified key without updating frequency and recency.
+func (c *TinyLFUCache[K, V]) Peek(key K) (V, bool) {
+	if value, ok := c.window.Peek(key); ok {
+		return value, ok
+	}
+	if value, ok := c.probation.Peek(key); ok {
+		return value, ok
+	}
+	return c.protected.Peek(key)
+}
+
+func (c *TinyLFUCache[K, V]) Remove(key K) {
+	c.window.Remove(key)
+	c.probation.Remove(key)
+	c.protected.Remove(key)
+}
+
+// Evict evicts items from probation segment first, then from window and protected.
+func (c *TinyLFUCache[K, V]) Evict(count int) {
+	for i := 0; i < count; i++ {
+		var (
+			k  K
+			v  V
+			ok bool
+		)
+		for _, segment := range []*LRUCache[K, V]{c.probation, c.window, c.protected} {
+			if k, v, ok = removeOldest(segment); ok {
+				break
+			}
+		}
+		if !ok {
+			return
+		}
+		c.evicted(k, v)
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Keys() []K {
+	keys := c.window.Keys()
+	keys = append(keys, c.probation.Keys()...)
+	return append(keys, c.protected.Keys()...)
+}
+
+func (c *TinyLFUCache[K, V]) Len() int {
+	return c.window.Len() + c.probation.Len() + c.protected.Len()
+}
+
+// Victim returns key, which is evicted next by Evict.
+func (c *TinyLFUCache[K, V]) Victim() (K, bool) {
+	for _, segment := range []*LRUCache[K, V]{c.probation, c.window, c.protected} {
+		if key, ok := segment.Victim(); ok {
+			return key, ok
+		}
+	}
+	var k K
+	return k, false
+}
+
+// Resize changes capacity and segment sizes, evicts items over capacity.
+func (c *TinyLFUCache[K, V]) Resize(capacity int) {
+	c.windowCapacity = max(capacity/100, 1)
+	c.mainCapacity = max(capacity-c.windowCapacity, 0)
+	c.protectedCapacity = c.mainCapacity * 8 / 10
+	for _, segment := range []*LRUCache[K, V]{c.window, c.probation, c.protected} {
+		segment.capacity = capacity + 1
+	}
+
+	if over := c.Len() - capacity; over > 0 {
+		c.Evict(over)
+	}
+	for c.window.Len() > c.windowCapacity {
+		k, v, _ := removeOldest(c.window)
+		c.admit(k, v)
+	}
+	for c.protected.Len() > c.protectedCapacity {
+		k, v, _ := removeOldest(c.protected)
+		c.probation.Set(k, v)
+	}
+}
+
+// admit moves candidate evicted from window to main segment, if main segment
+// is full candidate competes with probation victim by estimated frequency.
+func (c *TinyLFUCache[K, V]) admit(key K, value V) {
+	if c.probation.Len()+c.protected.Len() < c.mainCapacity {
+		c.probation.Set(key, value)
+		return
+	}
+
+	victims := c.probation
+	if victims.Len() == 0 {
+		victims = c.protected
+	}
+	victim := victims.evictList.Back()
+	if victim == nil {
+		c.evicted(key, value)
+		return
+	}
+
+	victimKey := victim.Value.(*lruItem[K, V]).key
+	if c.sketch.Estimate(HashKey(c.seed, key)) <= c.sketch.Estimate(HashKey(c.seed, victimKey)) {
+		c.evicted(key, value)
+		return
+	}
+
+	k, v, _ := removeOldest(victims)
+	c.evicted(k, v)
+	c.probation.Set(key, value)
+}
+
+func (c *TinyLFUCache[K, V]) evicted(key K, value V) {
+	if c.onEvict != nil {
+		c.onEvict(key, value)
+	}
+}
@@ -0,0 +1,79 @@
+// Package ring implements consistent hashing of keys to nodes.
+package ring
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is default number of virtual nodes of each node.
+const DefaultReplicas = 64
+
+// Ring is consistent hash ring, each node is placed to ring by several
+// virtual nodes, so keys are spread evenly and only keys of added or
+// removed node are moved. Ring is not safe for concurrent modification.
+type Ring struct {
+	replicas int
+	hashes   []uint32
+	nodes    map[uint32]string
+}
+
+// New returns empty ring with given number of virtual nodes of each node.
+func New(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{replicas: replicas, nodes: make(map[uint32]string)}
+}
+
+// Add places given nodes to ring.
+func (r *Ring) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			if _, ok := r.nodes[hash]; ok {
+				continue
+			}
+			r.nodes[hash] = node
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Empty reports whether ring has no nodes.
+func (r *Ring) Empty() bool {
+	return len(r.hashes) == 0
+}
+
+// Get returns node owning key, it returns empty string if ring is empty.
+func (r *Ring) Get(key string) string {
+	nodes := r.GetN(key, 1)
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0]
+}
+
+// GetN returns up to n distinct nodes owning key, first node is owner and
+// next ones follow it on ring, e.g. to hold replicas of key.
+func (r *Ring) GetN(key string, n int) []string {
+	if len(r.hashes) == 0 || n <= 0 {
+		return nil
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < len(r.hashes) && len(nodes) < n; i++ {
+		node := r.nodes[r.hashes[(start+i)%len(r.hashes)]]
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
@@ -0,0 +1,62 @@
+//go:build go1.23
+
+package cache
+
+import "iter"
+
+// All returns iterator over key-value pairs of cache, expired entries are
+// skipped unless pinned. Pairs are copied under cache lock when iteration
+// starts, so iteration sees consistent snapshot of cache and cache can be
+// used and modified by loop body.
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		keys, values := c.live(true)
+		for i, key := range keys {
+			if !yield(key, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// AllKeys returns iterator over keys of cache, keys are copied when
+// iteration starts as by All.
+func (c *Cache[K, V]) AllKeys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		keys, _ := c.live(false)
+		for _, key := range keys {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// live returns keys of entries, which are not expired or pinned, and their
+// values if withValues is set.
+func (c *Cache[K, V]) live(withValues bool) ([]K, []V) {
+	c.acquireShared()
+	defer c.lock.RUnlock()
+
+	now := c.clock.Now()
+	keys := c.keys()
+	var values []V
+	if withValues {
+		values = make([]V, 0, len(keys))
+	}
+	n := 0
+	for _, key := range keys {
+		item, _ := c.peek(key)
+		if !item.deadline.IsZero() && !item.deadline.After(now) {
+			if _, pinned := c.pinned[key]; !pinned {
+				continue
+			}
+		}
+		keys[n] = key
+		n++
+		if withValues {
+			values = append(values, item.value)
+		}
+	}
+	return keys[:n], values
+}
@@ -0,0 +1,74 @@
+//go:build go1.23
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_Iterators(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache[int, int](ctx, 10)
+	for i := 0; i < 5; i++ {
+		cache.Set(i, i*10)
+	}
+
+	seen := map[int]int{}
+	for key, value := range cache.All() {
+		// NOTE: cache is usable during iteration over snapshot.
+		cache.Remove(key)
+		cache.Set(key+100, value)
+		seen[key] = value
+	}
+	if len(seen) != 5 {
+		fail(t, `expected snapshot of 5 entries, got %d`, len(seen))
+	}
+	for key, value := range seen {
+		if value != key*10 {
+			fail(t, `unexpected value %d of key %d`, value, key)
+		}
+	}
+
+	count := 0
+	for key := range cache.AllKeys() {
+		if key < 100 {
+			fail(t, `unexpected removed key %d`, key)
+		}
+		if count++; count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		fail(t, `expected iteration stopped by break`)
+	}
+}
+
+func Test_IteratorsSkipExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Now()}
+	cache := NewCache[string, int](ctx, 10, WithClock(clock))
+	cache.SetNX(`expired`, 1, time.Second)
+	cache.SetNX(`live`, 2, time.Hour)
+	cache.Set(`persistent`, 3)
+	cache.Pin(`persistent`)
+	clock.Advance(time.Minute)
+
+	seen := map[string]int{}
+	for key, value := range cache.All() {
+		seen[key] = value
+	}
+	if len(seen) != 2 || seen[`live`] != 2 || seen[`persistent`] != 3 {
+		fail(t, `expected expired entry skipped, got %v`, seen)
+	}
+	for key := range cache.AllKeys() {
+		if key == `expired` {
+			fail(t, `expected expired key skipped`)
+		}
+	}
+}
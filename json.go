@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// jsonEntry is entry of cache encoded by MarshalJSON, value is nil if it
+// is redacted and expiration time is nil if entry does not expire.
+type jsonEntry[V any] struct {
+	Value     *V         `json:"value,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, it encodes snapshot of entries
+// as JSON object {key: {"value": value, "expiresAt": time}}, expired
+// entries are skipped unless pinned. Expiration time is omitted for
+// entries, which can be evicted only by policy, and value is omitted if
+// WithJSONRedaction is used. Keys are encoded by encoding/json as keys of
+// map, so key type must be string, integer or implement
+// encoding.TextMarshaler.
+func (c *Cache[K, V]) MarshalJSON() ([]byte, error) {
+	c.acquireShared()
+	now := c.clock.Now()
+	entries := make(map[K]jsonEntry[V], c.len())
+	for _, key := range c.keys() {
+		item, _ := c.peek(key)
+		var e jsonEntry[V]
+		if !item.deadline.IsZero() {
+			if _, pinned := c.pinned[key]; !pinned && !item.deadline.After(now) {
+				continue
+			}
+			deadline := item.deadline
+			e.ExpiresAt = &deadline
+		}
+		if !c.redactJSON {
+			value := item.value
+			e.Value = &value
+		}
+		entries[key] = e
+	}
+	c.lock.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, fmt.Errorf("cache: encode json: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import "sync"
+
+// keyLocks is set of mutexes by key, sharded by key hash as index is.
+// Mutex of key exists only while it is held or awaited.
+type keyLocks[K comparable] struct {
+	shards [indexShards]keyLockShard[K]
+}
+
+type keyLockShard[K comparable] struct {
+	lock  sync.Mutex
+	locks map[K]*keyLock
+}
+
+// keyLock is mutex of key with number of its holders and waiters.
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks mutex of key, which is in shard by given hash, and returns
+// function which unlocks it.
+func (l *keyLocks[K]) lock(hash uint64, key K) func() {
+	shard := &l.shards[hash&(indexShards-1)]
+	shard.lock.Lock()
+	if shard.locks == nil {
+		shard.locks = make(map[K]*keyLock)
+	}
+	kl, ok := shard.locks[key]
+	if !ok {
+		kl = &keyLock{}
+		shard.locks[key] = kl
+	}
+	kl.refs++
+	shard.lock.Unlock()
+
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+
+		shard.lock.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(shard.locks, key)
+		}
+		shard.lock.Unlock()
+	}
+}
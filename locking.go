@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/moeryomenko/synx"
+)
+
+// LockingMode defines lock which guards cache state.
+type LockingMode int
+
+const (
+	// SpinLock guards cache by spinlock, it is default mode.
+	SpinLock LockingMode = iota
+	// RWMutexLock guards cache by sync.RWMutex, which parks waiting
+	// goroutines instead of spinning, read-only operations share lock.
+	RWMutexLock
+	// NoLock disables cache lock, cache must be synchronized externally.
+	// Expiration is applied lazily by cache operations instead of janitor.
+	NoLock
+)
+
+// locker is lock of cache state.
+type locker interface {
+	Lock()
+	Unlock()
+	TryLock() bool
+	RLock()
+	RUnlock()
+}
+
+func newLocker(mode LockingMode) locker {
+	switch mode {
+	case RWMutexLock:
+		return &sync.RWMutex{}
+	case NoLock:
+		return noLock{}
+	default:
+		return &spinLock{}
+	}
+}
+
+// spinLock is exclusive spinlock, shared locking is exclusive too.
+type spinLock struct {
+	synx.Spinlock
+}
+
+func (l *spinLock) RLock()   { l.Lock() }
+func (l *spinLock) RUnlock() { l.Unlock() }
+
+// noLock is lock of externally synchronized cache.
+type noLock struct{}
+
+func (noLock) Lock()         {}
+func (noLock) Unlock()       {}
+func (noLock) TryLock() bool { return true }
+func (noLock) RLock()        {}
+func (noLock) RUnlock()      {}
+
+// publishingLock publishes modifications made under exclusive lock before
+// it is released.
+type publishingLock struct {
+	locker
+	publish func()
+}
+
+func (l *publishingLock) Unlock() {
+	l.publish()
+	l.locker.Unlock()
+}
@@ -0,0 +1,83 @@
+// Package natsbus implements invalidation bus of cache over NATS subject,
+// see cache.WithInvalidationBus.
+package natsbus
+
+import (
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// DefaultSubject is subject of invalidations by default.
+const DefaultSubject = "ttlcache.invalidations"
+
+// Conn is connection to NATS, which publishes invalidations to subject and
+// subscribes bus to it, by queue group if it is set by WithQueueGroup.
+// *nats.Conn of github.com/nats-io/nats.go is wrapped as:
+//
+//	type conn struct{ nc *nats.Conn }
+//
+//	func (c conn) Publish(subject string, data []byte) error {
+//		return c.nc.Publish(subject, data)
+//	}
+//
+//	func (c conn) Subscribe(subject, queue string, handler func([]byte)) (func() error, error) {
+//		sub, err := c.nc.QueueSubscribe(subject, queue, func(m *nats.Msg) { handler(m.Data) })
+//		if err != nil {
+//			return nil, err
+//		}
+//		return sub.Unsubscribe, nil
+//	}
+type Conn interface {
+	// Publish sends data to subject.
+	Publish(subject string, data []byte) error
+	// Subscribe registers handler of messages of subject, empty queue
+	// means plain subscription. Returned function cancels subscription.
+	Subscribe(subject, queue string, handler func(data []byte)) (unsubscribe func() error, err error)
+}
+
+// Option is an option that can be applied to bus.
+type Option func(*bus)
+
+// WithSubject sets subject of invalidations, e.g. to separate caches of
+// different data sharing NATS cluster.
+func WithSubject(subject string) Option {
+	return func(b *bus) {
+		b.subject = subject
+	}
+}
+
+// WithQueueGroup subscribes bus to queue group, so each invalidation is
+// delivered to single member of group. Caches of different replicas must
+// use different groups, e.g. name of replica, otherwise they miss
+// invalidations delivered to their peers.
+func WithQueueGroup(group string) Option {
+	return func(b *bus) {
+		b.queue = group
+	}
+}
+
+type bus struct {
+	conn    Conn
+	subject string
+	queue   string
+}
+
+// New returns invalidation bus over given NATS connection.
+func New(conn Conn, opts ...Option) cache.Bus {
+	b := &bus{conn: conn, subject: DefaultSubject}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *bus) Publish(msg []byte) error {
+	return b.conn.Publish(b.subject, msg)
+}
+
+func (b *bus) Subscribe(handler func(msg []byte)) (func(), error) {
+	unsubscribe, err := b.conn.Subscribe(b.subject, b.queue, handler)
+	if err != nil {
+		return nil, err
+	}
+	return func() { unsubscribe() }, nil
+}
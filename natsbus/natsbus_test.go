@@ -0,0 +1,90 @@
+package natsbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// memoryConn is NATS connection, which delivers messages in memory.
+type memoryConn struct {
+	lock     sync.Mutex
+	next     int
+	handlers map[int]subscription
+}
+
+type subscription struct {
+	subject, queue string
+	handler        func(data []byte)
+}
+
+func (c *memoryConn) Publish(subject string, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	groups := map[string]bool{}
+	for _, sub := range c.handlers {
+		if sub.subject != subject || (sub.queue != `` && groups[sub.queue]) {
+			continue
+		}
+		groups[sub.queue] = sub.queue != ``
+		sub.handler(data)
+	}
+	return nil
+}
+
+func (c *memoryConn) Subscribe(subject, queue string, handler func(data []byte)) (func() error, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	id := c.next
+	c.next++
+	c.handlers[id] = subscription{subject: subject, queue: queue, handler: handler}
+	return func() error {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		delete(c.handlers, id)
+		return nil
+	}, nil
+}
+
+func Test_Bus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := &memoryConn{handlers: map[int]subscription{}}
+	first := cache.NewCache[string, int](ctx, 10,
+		cache.WithInvalidationBus(New(conn, WithSubject(`users`), WithQueueGroup(`first`))))
+	second := cache.NewCache[string, int](ctx, 10,
+		cache.WithInvalidationBus(New(conn, WithSubject(`users`), WithQueueGroup(`second`))))
+	other := cache.NewCache[string, int](ctx, 10,
+		cache.WithInvalidationBus(New(conn, WithSubject(`orders`))))
+
+	fill := func(c *cache.Cache[string, int]) {
+		c.GetOrCompute(`key`, func() (int, time.Duration, error) { return 1, time.Minute, nil })
+	}
+	fill(second)
+	fill(other)
+	first.Remove(`key`)
+
+	deadline := time.Now().Add(time.Second)
+	for second.Contains(`key`) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if second.Contains(`key`) {
+		t.Fatal(`expected key invalidated on peer`)
+	}
+	if !other.Contains(`key`) {
+		t.Fatal(`expected key of other subject kept`)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Fatalf(`unexpected close error: %v`, err)
+	}
+	if len(conn.handlers) != 2 {
+		t.Fatalf(`expected subscription cancelled on close, got %d`, len(conn.handlers))
+	}
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// opKind is kind of operation recorded to operation log.
+type opKind uint8
+
+const (
+	opSet opKind = iota + 1
+	opRemove
+	opClear
+)
+
+// opRecord is record of operation log, zero deadline means that entry
+// can be evicted only by policy.
+type opRecord[K comparable, V any] struct {
+	Op       opKind
+	Key      K
+	Value    V
+	Deadline time.Time
+}
+
+// truncater is implemented by operation log, which is compacted by
+// Cache.Snapshot, e.g. by *os.File.
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// opLog writes operations of cache to writer, each record is gob-encoded
+// independently and prefixed by its length, so log can be appended by
+// several processes and torn record at its end is detected by replay.
+// Log is written under cache lock.
+type opLog[K comparable, V any] struct {
+	w       io.Writer
+	payload bytes.Buffer
+	record  []byte
+	// pending keeps records written during snapshot, which are written
+	// again once log is compacted, it is nil without snapshot in progress.
+	pending *bytes.Buffer
+}
+
+func newOpLog[K comparable, V any](w io.Writer) *opLog[K, V] {
+	if w == nil {
+		return nil
+	}
+	return &opLog[K, V]{w: w}
+}
+
+// append writes record to log by single write.
+func (l *opLog[K, V]) append(rec opRecord[K, V]) error {
+	l.payload.Reset()
+	if err := gob.NewEncoder(&l.payload).Encode(&rec); err != nil {
+		return err
+	}
+	if l.payload.Len() > maxLogRecordSize {
+		return fmt.Errorf("%w: size %d", errLogRecordTooLarge, l.payload.Len())
+	}
+	l.record = binary.AppendUvarint(l.record[:0], uint64(l.payload.Len()))
+	l.record = append(l.record, l.payload.Bytes()...)
+	if l.pending != nil {
+		l.pending.Write(l.record)
+	}
+	_, err := l.w.Write(l.record)
+	return err
+}
+
+// startCompaction starts to keep records written during snapshot, it
+// reports false if log is not compactable or snapshot is in progress.
+func (l *opLog[K, V]) startCompaction() bool {
+	if _, ok := l.w.(truncater); !ok || l.pending != nil {
+		return false
+	}
+	l.pending = new(bytes.Buffer)
+	return true
+}
+
+// compact truncates log written before snapshot, records written during
+// snapshot are kept, since snapshot may miss them.
+func (l *opLog[K, V]) compact() error {
+	pending := l.pending
+	l.pending = nil
+	if err := l.w.(truncater).Truncate(0); err != nil {
+		return err
+	}
+	_, err := l.w.Write(pending.Bytes())
+	return err
+}
+
+// abortCompaction keeps log intact, e.g. if snapshot failed.
+func (l *opLog[K, V]) abortCompaction() {
+	l.pending = nil
+}
+
+// logOp appends operation to operation log if it is configured, failure
+// is logged, since it must not fail cache operation.
+func (c *Cache[K, V]) logOp(rec opRecord[K, V]) {
+	if c.oplog == nil {
+		return
+	}
+	if err := c.oplog.append(rec); err != nil {
+		logWarn(c.logger, "ttlcache: operation log write failed", slog.Any("error", err))
+	}
+}
+
+// ReplayLog applies operations recorded by WithOperationLog from r to
+// cache, entries which expiration time has passed are removed. Torn record
+// at the end of log, which is left by crash during write, is ignored, and
+// record with size over limit is reported as corruption of log. Replayed
+// operations are not recorded to operation log again, they call no removal
+// callbacks and are not published to peers.
+func (c *Cache[K, V]) ReplayLog(r io.Reader) error {
+	c.acquire()
+	defer c.release()
+
+	oplog := c.oplog
+	c.oplog = nil
+	defer func() { c.oplog = oplog }()
+
+	reader := bufio.NewReader(r)
+	var payload []byte
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return replayError(err)
+		}
+		if size > maxLogRecordSize {
+			return fmt.Errorf("%w: record size %d exceeds limit", errLogCorrupted, size)
+		}
+		if uint64(cap(payload)) < size {
+			payload = make([]byte, size)
+		}
+		payload = payload[:size]
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return replayError(err)
+		}
+
+		var rec opRecord[K, V]
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+			return fmt.Errorf("cache: decode operation log: %w", err)
+		}
+		c.quietly(func() { c.replay(rec) })
+	}
+}
+
+// replayError returns error of reading log, torn record is not an error.
+func replayError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return fmt.Errorf("cache: read operation log: %w", err)
+}
+
+// replay applies single operation of log.
+func (c *Cache[K, V]) replay(rec opRecord[K, V]) {
+	switch rec.Op {
+	case opSet:
+		// NOTE: replaced value is discarded, so its replacement is not
+		// reported again.
+		c.discard(rec.Key)
+		switch ttl := rec.Deadline.Sub(c.clock.Now()); {
+		case rec.Deadline.IsZero():
+			c.set(rec.Key, rec.Value)
+		case ttl > 0:
+			c.setNX(rec.Key, rec.Value, ttl)
+		}
+	case opRemove:
+		c.discard(rec.Key)
+	case opClear:
+		c.reset()
+	}
+}
@@ -1,8 +1,14 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
 
-// Option is an option that can be applied to cache.
+// Option is an option that can be applied to cache. Callbacks added by
+// several WithOn options of the same event are called in order of options.
 type Option func(*config)
 
 // WithEvictionPolicy sets eviction policy for cache.
@@ -12,9 +18,466 @@ func WithEvictionPolicy(policy evictionPolicy) Option {
 	}
 }
 
+// WithDefaultTTL sets expiration time applied by Set, non-positive value
+// means that entries set by Set can be evicted only by policy.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.defaultTTL = ttl
+	}
+}
+
+// WithSlidingTTL enables sliding expiration, each access to entry
+// prolongs its expiration time for duration it was set with.
+func WithSlidingTTL() Option {
+	return func(c *config) {
+		c.sliding = true
+	}
+}
+
+// WithTTLJitter sets fraction of expiration time by which expiration of each
+// entry is randomized, e.g. 0.1 spreads expiration over ±10% of given duration.
+// Fraction is clamped to [0, 1].
+func WithTTLJitter(fraction float64) Option {
+	return func(c *config) {
+		c.jitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithMaxTTL sets upper bound of expiration time, longer expiration
+// requested for entry is clamped to it.
+func WithMaxTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.maxTTL = ttl
+	}
+}
+
+// WithOnEvict adds callback which is called for each entry evicted by
+// replacement policy. Callback is called under cache lock, so it must not
+// call cache methods. Key and value types must match types of cache.
+func WithOnEvict[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onEvict = chainCallback(c.onEvict, fn)
+	}
+}
+
+// WithOnExpire adds callback which is called for each entry removed by
+// expiration. Callback is called under cache lock, so it must not call
+// cache methods. Key and value types must match types of cache.
+func WithOnExpire[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onExpire = chainCallback(c.onExpire, fn)
+	}
+}
+
+// WithOnRemoval adds callback which is called for each entry removed
+// from cache with reason of removal. Callback is called under cache lock,
+// so it must not call cache methods. Key and value types must match types of cache.
+func WithOnRemoval[K comparable, V any](fn func(key K, value V, reason Reason)) Option {
+	return func(c *config) {
+		c.onRemoval = chainRemovalCallback(c.onRemoval, fn)
+	}
+}
+
+// WithOnSet adds callback which is called for each inserted or updated
+// entry. Callback is called under cache lock, so it must not call cache
+// methods. Key and value types must match types of cache.
+func WithOnSet[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onSet = chainCallback(c.onSet, fn)
+	}
+}
+
+// WithOnRemove adds callback which is called for each entry removed
+// explicitly by Remove, Pop or Delete. Callback is called under cache lock,
+// so it must not call cache methods. Key and value types must match types
+// of cache.
+func WithOnRemove[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onRemove = chainCallback(c.onRemove, fn)
+	}
+}
+
+// WithOnReject adds callback which is called for each entry refused by
+// WithMaxEntrySize. Callback is called under cache lock, so it must not
+// call cache methods. Key and value types must match types of cache.
+func WithOnReject[K comparable, V any](fn func(key K, value V)) Option {
+	return func(c *config) {
+		c.onReject = chainCallback(c.onReject, fn)
+	}
+}
+
+// WithEvictOnClose enables eviction callbacks for entries remaining in
+// cache when it is closed by Cache.Close, e.g. to release resources held
+// by values.
+func WithEvictOnClose() Option {
+	return func(c *config) {
+		c.evictOnClose = true
+	}
+}
+
+// WithJSONRedaction omits values of entries from JSON encoding of cache by
+// Cache.MarshalJSON, so keys and expiration times can be exposed, e.g. by
+// admin endpoints, without leaking values.
+func WithJSONRedaction() Option {
+	return func(c *config) {
+		c.redactJSON = true
+	}
+}
+
+// WithValueCloner sets function, which deep-copies values of entries
+// copied by Cache.Clone, so clone does not share mutable state of values,
+// e.g. maps or slices, with original cache. Values are copied by assignment
+// if it is not set. Value type must match value type of cache.
+func WithValueCloner[V any](fn func(value V) V) Option {
+	return func(c *config) {
+		c.cloner = fn
+	}
+}
+
+// WithOperationLog enables append-only log of operations, which modify
+// entries explicitly, e.g. Set, SetNX, Expire, Remove and Clear. Cache
+// state is recovered by Cache.ReplayLog, e.g. after crash. Each operation
+// is written by single write under cache lock, failed writes are logged.
+// Encoded record must not exceed 64 MiB, larger records are not written.
+// Key and value types must be encodable by encoding/gob. If writer
+// implements Truncate(size int64) error, e.g. *os.File opened with
+// os.O_APPEND, log is compacted by Cache.Snapshot.
+func WithOperationLog(w io.Writer) Option {
+	return func(c *config) {
+		c.opLog = w
+	}
+}
+
+// WithPersistFile sets file, which cache is restored from by NewCache and
+// saved to by Cache.Close with remaining time to live of entries, see
+// Cache.Snapshot. Missing file is ignored, failed restore is logged and
+// failed save is returned by Close. Key and value types must be encodable
+// by encoding/gob.
+func WithPersistFile(path string) Option {
+	return func(c *config) {
+		c.persistFile = path
+	}
+}
+
+// WithOverflowStore sets second tier of cache, entries evicted by policy
+// are spilled to store and Get reads missed entries back from it, moving
+// them to memory again. Expired and removed entries are deleted from store,
+// but it is not cleared by Clear and Close. Key and value types must be
+// encodable by encoding/gob. See NewDirStore.
+func WithOverflowStore(store OverflowStore) Option {
+	return func(c *config) {
+		c.overflow, c.asyncSpill = store, false
+	}
+}
+
+// WithEvictionSpill sets overflow store as WithOverflowStore does, but
+// entries evicted by policy are written to store asynchronously, so
+// eviction does not wait for store. Queued writes are visible to Get before
+// they reach store and are flushed when cache is stopped.
+func WithEvictionSpill(store OverflowStore) Option {
+	return func(c *config) {
+		c.overflow, c.asyncSpill = store, true
+	}
+}
+
+// WithInvalidationBus sets bus shared by instances of cache, keys modified
+// explicitly, e.g. by Set, SetNX or Remove, are published to bus and
+// removed from peers, which read them again on next miss. Values filled by
+// GetOrCompute and loaders are not published. Keys are
+// published asynchronously in order of modification, failed publishes are
+// logged. Key type must be encodable by encoding/gob. See NewLocalBus.
+func WithInvalidationBus(bus Bus) Option {
+	return func(c *config) {
+		c.bus = bus
+	}
+}
+
+// WithAsyncCallbacks runs callbacks asynchronously by pool of given number
+// of workers, so slow callbacks do not block cache operations. Callbacks
+// are queued to buffer of given size, callbacks over full buffer are
+// dropped and counted by Cache.CallbacksDropped, so cache operations never
+// wait for callbacks. Callbacks may run concurrently and out of order.
+// Queued callbacks are run before cache is stopped by Close or cancellation
+// of its context.
+func WithAsyncCallbacks(workers, queueSize int) Option {
+	return func(c *config) {
+		c.callbackWorkers = workers
+		c.callbackQueue = queueSize
+	}
+}
+
+// WithExpiredBuffer enables delivery of expired entries to channel returned
+// by Cache.Expired with buffer of given size. Entries expired while buffer
+// is full are dropped and counted by Cache.ExpiredDropped, so channel must
+// be drained continuously. Channel is closed when cache is stopped,
+// buffered entries are still delivered.
+func WithExpiredBuffer(size int) Option {
+	return func(c *config) {
+		c.expiredBuffer = size
+	}
+}
+
+// WithLoader sets function which loads values missed by Get, loaded value
+// is set with returned expiration time as by GetOrCompute. Concurrent
+// callers of same missing key wait for single load and share its result,
+// failed load is not cached and Get reports miss. Loader is called with
+// context passed to NewCache. Key and value types must match types of cache.
+func WithLoader[K comparable, V any](fn func(ctx context.Context, key K) (V, time.Duration, error)) Option {
+	return func(c *config) {
+		c.loader = fn
+	}
+}
+
+// WithBulkLoader sets function which loads values missed by GetMany by
+// single call, e.g. by batch read of backend. Loaded values are set as by
+// Set, missing keys of result are omitted and failed load is not cached.
+// Loader is called with context passed to NewCache. Key and value types
+// must match types of cache.
+func WithBulkLoader[K comparable, V any](fn func(ctx context.Context, keys []K) (map[K]V, error)) Option {
+	return func(c *config) {
+		c.bulkLoader = fn
+	}
+}
+
+// WithLoaderRetry enables retry of failed loads of loaders configured by
+// WithLoader and WithBulkLoader up to given number of attempts. Attempts are
+// delayed by exponential backoff starting from given backoff and capped by
+// max backoff, each delay is randomized by jitter. Callers waiting for load
+// receive only error of last attempt. Retry stops when context of load is done.
+func WithLoaderRetry(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(c *config) {
+		c.loaderRetry = retryPolicy{attempts: attempts, backoff: max(backoff, 0), maxBackoff: maxBackoff}
+	}
+}
+
+// WithWriteThrough sets backing store fronted by cache. Set, SetNX,
+// SetMany, SetWithDeadline and GetOrSet synchronously write value to store
+// before it is set to cache, Delete deletes key from store before it is
+// removed from cache, while Remove and Pop only invalidate cache. Writes of
+// the same key are serialized by internal lock of key, which is not held
+// by LockKey, so writes can be called under LockKey.
+// Failed write is logged and key is removed from cache instead, failed
+// deletion is logged. Values filled by GetOrCompute and loaders are not
+// written back. Disabled or closed cache does not modify store. Key and
+// value types must match types of cache.
+func WithWriteThrough[K comparable, V any](store BackingStore[K, V]) Option {
+	return func(c *config) {
+		c.backing, c.writeBehind = store, nil
+	}
+}
+
+// WithWriteBehind sets backing store fronted by cache as WithWriteThrough
+// does, but modifications are queued and flushed to store by batches of
+// given size every interval or once batch is full. Repeated writes of key
+// are coalesced into latest one. Failed writes are retried by next flushes
+// until they fail given number of attempts. If store implements BatchStore,
+// each batch is written by single call. Queued write of key missed by Get
+// is flushed before key is loaded by loader, queue is flushed when cache
+// is stopped. Key and value types must match types of cache.
+func WithWriteBehind[K comparable, V any](store BackingStore[K, V], interval time.Duration, batchSize, attempts int) Option {
+	return func(c *config) {
+		c.backing = store
+		c.writeBehind = &writeBehindPolicy{interval: interval, batchSize: batchSize, attempts: attempts}
+	}
+}
+
+// WithNegativeCaching enables caching of loader failures for given TTL,
+// which should be short, so Get of failing key reports miss without calling
+// loader until failure expires. Only errors accepted by cacheable are
+// cached, e.g. not found but not timeouts, nil cacheable accepts all errors.
+// Number of cached failures is bounded by capacity, but at least 1024.
+func WithNegativeCaching(ttl time.Duration, cacheable func(err error) bool) Option {
+	return func(c *config) {
+		c.negativeTTL, c.cacheable = ttl, cacheable
+	}
+}
+
+// WithAdmissionFunc sets function which is consulted before insertion of new
+// key to full cache, key is not inserted if function returns false.
+// Key and value types must match types of cache.
+func WithAdmissionFunc[K comparable, V any](fn func(key K, value V) bool) Option {
+	return func(c *config) {
+		c.admission = fn
+	}
+}
+
+// WithAdmission sets admission filter, which is consulted before insertion
+// of new key to full cache together with eviction victim of policy. Filter
+// is used with any policy, custom policy is consulted without victim, so
+// new keys are always admitted to it.
+func WithAdmission(admission Admission) Option {
+	return func(c *config) {
+		c.admissionFilter = admission
+	}
+}
+
+// WithMetricsListener sets listener of cache events.
+func WithMetricsListener(listener MetricsListener) Option {
+	return func(c *config) {
+		c.metrics = listener
+	}
+}
+
+// WithLogger sets logger of significant internal events, such as janitor
+// runs, bulk expirations, high eviction rate and misconfiguration.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithSizer sets function which estimates size of entry in bytes, it
+// replaces default reflection-based estimation. Key and value types must
+// match types of cache.
+func WithSizer[K comparable, V any](fn func(key K, value V) int64) Option {
+	return func(c *config) {
+		c.sizer = fn
+	}
+}
+
+// WithWeigher sets function which computes weight of entry, total weight
+// of entries is bounded by WithMaxWeight. Key and value types must match
+// types of cache.
+func WithWeigher[K comparable, V any](fn func(key K, value V) int64) Option {
+	return func(c *config) {
+		c.weigher = fn
+	}
+}
+
+// WithMaxWeight sets limit of total weight of entries, entries are evicted
+// by policy until total weight fits the limit. Each entry weighs 1 unless
+// weigher is configured by WithWeigher. Capacity passed to NewCache still
+// bounds number of entries.
+func WithMaxWeight(weight int64) Option {
+	return func(c *config) {
+		c.maxWeight = weight
+	}
+}
+
+// WithMaxBytes sets limit of estimated size of entries in bytes, entries
+// are evicted by policy until size fits the limit. Size of entry is computed
+// by sizer configured with WithSizer or by reflection-based estimation. It
+// overrides WithWeigher and WithMaxWeight.
+func WithMaxBytes(bytes int64) Option {
+	return func(c *config) {
+		c.maxBytes = bytes
+	}
+}
+
+// WithMaxEntrySize sets limit of single entry size, larger entries are not
+// inserted and previous value by the same key is removed. Size is measured
+// by weigher configured with WithWeigher or WithMaxBytes, otherwise by sizer.
+func WithMaxEntrySize(limit int64) Option {
+	return func(c *config) {
+		c.maxEntrySize = limit
+	}
+}
+
+// WithWatermarks sets shares of capacity and max weight, when occupancy
+// reaches high watermark entries are evicted by policy down to low
+// watermark in one pass. Watermarks must satisfy 0 < low < high <= 1.
+func WithWatermarks(high, low float64) Option {
+	return func(c *config) {
+		c.highWatermark, c.lowWatermark = high, low
+	}
+}
+
+// WithEvictionOvershoot sets fraction of capacity and max weight, which is
+// evicted additionally whenever eviction is triggered, e.g. 0.05 evicts 5%
+// of capacity at once instead of single entry. Fraction is clamped to [0, 1].
+// It is ignored if WithWatermarks is used.
+func WithEvictionOvershoot(fraction float64) Option {
+	return func(c *config) {
+		c.overshoot = min(max(fraction, 0), 1)
+	}
+}
+
+// WithEvictionBatch sets number of entries evicted at once, during write
+// burst cache grows over capacity by up to size entries, which are then
+// evicted in single pass, so cost of eviction is amortized over writes.
+// It is ignored if WithWatermarks is used.
+func WithEvictionBatch(size int) Option {
+	return func(c *config) {
+		c.evictionBatch = max(size, 1)
+	}
+}
+
+// WithLocking sets lock which guards cache state, see LockingMode.
+func WithLocking(mode LockingMode) Option {
+	return func(c *config) {
+		c.locking = mode
+	}
+}
+
+// WithReadMostly enables copy-on-write mode for rarely written caches,
+// e.g. of configuration or feature flags. Entries are kept in immutable map,
+// which is copied and swapped atomically by each write, so Get takes no lock.
+// Lookups do not update eviction policy, so entries are evicted in order of
+// writes. It is ignored if WithSlidingTTL is used.
+func WithReadMostly() Option {
+	return func(c *config) {
+		c.readMostly = true
+	}
+}
+
+// WithoutJanitor disables background goroutine, which collects expired
+// entries. Expired entries are collected lazily by cache operations, as
+// TTL epochs pass by clock, so cache has no lifecycle to manage.
+func WithoutJanitor() Option {
+	return func(c *config) {
+		c.noJanitor = true
+	}
+}
+
+// WithDisabled turns cache to pass-through mode, when disabled is true cache
+// stores nothing and each lookup is a miss. It allows to toggle caching
+// without changing code which uses cache.
+func WithDisabled(disabled bool) Option {
+	return func(c *config) {
+		c.disabled = disabled
+	}
+}
+
+// WithCustomPolicy sets factory of custom replacement policy, which is used
+// instead of policy selected by WithEvictionPolicy. Key type must match key
+// type of cache.
+func WithCustomPolicy[K comparable](factory PolicyFactory[K]) Option {
+	return func(c *config) {
+		c.customPolicy = factory
+	}
+}
+
+// WithInitialEntries sets entries, which cache is populated with by NewCache
+// before it is returned, e.g. to warm up cache after restart. Entry with
+// non-positive TTL is set as by Set. Key and value types must match types
+// of cache.
+func WithInitialEntries[K comparable, V any](entries map[K]SeedEntry[V]) Option {
+	return func(c *config) {
+		c.initialEntries = entries
+	}
+}
+
 // WithTTLEpochGranularity sets ttl epoch granularity.
 func WithTTLEpochGranularity(period time.Duration) Option {
 	return func(c *config) {
 		c.granularity = period
 	}
 }
+
+// WithClock sets source of time, which drives expiration of entries. It
+// allows tests to control time without sleeping.
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// WithManualTicks turns cache to manual mode for deterministic tests, cache
+// performs no background work and its time is advanced only by Cache.Tick
+// and Cache.AdvanceEpoch, which remove entries expired by then. Time starts
+// at current time of clock.
+func WithManualTicks() Option {
+	return func(c *config) {
+		c.manualTicks = true
+	}
+}
@@ -0,0 +1,329 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// OverflowStore is second tier of cache, which keeps entries evicted from
+// memory by policy, e.g. file of embedded key-value database. Keys and
+// values are encoded by encoding/gob. Store is accessed under cache lock,
+// so it should be local and fast. Store configured by WithEvictionSpill is
+// written by background goroutine, so it must be safe for concurrent use.
+type OverflowStore interface {
+	// Put stores value by key, zero deadline means that value does not expire.
+	Put(key, value []byte, deadline time.Time) error
+	// Get returns value by key and its deadline, ok is false if key is missing.
+	Get(key []byte) (value []byte, deadline time.Time, ok bool, err error)
+	// Delete removes value by key, missing key is not an error.
+	Delete(key []byte) error
+}
+
+// overflow encodes entries of cache stored to overflow store. In async
+// mode writes are queued to single writer, pending holds latest queued
+// write by key, so it is visible to reads before it is written to store.
+type overflow[K comparable, V any] struct {
+	store  OverflowStore
+	writer *dispatcher
+	logger *slog.Logger
+
+	lock    sync.Mutex
+	pending map[K]*spillOp[V]
+}
+
+// spillOp is queued write of overflow store.
+type spillOp[V any] struct {
+	value    V
+	deadline time.Time
+	deleted  bool
+}
+
+func newOverflow[K comparable, V any](store OverflowStore, async bool, logger *slog.Logger) *overflow[K, V] {
+	if store == nil {
+		return nil
+	}
+	o := &overflow[K, V]{store: store, logger: logger}
+	if async {
+		o.writer = newDispatcher(1, spillQueueSize)
+		o.pending = make(map[K]*spillOp[V])
+	}
+	return o
+}
+
+func (o *overflow[K, V]) put(key K, value V, deadline time.Time) error {
+	if o.writer != nil {
+		o.enqueue(key, &spillOp[V]{value: value, deadline: deadline})
+		return nil
+	}
+	return o.write(key, value, deadline)
+}
+
+func (o *overflow[K, V]) write(key K, value V, deadline time.Time) error {
+	k, err := encodeGob(key)
+	if err != nil {
+		return err
+	}
+	v, err := encodeGob(value)
+	if err != nil {
+		return err
+	}
+	return o.store.Put(k, v, deadline)
+}
+
+func (o *overflow[K, V]) get(key K) (value V, deadline time.Time, ok bool, err error) {
+	if o.writer != nil {
+		o.lock.Lock()
+		op, queued := o.pending[key]
+		o.lock.Unlock()
+		if queued {
+			return op.value, op.deadline, !op.deleted, nil
+		}
+	}
+
+	k, err := encodeGob(key)
+	if err != nil {
+		return value, deadline, false, err
+	}
+	v, deadline, ok, err := o.store.Get(k)
+	if err != nil || !ok {
+		return value, deadline, false, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&value); err != nil {
+		return value, deadline, false, err
+	}
+	return value, deadline, true, nil
+}
+
+func (o *overflow[K, V]) delete(key K) error {
+	if o.writer != nil {
+		o.enqueue(key, &spillOp[V]{deleted: true})
+		return nil
+	}
+	return o.remove(key)
+}
+
+func (o *overflow[K, V]) remove(key K) error {
+	k, err := encodeGob(key)
+	if err != nil {
+		return err
+	}
+	return o.store.Delete(k)
+}
+
+// enqueue queues write by key, writer is notified only if key has no
+// queued write yet, otherwise queued write is replaced.
+func (o *overflow[K, V]) enqueue(key K, op *spillOp[V]) {
+	o.lock.Lock()
+	_, queued := o.pending[key]
+	o.pending[key] = op
+	o.lock.Unlock()
+
+	if !queued {
+		o.writer.dispatch(func() { o.flush(key) })
+	}
+}
+
+// flush writes queued writes by key until none is left.
+func (o *overflow[K, V]) flush(key K) {
+	for {
+		o.lock.Lock()
+		op, queued := o.pending[key]
+		o.lock.Unlock()
+		if !queued {
+			return
+		}
+
+		var err error
+		if op.deleted {
+			err = o.remove(key)
+		} else {
+			err = o.write(key, op.value, op.deadline)
+		}
+		if err != nil {
+			logWarn(o.logger, "ttlcache: write to overflow store failed", slog.Any("error", err))
+		}
+
+		o.lock.Lock()
+		done := o.pending[key] == op
+		if done {
+			delete(o.pending, key)
+		}
+		o.lock.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// close waits for queued writes.
+func (o *overflow[K, V]) close() {
+	if o.writer != nil {
+		o.writer.close()
+	}
+}
+
+func encodeGob(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// spill moves entry evicted by policy to overflow store and to L2 of
+// tiered cache.
+func (c *Cache[K, V]) spill(key K, item *entry[V]) {
+	if c.demote != nil {
+		c.demoteEvicted(key, item)
+	}
+	if c.overflow == nil {
+		return
+	}
+	if err := c.overflow.put(key, item.value, item.deadline); err != nil {
+		logWarn(c.logger, "ttlcache: spill of evicted entry failed", slog.Any("error", err))
+	}
+}
+
+// demoteEvicted moves evicted entry to L2 of tiered cache, unless entry is
+// already expired. Demotion runs after cache lock is released, so I/O of
+// L2 does not block cache.
+func (c *Cache[K, V]) demoteEvicted(key K, item *entry[V]) {
+	var ttl time.Duration
+	if !item.deadline.IsZero() {
+		if ttl = item.deadline.Sub(c.clock.Now()); ttl <= 0 {
+			return
+		}
+	}
+	demote, value := c.demote, item.value
+	c.deferred = append(c.deferred, func() {
+		if err := demote(key, value, ttl); err != nil {
+			logWarn(c.logger, "ttlcache: demotion of evicted entry failed", slog.Any("error", err))
+		}
+	})
+}
+
+// dropOverflow removes entry removed from memory from overflow store,
+// so its stale value is not read back.
+func (c *Cache[K, V]) dropOverflow(key K) {
+	if c.overflow == nil {
+		return
+	}
+	if err := c.overflow.delete(key); err != nil {
+		logWarn(c.logger, "ttlcache: delete from overflow store failed", slog.Any("error", err))
+	}
+}
+
+// readOverflow returns value missed in memory from overflow store and
+// promotes it back to memory.
+func (c *Cache[K, V]) readOverflow(key K) (V, bool) {
+	var v V
+	if c.overflow == nil {
+		return v, false
+	}
+
+	c.acquire()
+	defer c.release()
+
+	// NOTE: key could be set while lock was released.
+	if item, ok := c.peek(key); ok {
+		return item.value, true
+	}
+	value, deadline, ok, err := c.overflow.get(key)
+	if err != nil {
+		logWarn(c.logger, "ttlcache: read from overflow store failed", slog.Any("error", err))
+		return v, false
+	}
+	if !ok {
+		return v, false
+	}
+	c.dropOverflow(key)
+	if !deadline.IsZero() && !deadline.After(c.clock.Now()) {
+		return v, false
+	}
+	c.quietly(func() {
+		if deadline.IsZero() {
+			c.set(key, value)
+		} else {
+			c.setWithDeadline(key, value, deadline)
+		}
+	})
+	return value, true
+}
+
+// dirStore is overflow store, which keeps each entry in separate file of
+// directory named by hash of key.
+type dirStore struct {
+	dir string
+}
+
+// NewDirStore returns overflow store, which keeps entries in files of given
+// directory, directory is created if it does not exist.
+func NewDirStore(dir string) (OverflowStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cache: create overflow directory: %w", err)
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+func (s *dirStore) Put(key, value []byte, deadline time.Time) error {
+	f, err := os.CreateTemp(s.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	var header [8]byte
+	if !deadline.IsZero() {
+		binary.BigEndian.PutUint64(header[:], uint64(deadline.UnixNano()))
+	}
+	_, err = f.Write(append(header[:], value...))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *dirStore) Get(key []byte) ([]byte, time.Time, bool, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if len(data) < 8 {
+		return nil, time.Time{}, false, fmt.Errorf("cache: malformed overflow entry %s", s.path(key))
+	}
+
+	var deadline time.Time
+	if nanos := binary.BigEndian.Uint64(data[:8]); nanos != 0 {
+		deadline = time.Unix(0, int64(nanos))
+	}
+	return data[8:], deadline, true, nil
+}
+
+func (s *dirStore) Delete(key []byte) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *dirStore) path(key []byte) string {
+	sum := sha256.Sum256(key)
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
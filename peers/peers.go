@@ -0,0 +1,193 @@
+// Package peers implements groupcache-style filling of cache by group of
+// peers: each key is owned by single peer selected by consistent hashing,
+// value missed by other peers is requested from owner over HTTP, so it is
+// loaded from backend once across whole fleet.
+package peers
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+	"github.com/moeryomenko/ttlcache/internal/ring"
+)
+
+// Loader loads value by key from backend with its expiration time.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, time.Duration, error)
+
+// Option is an option that can be applied to pool.
+type Option func(*config)
+
+type config struct {
+	client   *http.Client
+	replicas int
+	logger   *slog.Logger
+}
+
+// WithHTTPClient sets client of requests to peers, http.DefaultClient is
+// used by default.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithReplicas sets number of virtual nodes of each peer on hash ring.
+func WithReplicas(replicas int) Option {
+	return func(c *config) {
+		c.replicas = replicas
+	}
+}
+
+// WithLogger sets logger of failed requests to peers.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// Pool is peer of group, it fills cache by values of owners and serves
+// values of own keys to other peers. Keys are hashed by their string form
+// produced by fmt.Sprint, keys and values are sent in encoding/gob format.
+type Pool[K comparable, V any] struct {
+	cache    *cache.Cache[K, V]
+	self     string
+	load     Loader[K, V]
+	client   *http.Client
+	replicas int
+	logger   *slog.Logger
+
+	lock sync.RWMutex
+	ring *ring.Ring
+}
+
+// NewPool returns peer of group with given base URL, which fills given cache.
+// Pool must be served by HTTP server at self, e.g. by http.Handle, and peers
+// must be set by Set.
+func NewPool[K comparable, V any](c *cache.Cache[K, V], self string, load Loader[K, V], opts ...Option) *Pool[K, V] {
+	cfg := config{client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Pool[K, V]{
+		cache:    c,
+		self:     self,
+		load:     load,
+		client:   cfg.client,
+		replicas: cfg.replicas,
+		logger:   cfg.logger,
+		ring:     ring.New(cfg.replicas),
+	}
+}
+
+// Set replaces peers of group by given base URLs, which should include self.
+func (p *Pool[K, V]) Set(peers ...string) {
+	r := ring.New(p.replicas)
+	r.Add(peers...)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.ring = r
+}
+
+// Get returns value by key from cache, missed value is requested from peer
+// owning key or loaded from backend if key is owned by self. Value is loaded
+// from backend also if owner fails, so unavailable peer does not fail reads.
+// Concurrent callers of same missing key wait for single fill.
+func (p *Pool[K, V]) Get(ctx context.Context, key K) (V, error) {
+	return p.cache.GetOrComputeCtx(ctx, key, func() (V, time.Duration, error) {
+		if owner := p.owner(key); owner != "" && owner != p.self {
+			value, ttl, err := p.fetch(ctx, owner, key)
+			if err == nil {
+				return value, ttl, nil
+			}
+			if p.logger != nil {
+				p.logger.LogAttrs(ctx, slog.LevelWarn, "peers: fill from owner failed",
+					slog.String("peer", owner), slog.Any("error", err))
+			}
+		}
+		return p.load(ctx, key)
+	})
+}
+
+func (p *Pool[K, V]) owner(key K) string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.ring.Get(fmt.Sprint(key))
+}
+
+// response is value served to peer with its remaining time to live, value
+// without expiration time is served with zero TTL and expires in cache of
+// peer as value computed with zero TTL by GetOrCompute.
+type response[V any] struct {
+	Value V
+	TTL   time.Duration
+}
+
+func (p *Pool[K, V]) fetch(ctx context.Context, peer string, key K) (V, time.Duration, error) {
+	var v V
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(key); err != nil {
+		return v, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer, &body)
+	if err != nil {
+		return v, 0, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return v, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return v, 0, fmt.Errorf("peers: peer responded %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var r response[V]
+	if err := gob.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return v, 0, fmt.Errorf("peers: decode response: %w", err)
+	}
+	return r.Value, r.TTL, nil
+}
+
+// ServeHTTP serves values of keys requested by peers, missed values are
+// loaded from backend, since key is requested only from its owner.
+func (p *Pool[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var key K
+	if err := gob.NewDecoder(r.Body).Decode(&key); err != nil {
+		http.Error(w, fmt.Sprintf("peers: decode key: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	value, err := p.cache.GetOrComputeCtx(r.Context(), key, func() (V, time.Duration, error) {
+		return p.load(r.Context(), key)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	ttl, _ := p.cache.GetTTL(key)
+
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(response[V]{Value: value, TTL: ttl}); err != nil {
+		http.Error(w, fmt.Sprintf("peers: encode value: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body.Bytes())
+}
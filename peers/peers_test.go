@@ -0,0 +1,76 @@
+package peers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+func Test_Pool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lock sync.Mutex
+	loads := map[string]int{}
+	load := func(_ context.Context, key string) (string, time.Duration, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		loads[key]++
+		return `value of ` + key, time.Hour, nil
+	}
+
+	pools := make([]*Pool[string, string], 3)
+	urls := make([]string, len(pools))
+	for i := range pools {
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		urls[i] = server.URL
+		pools[i] = NewPool(cache.NewCache[string, string](ctx, 100), server.URL, load)
+	}
+	for _, pool := range pools {
+		pool.Set(urls...)
+	}
+
+	for i := 0; i < 30; i++ {
+		key := strconv.Itoa(i)
+		for _, pool := range pools {
+			if value, err := pool.Get(ctx, key); err != nil || value != `value of `+key {
+				t.Fatalf(`expected value of %s, got %q, %v`, key, value, err)
+			}
+		}
+	}
+	for key, n := range loads {
+		if n != 1 {
+			t.Fatalf(`expected single load of %s across group, got %d`, key, n)
+		}
+	}
+	if len(loads) != 30 {
+		t.Fatalf(`expected all keys loaded, got %d`, len(loads))
+	}
+
+	// NOTE: unavailable owner does not fail reads.
+	pool := NewPool(cache.NewCache[string, string](ctx, 100), `self`, load)
+	pool.Set(`self`, `http://127.0.0.1:0`)
+	for i := 0; i < 10; i++ {
+		if _, err := pool.Get(ctx, `missing `+strconv.Itoa(i)); err != nil {
+			t.Fatalf(`expected fallback to local load, got %v`, err)
+		}
+	}
+
+	failing := NewPool(cache.NewCache[string, string](ctx, 100), `self`, func(context.Context, string) (string, time.Duration, error) {
+		return ``, 0, errors.New(`backend failed`)
+	})
+	if _, err := failing.Get(ctx, `key`); err == nil {
+		t.Fatal(`expected load error`)
+	}
+}
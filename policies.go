@@ -1,5 +1,7 @@
 package cache
 
+import "github.com/moeryomenko/ttlcache/internal/policies"
+
 const (
 	// Discards the least recently used items first.
 	LRU evictionPolicy = iota
@@ -9,7 +11,87 @@ const (
 	ARC
 	// Noop cache without replacement policy.
 	NOOP
+	// Window TinyLFU policy, admits items by estimated frequency.
+	TinyLFU
+	// Discards items with the lowest access count divided by age first.
+	Hyperbolic
 )
 
 // evictionPolicy incapsulated from user.
 type evictionPolicy int
+
+func newReplacementCacher[K comparable, V any](policy evictionPolicy, capacity int, onEvict func(key K, value V)) Policy[K, V] {
+	switch policy {
+	case LRU:
+		return policies.NewLRUCache[K, V](capacity, onEvict)
+	case LFU:
+		return policies.NewLFUCache[K, V](capacity, onEvict)
+	case ARC:
+		return policies.NewARCCache[K, V](capacity, onEvict)
+	case TinyLFU:
+		return policies.NewTinyLFUCache[K, V](capacity, onEvict)
+	case Hyperbolic:
+		return policies.NewHyperbolicCache[K, V](capacity, onEvict)
+	case NOOP:
+		return policies.NewNoEvictionCache[K, V](capacity)
+	default:
+		panic("Unknown eviction policy")
+	}
+}
+
+// NewTinyLFUAdmission returns admission filter for cache of given capacity,
+// which admits new key only if it is accessed more frequently than eviction
+// victim. Frequency is estimated by count-min sketch guarded by doorkeeper
+// bloom filter, so keys accessed once do not displace frequently used keys.
+func NewTinyLFUAdmission(capacity int) Admission {
+	return policies.NewTinyLFUAdmission(capacity)
+}
+
+// PolicyFactory creates custom replacement policy with given capacity,
+// policy must call onEvict for each evicted entry. Policy stores values
+// of cache entries as opaque any values.
+type PolicyFactory[K comparable] func(capacity int, onEvict func(key K, value any)) Policy[K, any]
+
+// customPolicy adapts custom policy storing opaque values to cache entries.
+type customPolicy[K comparable, V any] struct {
+	Policy[K, any]
+}
+
+func newCustomPolicy[K comparable, V any](factory any, capacity int, onEvict func(key K, value *entry[V])) Policy[K, *entry[V]] {
+	typed, ok := factory.(PolicyFactory[K])
+	if !ok {
+		panic("Policy factory type does not match cache key type")
+	}
+	return customPolicy[K, V]{
+		Policy: typed(capacity, func(key K, value any) {
+			onEvict(key, value.(*entry[V]))
+		}),
+	}
+}
+
+func (p customPolicy[K, V]) Set(key K, value *entry[V]) {
+	p.Policy.Set(key, value)
+}
+
+func (p customPolicy[K, V]) Get(key K) (*entry[V], bool) {
+	value, ok := p.Policy.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return value.(*entry[V]), true
+}
+
+func (p customPolicy[K, V]) Peek(key K) (*entry[V], bool) {
+	value, ok := p.Policy.Peek(key)
+	if !ok {
+		return nil, false
+	}
+	return value.(*entry[V]), true
+}
+
+// Resize resizes custom policy if it implements Resizer.
+func (p customPolicy[K, V]) Resize(capacity int) {
+	if resizer, ok := p.Policy.(Resizer); ok {
+		resizer.Resize(capacity)
+	}
+}
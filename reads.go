@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// readBufferSize is number of reads buffered by single stripe, which are
+// applied to policy by reader blocking on cache lock. Half of it is applied
+// opportunistically if cache lock is free.
+const readBufferSize = 64
+
+// readStripes is number of stripes of read buffer, must be power of two.
+const readStripes = 16
+
+// read is lookup of key made without cache lock.
+type read[K comparable] struct {
+	key K
+	hit bool
+}
+
+// readBuffer collects lookups made without cache lock, which are applied to
+// eviction policy and metrics under cache lock in batches, so readers do
+// not contend on cache lock for each lookup. Buffer is striped by key hash,
+// so readers of different keys do not contend on buffer either.
+// See: https://ieeexplore.ieee.org/document/4812418 (BP-Wrapper).
+type readBuffer[K comparable] struct {
+	stripes [readStripes]readStripe[K]
+}
+
+type readStripe[K comparable] struct {
+	lock  sync.Mutex
+	reads []read[K]
+	// spare is drained buffer reused by next drain.
+	spare []read[K]
+	// hits and misses count lookups, which are not buffered.
+	hits, misses atomic.Int64
+	// NOTE: padding keeps stripes on separate cache lines.
+	_ [64]byte
+}
+
+func newReadBuffer[K comparable]() *readBuffer[K] {
+	b := &readBuffer[K]{}
+	for i := range b.stripes {
+		b.stripes[i].reads = make([]read[K], 0, readBufferSize)
+		b.stripes[i].spare = make([]read[K], 0, readBufferSize)
+	}
+	return b
+}
+
+// push records lookup to stripe of given key hash and returns number of
+// reads buffered by stripe.
+func (b *readBuffer[K]) push(hash uint64, r read[K]) int {
+	s := &b.stripes[hash&(readStripes-1)]
+	s.lock.Lock()
+	s.reads = append(s.reads, r)
+	n := len(s.reads)
+	s.lock.Unlock()
+	return n
+}
+
+// count counts lookup, which does not update policy, to stripe of given
+// key hash.
+func (b *readBuffer[K]) count(hash uint64, hit bool) {
+	s := &b.stripes[hash&(readStripes-1)]
+	if hit {
+		s.hits.Add(1)
+		return
+	}
+	s.misses.Add(1)
+}
+
+// take returns buffered reads, which must be returned by release after
+// they are applied. Must be called under cache lock.
+func (s *readStripe[K]) take() []read[K] {
+	s.lock.Lock()
+	reads := s.reads
+	s.reads = s.spare[:0]
+	s.lock.Unlock()
+	return reads
+}
+
+// release returns applied reads for reuse. Must be called under cache lock.
+func (s *readStripe[K]) release(reads []read[K]) {
+	clear(reads)
+	s.spare = reads[:0]
+}
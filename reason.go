@@ -0,0 +1,34 @@
+package cache
+
+const (
+	// Entry expired by TTL.
+	Expired Reason = iota
+	// Entry evicted by replacement policy.
+	Evicted
+	// Entry removed explicitly.
+	Removed
+	// Entry value replaced by new one.
+	Replaced
+	// Entry removed by clearing of cache.
+	Cleared
+)
+
+// Reason is reason of entry removal from cache.
+type Reason int
+
+func (r Reason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Evicted:
+		return "evicted"
+	case Removed:
+		return "removed"
+	case Replaced:
+		return "replaced"
+	case Cleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,81 @@
+// Package redisbus implements invalidation bus of cache over Redis pub/sub
+// channel, see cache.WithInvalidationBus.
+package redisbus
+
+import (
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// DefaultChannel is channel of invalidations by default.
+const DefaultChannel = "ttlcache.invalidations"
+
+// Conn is connection to Redis, which publishes invalidations of bus and
+// delivers them to subscribed peers. Adapter of client of
+// github.com/redis/go-redis is:
+//
+//	type conn struct{ rdb *redis.Client }
+//
+//	func (c conn) Publish(channel string, msg []byte) error {
+//		return c.rdb.Publish(context.Background(), channel, msg).Err()
+//	}
+//
+//	func (c conn) Subscribe(channel string, handler func([]byte)) (func() error, error) {
+//		sub := c.rdb.Subscribe(context.Background(), channel)
+//		if _, err := sub.Receive(context.Background()); err != nil {
+//			sub.Close()
+//			return nil, err
+//		}
+//		go func() {
+//			for m := range sub.Channel() {
+//				handler([]byte(m.Payload))
+//			}
+//		}()
+//		return sub.Close, nil
+//	}
+type Conn interface {
+	// Publish sends message to channel by PUBLISH.
+	Publish(channel string, msg []byte) error
+	// Subscribe registers handler of messages of channel by SUBSCRIBE,
+	// subscription must be active once it returns. Returned function
+	// cancels subscription.
+	Subscribe(channel string, handler func(msg []byte)) (unsubscribe func() error, err error)
+}
+
+// Option is an option that can be applied to bus.
+type Option func(*bus)
+
+// WithChannel sets channel of invalidations, e.g. to separate caches of
+// different data sharing Redis.
+func WithChannel(channel string) Option {
+	return func(b *bus) {
+		b.channel = channel
+	}
+}
+
+type bus struct {
+	conn    Conn
+	channel string
+}
+
+// New returns invalidation bus over given Redis connection. Redis delivers
+// each message to all subscribers of channel, including publisher, whose
+// own messages are ignored by cache.
+func New(conn Conn, opts ...Option) cache.Bus {
+	b := &bus{conn: conn, channel: DefaultChannel}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *bus) Publish(msg []byte) error {
+	return b.conn.Publish(b.channel, msg)
+}
+
+func (b *bus) Subscribe(handler func(msg []byte)) (func(), error) {
+	unsubscribe, err := b.conn.Subscribe(b.channel, handler)
+	if err != nil {
+		return nil, err
+	}
+	return func() { unsubscribe() }, nil
+}
@@ -0,0 +1,91 @@
+package redisbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// memoryConn is Redis connection, which delivers messages in memory.
+type memoryConn struct {
+	lock     sync.Mutex
+	next     int
+	handlers map[int]subscription
+}
+
+type subscription struct {
+	channel string
+	handler func(msg []byte)
+}
+
+func (c *memoryConn) Publish(channel string, msg []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, sub := range c.handlers {
+		if sub.channel == channel {
+			sub.handler(msg)
+		}
+	}
+	return nil
+}
+
+func (c *memoryConn) Subscribe(channel string, handler func(msg []byte)) (func() error, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	id := c.next
+	c.next++
+	c.handlers[id] = subscription{channel: channel, handler: handler}
+	return func() error {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		delete(c.handlers, id)
+		return nil
+	}, nil
+}
+
+func Test_Bus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := &memoryConn{handlers: map[int]subscription{}}
+	first := cache.NewCache[string, int](ctx, 10, cache.WithInvalidationBus(New(conn, WithChannel(`users`))))
+	second := cache.NewCache[string, int](ctx, 10, cache.WithInvalidationBus(New(conn, WithChannel(`users`))))
+	other := cache.NewCache[string, int](ctx, 10, cache.WithInvalidationBus(New(conn, WithChannel(`orders`))))
+
+	fill := func(c *cache.Cache[string, int]) {
+		c.GetOrCompute(`key`, func() (int, time.Duration, error) { return 1, time.Minute, nil })
+	}
+	fill(second)
+	fill(other)
+	first.Set(`key`, 2)
+
+	deadline := time.Now().Add(time.Second)
+	for second.Contains(`key`) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if second.Contains(`key`) {
+		t.Fatal(`expected key invalidated on peer`)
+	}
+	if !other.Contains(`key`) {
+		t.Fatal(`expected key of other channel kept`)
+	}
+	if value, ok := first.Peek(`key`); !ok || value != 2 {
+		t.Fatal(`expected own invalidation ignored by publisher`)
+	}
+
+	// NOTE: close cancels context of cache, so subscription is cancelled
+	// by both.
+	if err := first.Close(); err != nil {
+		t.Fatalf(`unexpected close error: %v`, err)
+	}
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if len(conn.handlers) != 2 {
+		t.Fatalf(`expected subscription cancelled on close, got %d`, len(conn.handlers))
+	}
+}
@@ -0,0 +1,392 @@
+// Package resp implements minimal server of Redis protocol (RESP) backed by
+// cache, so Redis clients of any language talk to embedded cache, e.g. in
+// tests and local development. Supported commands are PING, GET, SET with
+// EX and PX options, SETEX, DEL, TTL and EXPIRE.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+const (
+	// maxBulkSize is maximal size of argument of command.
+	maxBulkSize = 16 << 20
+	// maxArgs is maximal number of arguments of command.
+	maxArgs = 1 << 16
+	// readChunk is maximal size by which buffers of command are grown, so
+	// buffers are allocated as data is read instead of by declared lengths.
+	readChunk = 64 << 10
+)
+
+var errClosed = errors.New("resp: server closed")
+
+// Server serves cache by Redis protocol.
+type Server struct {
+	cache *cache.Cache[string, []byte]
+
+	lock      sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// NewServer returns server of given cache.
+func NewServer(c *cache.Cache[string, []byte]) *Server {
+	return &Server{
+		cache:     c,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections of listener and serves each by own goroutine.
+// It returns error of listener or error of closed server after Close.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return errClosed
+	}
+	defer s.untrack(l, nil)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return errClosed
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return errClosed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(nil, conn)
+			defer conn.Close()
+			s.serve(conn)
+		}()
+	}
+}
+
+// Close closes listeners and connections and waits for connections.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) track(l net.Listener, conn net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if conn != nil {
+		s.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (s *Server) untrack(l net.Listener, conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.listeners, l)
+	delete(s.conns, conn)
+}
+
+func (s *Server) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.closed
+}
+
+// serve executes commands of connection until it is closed. Replies are
+// flushed once pipelined commands are executed.
+func (s *Server) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			var protoErr protocolError
+			if errors.As(err, &protoErr) {
+				writeError(w, string(protoErr))
+				w.Flush()
+			}
+			return
+		}
+		if len(args) > 0 {
+			s.execute(w, args)
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) execute(w *bufio.Writer, args [][]byte) {
+	switch cmd := strings.ToUpper(string(args[0])); cmd {
+	case "PING":
+		if len(args) > 1 {
+			writeBulk(w, args[1])
+			return
+		}
+		w.WriteString("+PONG\r\n")
+	case "GET":
+		if !arity(w, cmd, args, 2) {
+			return
+		}
+		value, ok := s.cache.Get(string(args[1]))
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		writeBulk(w, value)
+	case "SET":
+		s.set(w, args)
+	case "SETEX":
+		if !arity(w, cmd, args, 4) {
+			return
+		}
+		expiry, ok := parseExpiry(w, args[2], time.Second)
+		if !ok {
+			return
+		}
+		s.cache.SetNX(string(args[1]), args[3], expiry)
+		w.WriteString("+OK\r\n")
+	case "DEL":
+		if len(args) < 2 {
+			writeError(w, "ERR wrong number of arguments for 'del' command")
+			return
+		}
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.cache.Pop(string(key)); ok {
+				deleted++
+			}
+		}
+		writeInt(w, int64(deleted))
+	case "TTL":
+		if !arity(w, cmd, args, 2) {
+			return
+		}
+		switch ttl, ok := s.cache.GetTTL(string(args[1])); {
+		case !ok:
+			writeInt(w, -2)
+		case ttl == 0:
+			writeInt(w, -1)
+		default:
+			// NOTE: remaining part of second is rounded up as by Redis.
+			writeInt(w, int64((ttl+time.Second-1)/time.Second))
+		}
+	case "EXPIRE":
+		if !arity(w, cmd, args, 3) {
+			return
+		}
+		seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			return
+		}
+		expiry, ok := toDuration(seconds, time.Second)
+		if !ok {
+			writeError(w, "ERR invalid expire time")
+			return
+		}
+		if s.cache.Expire(string(args[1]), expiry) {
+			writeInt(w, 1)
+			return
+		}
+		writeInt(w, 0)
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// set executes SET key value [EX seconds | PX milliseconds].
+func (s *Server) set(w *bufio.Writer, args [][]byte) {
+	if len(args) != 3 && len(args) != 5 {
+		writeError(w, "ERR syntax error")
+		return
+	}
+	key, value := string(args[1]), args[2]
+	if len(args) == 3 {
+		s.cache.Set(key, value)
+		w.WriteString("+OK\r\n")
+		return
+	}
+
+	var unit time.Duration
+	switch strings.ToUpper(string(args[3])) {
+	case "EX":
+		unit = time.Second
+	case "PX":
+		unit = time.Millisecond
+	default:
+		writeError(w, "ERR syntax error")
+		return
+	}
+	expiry, ok := parseExpiry(w, args[4], unit)
+	if !ok {
+		return
+	}
+	s.cache.SetNX(key, value, expiry)
+	w.WriteString("+OK\r\n")
+}
+
+// protocolError is malformed request, connection is closed after reply.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readCommand reads command as array of bulk strings or as inline command
+// separated by spaces.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		fields := strings.Fields(string(line))
+		args := make([][]byte, len(fields))
+		for i, field := range fields {
+			args[i] = []byte(field)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, protocolError("ERR Protocol error: invalid multibulk length")
+	}
+	args := make([][]byte, 0, min(max(n, 0), 16))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("ERR Protocol error: expected '$', got '%s'", line))
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, protocolError("ERR Protocol error: invalid bulk length")
+		}
+		arg, err := readBulk(r, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk reads bulk string of given size with terminator. Buffer is grown
+// by readChunk as data is read, so declared size is not allocated before
+// payload is received.
+func readBulk(r *bufio.Reader, size int) ([]byte, error) {
+	// NOTE: each argument has own buffer, so values are set to cache
+	// without copying.
+	arg := make([]byte, 0, min(size+2, readChunk))
+	for len(arg) < size+2 {
+		n := min(size+2-len(arg), readChunk)
+		arg = slices.Grow(arg, n)
+		if _, err := io.ReadFull(r, arg[len(arg):len(arg)+n]); err != nil {
+			return nil, err
+		}
+		arg = arg[:len(arg)+n]
+	}
+	return arg[:size], nil
+}
+
+// readLine reads line terminated by CRLF without terminator.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolError("ERR Protocol error: too big inline request")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(line), "\r\n")), nil
+}
+
+func arity(w *bufio.Writer, cmd string, args [][]byte, n int) bool {
+	if len(args) == n {
+		return true
+	}
+	writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+	return false
+}
+
+// parseExpiry parses positive expiration time in given units, values which
+// overflow duration are rejected as by Redis.
+func parseExpiry(w *bufio.Writer, arg []byte, unit time.Duration) (time.Duration, bool) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || n <= 0 {
+		writeError(w, "ERR invalid expire time")
+		return 0, false
+	}
+	expiry, ok := toDuration(n, unit)
+	if !ok {
+		writeError(w, "ERR invalid expire time")
+	}
+	return expiry, ok
+}
+
+// toDuration converts n units to duration, it reports false on overflow.
+func toDuration(n int64, unit time.Duration) (time.Duration, bool) {
+	limit := int64(math.MaxInt64 / unit)
+	if n > limit || n < -limit {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
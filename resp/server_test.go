@@ -0,0 +1,81 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+func Test_Server(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatalf(`unexpected listen error: %v`, err)
+	}
+	server := NewServer(cache.NewCache[string, []byte](ctx, 10))
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(l) }()
+
+	conn, err := net.Dial(`tcp`, l.Addr().String())
+	if err != nil {
+		t.Fatalf(`unexpected dial error: %v`, err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// NOTE: value is bigger than chunk by which buffers are grown.
+	big := strings.Repeat(`v`, readChunk*2+1)
+	// NOTE: commands are pipelined, replies are read in order.
+	requests := []struct{ cmd, reply string }{
+		{"PING\r\n", "+PONG\r\n"},
+		{"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", "+OK\r\n"},
+		{"*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$5\r\nvalue\r\n"},
+		{"TTL key\r\n", ":-1\r\n"},
+		{"EXPIRE key 100\r\n", ":1\r\n"},
+		{"TTL key\r\n", ":100\r\n"},
+		{"SET other value PX 5000\r\n", "+OK\r\n"},
+		{"TTL other\r\n", ":5\r\n"},
+		{"SETEX third 10 value\r\n", "+OK\r\n"},
+		{"DEL key other missing\r\n", ":2\r\n"},
+		{"GET key\r\n", "$-1\r\n"},
+		{"TTL key\r\n", ":-2\r\n"},
+		{"EXPIRE missing 10\r\n", ":0\r\n"},
+		{"SETEX third 0 value\r\n", "-ERR invalid expire time\r\n"},
+		{"SETEX third 9223372036854775807 value\r\n", "-ERR invalid expire time\r\n"},
+		{"SET third value EX 9223372037\r\n", "-ERR invalid expire time\r\n"},
+		{"EXPIRE third -9223372036854775807\r\n", "-ERR invalid expire time\r\n"},
+		{"*3\r\n$3\r\nSET\r\n$3\r\nbig\r\n$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n", "+OK\r\n"},
+		{"*2\r\n$3\r\nGET\r\n$3\r\nbig\r\n", "$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n"},
+		{"GET\r\n", "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"FLUSHALL\r\n", "-ERR unknown command 'FLUSHALL'\r\n"},
+	}
+	var pipeline strings.Builder
+	for _, req := range requests {
+		pipeline.WriteString(req.cmd)
+	}
+	if _, err := conn.Write([]byte(pipeline.String())); err != nil {
+		t.Fatalf(`unexpected write error: %v`, err)
+	}
+	for _, req := range requests {
+		reply := make([]byte, len(req.reply))
+		if _, err := io.ReadFull(r, reply); err != nil {
+			t.Fatalf(`unexpected read error: %v`, err)
+		}
+		if string(reply) != req.reply {
+			t.Fatalf(`expected reply %q to %q, got %q`, req.reply, req.cmd, reply)
+		}
+	}
+
+	server.Close()
+	if err := <-served; err != errClosed {
+		t.Fatalf(`expected closed server, got %v`, err)
+	}
+}
@@ -0,0 +1,313 @@
+//go:build unix
+
+// Package shm implements experimental cache of byte values by string keys,
+// which is stored in memory-mapped file, so several processes of one host,
+// e.g. workers of pre-fork server, share it. Entries have fixed maximal
+// size of key and value. Table is set-associative: key is hashed to bucket
+// of several slots guarded by spin lock in shared memory, full bucket
+// evicts entry which expires first. Process crashed while holding lock of
+// bucket leaves it locked, so file should be recreated after crash.
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	magic      = 0x7474_6c73_686d_0001
+	headerSize = 64
+	// bucketHeaderSize is size of lock of bucket padded to 8 bytes.
+	bucketHeaderSize = 8
+	// slotHeaderSize is size of state, hash, deadline and lengths of
+	// key and value of slot.
+	slotHeaderSize = 32
+
+	defaultCapacity     = 1024
+	defaultWays         = 8
+	defaultMaxKeySize   = 64
+	defaultMaxValueSize = 1024
+)
+
+var (
+	errTooLarge  = errors.New("shm: key or value exceeds maximal size")
+	errMalformed = errors.New("shm: file is not cache segment")
+	errGeometry  = errors.New("shm: invalid geometry of segment")
+)
+
+// Option is an option that can be applied to segment created by Open.
+type Option func(*geometry)
+
+// geometry is layout of segment, which is stored in its header.
+type geometry struct {
+	buckets      int
+	ways         int
+	maxKeySize   int
+	maxValueSize int
+}
+
+// WithCapacity sets number of entries of segment.
+func WithCapacity(n int) Option {
+	return func(g *geometry) {
+		g.buckets = max((n+g.ways-1)/g.ways, 1)
+	}
+}
+
+// WithMaxKeySize sets maximal size of key in bytes, it must be positive.
+func WithMaxKeySize(size int) Option {
+	return func(g *geometry) {
+		g.maxKeySize = size
+	}
+}
+
+// WithMaxValueSize sets maximal size of value in bytes, it must be
+// positive.
+func WithMaxValueSize(size int) Option {
+	return func(g *geometry) {
+		g.maxValueSize = size
+	}
+}
+
+// valid reports whether fields of geometry are positive, fit header and
+// size of segment does not overflow.
+func (g geometry) valid() bool {
+	for _, n := range []int{g.buckets, g.ways, g.maxKeySize, g.maxValueSize} {
+		if n <= 0 || uint64(n) > math.MaxUint32 {
+			return false
+		}
+	}
+	return g.ways <= (math.MaxInt-bucketHeaderSize)/g.slotSize() &&
+		g.buckets <= (math.MaxInt-headerSize)/g.bucketSize()
+}
+
+func (g geometry) slotSize() int {
+	return (slotHeaderSize + g.maxKeySize + g.maxValueSize + 7) &^ 7
+}
+
+func (g geometry) bucketSize() int {
+	return bucketHeaderSize + g.ways*g.slotSize()
+}
+
+func (g geometry) size() int {
+	return headerSize + g.buckets*g.bucketSize()
+}
+
+// Cache is cache in shared memory segment.
+type Cache struct {
+	geometry
+	file *os.File
+	data []byte
+}
+
+// Open maps segment of given file, file is created with geometry set by
+// options if it is missing or empty, otherwise geometry of existing
+// segment is used and options are ignored.
+func Open(path string, opts ...Option) (*Cache, error) {
+	g := geometry{ways: defaultWays, maxKeySize: defaultMaxKeySize, maxValueSize: defaultMaxValueSize}
+	WithCapacity(defaultCapacity)(&g)
+	for _, opt := range opts {
+		opt(&g)
+	}
+	if !g.valid() {
+		return nil, errGeometry
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("shm: open segment: %w", err)
+	}
+	// NOTE: lock of file serializes initialization of segment.
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("shm: lock segment: %w", err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	c, err := mapSegment(f, g)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func mapSegment(f *os.File, g geometry) (*Cache, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("shm: stat segment: %w", err)
+	}
+	created := info.Size() == 0
+	if created {
+		if err := f.Truncate(int64(g.size())); err != nil {
+			return nil, fmt.Errorf("shm: resize segment: %w", err)
+		}
+	} else {
+		var header [headerSize]byte
+		if _, err := f.ReadAt(header[:], 0); err != nil {
+			return nil, fmt.Errorf("shm: read header: %w", err)
+		}
+		if binary.LittleEndian.Uint64(header[0:]) != magic {
+			return nil, errMalformed
+		}
+		g = geometry{
+			buckets:      int(binary.LittleEndian.Uint32(header[8:])),
+			ways:         int(binary.LittleEndian.Uint32(header[12:])),
+			maxKeySize:   int(binary.LittleEndian.Uint32(header[16:])),
+			maxValueSize: int(binary.LittleEndian.Uint32(header[20:])),
+		}
+		// NOTE: geometry is validated before use, so corrupted header
+		// does not break indexing of buckets.
+		if !g.valid() || int64(g.size()) != info.Size() {
+			return nil, errMalformed
+		}
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, g.size(), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("shm: map segment: %w", err)
+	}
+	if created {
+		binary.LittleEndian.PutUint32(data[8:], uint32(g.buckets))
+		binary.LittleEndian.PutUint32(data[12:], uint32(g.ways))
+		binary.LittleEndian.PutUint32(data[16:], uint32(g.maxKeySize))
+		binary.LittleEndian.PutUint32(data[20:], uint32(g.maxValueSize))
+		binary.LittleEndian.PutUint64(data[0:], magic)
+	}
+	return &Cache{geometry: g, file: f, data: data}, nil
+}
+
+// Close unmaps segment, entries are kept in file.
+func (c *Cache) Close() error {
+	err := syscall.Munmap(c.data)
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Get returns copy of value by key.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	hash := hashKey(key)
+	bucket := c.lock(hash)
+	defer c.unlock(bucket)
+
+	slot, ok := c.find(bucket, hash, key, time.Now().UnixNano())
+	if !ok {
+		return nil, false
+	}
+	keyLen := binary.LittleEndian.Uint32(c.data[slot+24:])
+	valueLen := binary.LittleEndian.Uint32(c.data[slot+28:])
+	start := slot + slotHeaderSize + int(keyLen)
+	return append([]byte(nil), c.data[start:start+int(valueLen)]...), true
+}
+
+// Set sets value by key with given time to live, non-positive TTL means
+// that entry is removed only by eviction.
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) error {
+	if len(key) > c.maxKeySize || len(value) > c.maxValueSize {
+		return errTooLarge
+	}
+	var deadline int64
+	now := time.Now().UnixNano()
+	if ttl > 0 {
+		deadline = now + int64(ttl)
+	}
+
+	hash := hashKey(key)
+	bucket := c.lock(hash)
+	defer c.unlock(bucket)
+
+	slot, ok := c.find(bucket, hash, key, now)
+	if !ok {
+		slot = c.victim(bucket, now)
+	}
+	binary.LittleEndian.PutUint64(c.data[slot+8:], hash)
+	binary.LittleEndian.PutUint64(c.data[slot+16:], uint64(deadline))
+	binary.LittleEndian.PutUint32(c.data[slot+24:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(c.data[slot+28:], uint32(len(value)))
+	copy(c.data[slot+slotHeaderSize:], key)
+	copy(c.data[slot+slotHeaderSize+len(key):], value)
+	binary.LittleEndian.PutUint32(c.data[slot:], 1)
+	return nil
+}
+
+// Remove removes entry by key.
+func (c *Cache) Remove(key string) {
+	hash := hashKey(key)
+	bucket := c.lock(hash)
+	defer c.unlock(bucket)
+
+	if slot, ok := c.find(bucket, hash, key, time.Now().UnixNano()); ok {
+		binary.LittleEndian.PutUint32(c.data[slot:], 0)
+	}
+}
+
+// find returns offset of live slot of key in bucket.
+func (c *Cache) find(bucket int, hash uint64, key string, now int64) (int, bool) {
+	for i := 0; i < c.ways; i++ {
+		slot := bucket + bucketHeaderSize + i*c.slotSize()
+		if binary.LittleEndian.Uint32(c.data[slot:]) == 0 || binary.LittleEndian.Uint64(c.data[slot+8:]) != hash {
+			continue
+		}
+		keyLen := int(binary.LittleEndian.Uint32(c.data[slot+24:]))
+		if string(c.data[slot+slotHeaderSize:slot+slotHeaderSize+keyLen]) != key {
+			continue
+		}
+		if deadline := int64(binary.LittleEndian.Uint64(c.data[slot+16:])); deadline != 0 && deadline <= now {
+			binary.LittleEndian.PutUint32(c.data[slot:], 0)
+			return 0, false
+		}
+		return slot, true
+	}
+	return 0, false
+}
+
+// victim returns offset of free or expired slot of bucket, otherwise of
+// slot which expires first, entries without expiration are evicted last.
+func (c *Cache) victim(bucket int, now int64) int {
+	victim, earliest := -1, uint64(0)
+	for i := 0; i < c.ways; i++ {
+		slot := bucket + bucketHeaderSize + i*c.slotSize()
+		if binary.LittleEndian.Uint32(c.data[slot:]) == 0 {
+			return slot
+		}
+		deadline := binary.LittleEndian.Uint64(c.data[slot+16:])
+		if deadline != 0 && int64(deadline) <= now {
+			return slot
+		}
+		// NOTE: zero deadline wraps to maximal value.
+		if deadline-1 < earliest-1 || victim < 0 {
+			victim, earliest = slot, deadline
+		}
+	}
+	return victim
+}
+
+// lock acquires spin lock of bucket by hash and returns offset of bucket.
+func (c *Cache) lock(hash uint64) int {
+	bucket := headerSize + int(hash%uint64(c.buckets))*c.bucketSize()
+	lock := (*uint32)(unsafe.Pointer(&c.data[bucket]))
+	for !atomic.CompareAndSwapUint32(lock, 0, 1) {
+		runtime.Gosched()
+	}
+	return bucket
+}
+
+func (c *Cache) unlock(bucket int) {
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&c.data[bucket])), 0)
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
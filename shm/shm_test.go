@@ -0,0 +1,89 @@
+//go:build unix
+
+package shm
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Cache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `segment`)
+	first, err := Open(path, WithCapacity(16), WithMaxKeySize(16), WithMaxValueSize(16))
+	if err != nil {
+		t.Fatalf(`unexpected open error: %v`, err)
+	}
+	defer first.Close()
+	// NOTE: second mapping of segment stands for another process.
+	second, err := Open(path)
+	if err != nil {
+		t.Fatalf(`unexpected open error: %v`, err)
+	}
+	defer second.Close()
+	if second.maxValueSize != 16 || second.buckets != first.buckets {
+		t.Fatal(`expected geometry of existing segment`)
+	}
+
+	if err := first.Set(`key`, []byte(`value`), 0); err != nil {
+		t.Fatalf(`unexpected set error: %v`, err)
+	}
+	if value, ok := second.Get(`key`); !ok || string(value) != `value` {
+		t.Fatalf(`expected value shared by mappings, got %q`, value)
+	}
+	second.Remove(`key`)
+	if _, ok := first.Get(`key`); ok {
+		t.Fatal(`expected removed value`)
+	}
+
+	first.Set(`short`, []byte(`value`), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := second.Get(`short`); ok {
+		t.Fatal(`expected expired value`)
+	}
+	if err := first.Set(`key`, make([]byte, 17), 0); err != errTooLarge {
+		t.Fatalf(`expected oversized value rejected, got %v`, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range []*Cache{first, second} {
+		wg.Add(1)
+		go func(c *Cache) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Set(strconv.Itoa(i%100), []byte(strconv.Itoa(i)), time.Minute)
+			}
+		}(c)
+	}
+	wg.Wait()
+	found := 0
+	for i := 0; i < 100; i++ {
+		if _, ok := first.Get(strconv.Itoa(i)); ok {
+			found++
+		}
+	}
+	if found == 0 || found > 16 {
+		t.Fatalf(`expected entries limited by capacity, got %d`, found)
+	}
+
+	invalid := filepath.Join(t.TempDir(), `invalid`)
+	os.WriteFile(invalid, make([]byte, 128), 0o600)
+	if _, err := Open(invalid); err != errMalformed {
+		t.Fatalf(`expected malformed segment rejected, got %v`, err)
+	}
+
+	// NOTE: segment without buckets matches size declared by its header.
+	empty := make([]byte, headerSize)
+	binary.LittleEndian.PutUint64(empty, magic)
+	os.WriteFile(invalid, empty, 0o600)
+	if _, err := Open(invalid); err != errMalformed {
+		t.Fatalf(`expected segment without buckets rejected, got %v`, err)
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), `zero`), WithMaxKeySize(0)); err != errGeometry {
+		t.Fatalf(`expected non-positive key size rejected, got %v`, err)
+	}
+}
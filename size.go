@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// entryOverhead is approximate size of internal bookkeeping of single
+// entry: policy item, list element, map bucket slots and TTL slot.
+const entryOverhead = int64(unsafe.Sizeof(entry[struct{}]{})) + 96
+
+// maxSizeDepth limits depth of reflection walk by estimateSize.
+const maxSizeDepth = 8
+
+// estimateEntrySize returns approximate heap size of cache entry with
+// given key and value, including bookkeeping overhead.
+func estimateEntrySize[K comparable, V any](key K, value V) int64 {
+	return entryOverhead + estimateSize(key) + estimateSize(value)
+}
+
+// estimateSize returns approximate size of value by walking it with
+// reflection, shared memory is counted each time it is referenced.
+func estimateSize(value any) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(unsafe.Sizeof(v)) + int64(len(v))
+	case []byte:
+		return int64(unsafe.Sizeof(v)) + int64(cap(v))
+	}
+
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return 0
+	}
+	return int64(rv.Type().Size()) + indirectSize(rv, 0)
+}
+
+// indirectSize returns size of memory referenced by value, excluding
+// size of value itself.
+func indirectSize(v reflect.Value, depth int) int64 {
+	if depth > maxSizeDepth {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int64(elem.Type().Size()) + indirectSize(elem, depth+1)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int64(elem.Type().Size()) + indirectSize(elem, depth+1)
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0
+		}
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += indirectSize(v.Index(i), depth+1)
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += indirectSize(v.Index(i), depth+1)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += indirectSize(v.Field(i), depth+1)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+		size := int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			size += indirectSize(iter.Key(), depth+1) + indirectSize(iter.Value(), depth+1)
+		}
+		return size
+	default:
+		return 0
+	}
+}
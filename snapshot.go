@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotEntry is entry of snapshot, zero TTL means that entry can be
+// evicted only by policy. Snapshot is stream of gob-encoded chunks of
+// entries.
+type snapshotEntry[K comparable, V any] struct {
+	Key    K
+	Value  V
+	TTL    time.Duration
+	Pinned bool
+}
+
+// Snapshot writes entries of cache with their remaining time to live to w
+// in encoding/gob format, expired entries are skipped. Key and value types
+// must be encodable by encoding/gob. Snapshot is streamed by chunks, cache
+// lock is taken only to copy each chunk, so it does not block cache for
+// whole duration. Entries modified during snapshot may be written in any
+// of their states. If operation log configured by WithOperationLog is
+// compacted, it is truncated once snapshot is written successfully and
+// keeps only operations made during snapshot, so log replayed after
+// snapshot restores them. Log is kept intact if snapshot fails.
+func (c *Cache[K, V]) Snapshot(w io.Writer) error {
+	var compact bool
+	if c.oplog != nil {
+		c.acquire()
+		compact = c.oplog.startCompaction()
+		c.release()
+	}
+
+	err := c.writeSnapshot(w)
+	if !compact {
+		return err
+	}
+
+	c.acquire()
+	defer c.release()
+
+	if err != nil {
+		c.oplog.abortCompaction()
+		return err
+	}
+	if err := c.oplog.compact(); err != nil {
+		return fmt.Errorf("cache: compact operation log: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshot streams chunks of entries to w.
+func (c *Cache[K, V]) writeSnapshot(w io.Writer) error {
+	// NOTE: index is iterated without cache lock, entries are copied
+	// under cache lock by chunks.
+	keys := c.index.keys()
+	enc := gob.NewEncoder(w)
+	for len(keys) > 0 {
+		chunk := keys[:min(snapshotChunkSize, len(keys))]
+		keys = keys[len(chunk):]
+
+		c.acquire()
+		entries := c.snapshot(chunk)
+		c.release()
+		if len(entries) == 0 {
+			continue
+		}
+		if err := enc.Encode(entries); err != nil {
+			return fmt.Errorf("cache: encode snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// snapshot copies entries by given keys, which are present and not expired.
+func (c *Cache[K, V]) snapshot(keys []K) []snapshotEntry[K, V] {
+	now := c.clock.Now()
+	entries := make([]snapshotEntry[K, V], 0, len(keys))
+	for _, key := range keys {
+		item, ok := c.peek(key)
+		if !ok {
+			continue
+		}
+		_, pinned := c.pinned[key]
+		var ttl time.Duration
+		if !item.deadline.IsZero() {
+			if ttl = item.deadline.Sub(now); ttl <= 0 && !pinned {
+				continue
+			}
+		}
+		entries = append(entries, snapshotEntry[K, V]{
+			Key: key, Value: item.value, TTL: max(ttl, 0), Pinned: pinned,
+		})
+	}
+	return entries
+}
+
+// RestoreSnapshot reads entries written by Snapshot from r and sets them
+// to cache with their remaining time to live, entries present in cache
+// are kept unless snapshot has the same keys. Pinned entries are pinned
+// again. Snapshot is restored by chunks, so cache serves requests during
+// restore and keeps chunks restored before decoding error.
+func (c *Cache[K, V]) RestoreSnapshot(r io.Reader) error {
+	return c.load(gob.NewDecoder(r), true)
+}
+
+// Load reads entries from r decoded by codec and sets them to cache with
+// their remaining time to live, e.g. to hydrate cache from snapshot of
+// another instance while it serves requests. Unlike RestoreSnapshot it
+// keeps entries present in cache, since they are newer than loaded ones.
+// Entries are set by chunks under cache lock and evicted by policy over
+// capacity as by SetNX.
+func (c *Cache[K, V]) Load(r io.Reader, codec Codec) error {
+	return c.load(codec.NewDecoder(r), false)
+}
+
+// load sets chunks of entries decoded by dec until end of stream, if
+// overwrite is false present entries are kept.
+func (c *Cache[K, V]) load(dec Decoder, overwrite bool) error {
+	for {
+		var entries []snapshotEntry[K, V]
+		err := dec.Decode(&entries)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cache: decode snapshot: %w", err)
+		}
+
+		c.acquire()
+		c.restore(entries, overwrite)
+		c.release()
+	}
+}
+
+func (c *Cache[K, V]) restore(entries []snapshotEntry[K, V], overwrite bool) {
+	for _, e := range entries {
+		if !overwrite {
+			if _, ok := c.peek(e.Key); ok {
+				continue
+			}
+		}
+		if e.TTL > 0 {
+			c.setNX(e.Key, e.Value, e.TTL)
+		} else {
+			c.set(e.Key, e.Value)
+		}
+		if e.Pinned {
+			c.pin(e.Key)
+		}
+	}
+}
+
+// Codec creates decoders of entries read by Cache.Load. Stream consists
+// of chunks, each chunk is sequence of entries with fields Key, Value,
+// TTL, which is remaining time to live in nanoseconds, and Pinned.
+// Zero TTL means that entry can be evicted only by policy.
+type Codec interface {
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder decodes chunk of entries to v, it returns io.EOF at the end of
+// stream. It is implemented by decoders of encoding/gob and encoding/json.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// GobCodec is codec of snapshots written by Cache.Snapshot.
+type GobCodec struct{}
+
+// NewDecoder returns gob decoder of r.
+func (GobCodec) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
+
+// JSONCodec is codec of stream of JSON arrays of entries.
+type JSONCodec struct{}
+
+// NewDecoder returns JSON decoder of r.
+func (JSONCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// loadFile restores snapshot from file configured by WithPersistFile,
+// missing file is not an error.
+func (c *Cache[K, V]) loadFile(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cache: open persist file: %w", err)
+	}
+	defer f.Close()
+
+	return c.RestoreSnapshot(f)
+}
+
+// saveFile writes snapshot to file configured by WithPersistFile. Snapshot
+// is written to temporary file, which replaces persist file, so file is
+// not corrupted by crash during write. Must be called under cache lock.
+func (c *Cache[K, V]) saveFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cache: create persist file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := gob.NewEncoder(f).Encode(c.snapshot(c.keys())); err != nil {
+		f.Close()
+		return fmt.Errorf("cache: encode snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cache: write persist file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("cache: replace persist file: %w", err)
+	}
+	return nil
+}
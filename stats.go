@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// windowSlotWidth is time resolution of recent statistics.
+	windowSlotWidth = 10 * time.Second
+	// windowSlots is number of slots covering 15 minutes.
+	windowSlots = int(15 * time.Minute / windowSlotWidth)
+)
+
+// Stats is snapshot of cache statistics.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Sets        uint64
+	Evictions   uint64
+	Expirations uint64
+	// Len is current size of cache.
+	Len int
+}
+
+// HitRatio returns ratio of hits to all lookups.
+func (s Stats) HitRatio() float64 {
+	lookups := s.Hits + s.Misses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(lookups)
+}
+
+// TTLHistogram is distribution of remaining TTL of cache entries.
+type TTLHistogram struct {
+	// Bounds are inclusive upper bounds of buckets in ascending order.
+	Bounds []time.Duration
+	// Counts are numbers of entries in buckets, last count is number of
+	// entries with remaining TTL greater than last bound.
+	Counts []int
+	// Persistent is number of entries without expiration time.
+	Persistent int
+}
+
+// counters is built-in metrics listener maintaining lifetime statistics.
+type counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+func (c *counters) RecordHit()        { c.hits.Add(1) }
+func (c *counters) RecordMiss()       { c.misses.Add(1) }
+func (c *counters) RecordEviction()   { c.evictions.Add(1) }
+func (c *counters) RecordExpiration() { c.expirations.Add(1) }
+func (c *counters) RecordSet()        { c.sets.Add(1) }
+
+func (c *counters) snapshot() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Sets:        c.sets.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+func (c *counters) reset() {
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.sets.Store(0)
+	c.evictions.Store(0)
+	c.expirations.Store(0)
+}
+
+// window is ring of counters over recent time slots. Slots are rotated
+// by cache janitor, so window must be guarded by cache lock.
+type window struct {
+	slots     [windowSlots]counters
+	current   int
+	slotStart time.Time
+}
+
+func (w *window) RecordHit()        { w.slots[w.current].RecordHit() }
+func (w *window) RecordMiss()       { w.slots[w.current].RecordMiss() }
+func (w *window) RecordEviction()   { w.slots[w.current].RecordEviction() }
+func (w *window) RecordExpiration() { w.slots[w.current].RecordExpiration() }
+func (w *window) RecordSet()        { w.slots[w.current].RecordSet() }
+
+// rotate advances current slot up to given time.
+func (w *window) rotate(now time.Time) {
+	for steps := 0; now.Sub(w.slotStart) >= windowSlotWidth; steps++ {
+		if steps == windowSlots {
+			// NOTE: whole window is outdated.
+			w.slotStart = now
+			return
+		}
+		w.current = (w.current + 1) % windowSlots
+		w.slots[w.current].reset()
+		w.slotStart = w.slotStart.Add(windowSlotWidth)
+	}
+}
+
+// stats returns sum of slots covering given period.
+func (w *window) stats(period time.Duration) Stats {
+	n := int((period + windowSlotWidth - 1) / windowSlotWidth)
+	n = min(max(n, 1), windowSlots)
+
+	var stats Stats
+	for i := 0; i < n; i++ {
+		slot := w.slots[(w.current-i+windowSlots)%windowSlots].snapshot()
+		stats.Hits += slot.Hits
+		stats.Misses += slot.Misses
+		stats.Sets += slot.Sets
+		stats.Evictions += slot.Evictions
+		stats.Expirations += slot.Expirations
+	}
+	return stats
+}
+
+// listeners broadcasts cache events to several listeners.
+type listeners []MetricsListener
+
+func (l listeners) RecordHit() {
+	for _, listener := range l {
+		listener.RecordHit()
+	}
+}
+
+func (l listeners) RecordMiss() {
+	for _, listener := range l {
+		listener.RecordMiss()
+	}
+}
+
+func (l listeners) RecordEviction() {
+	for _, listener := range l {
+		listener.RecordEviction()
+	}
+}
+
+func (l listeners) RecordExpiration() {
+	for _, listener := range l {
+		listener.RecordExpiration()
+	}
+}
+
+func (l listeners) RecordSet() {
+	for _, listener := range l {
+		listener.RecordSet()
+	}
+}
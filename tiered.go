@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Layer is level of multi-level cache composed by NewTiered, e.g. in-memory
+// cache returned by CacheLayer or disk store returned by StoreLayer.
+type Layer[K comparable, V any] interface {
+	// Get returns value by key with its remaining time to live, zero TTL
+	// means that value does not expire.
+	Get(ctx context.Context, key K) (value V, ttl time.Duration, ok bool, err error)
+	// Set stores value by key, zero TTL means that value does not expire.
+	Set(ctx context.Context, key K, value V, ttl time.Duration) error
+	// Remove removes value by key, missing key is not an error.
+	Remove(ctx context.Context, key K) error
+	// Stats returns statistics of layer.
+	Stats() Stats
+}
+
+// TieredOption is an option that can be applied to multi-level cache.
+type TieredOption func(*tieredConfig)
+
+type tieredConfig struct {
+	exclusive bool
+	l1Scale   float64
+	l2Scale   float64
+	promote   any
+}
+
+// WithExclusiveLayers keeps each entry in single layer: Set writes only to
+// L1, entries evicted from L1 are demoted to L2 and entries promoted to L1
+// are removed from L2. Entries evicted from cache returned by CacheLayer
+// are demoted automatically, other layers demote them by Tiered.Demote. By
+// default layers are inclusive: Set writes to both layers.
+func WithExclusiveLayers() TieredOption {
+	return func(c *tieredConfig) {
+		c.exclusive = true
+	}
+}
+
+// WithLayerTTLScale sets factors of TTL of values set to L1 and L2, e.g.
+// to keep values in small L1 shorter than in L2. Non-positive factor is
+// ignored.
+func WithLayerTTLScale(l1, l2 float64) TieredOption {
+	return func(c *tieredConfig) {
+		if l1 > 0 {
+			c.l1Scale = l1
+		}
+		if l2 > 0 {
+			c.l2Scale = l2
+		}
+	}
+}
+
+// WithPromotion sets function, which decides whether value found in L2 is
+// promoted to L1, all values are promoted by default. Key type must match
+// key type of layers.
+func WithPromotion[K comparable](fn func(key K) bool) TieredOption {
+	return func(c *tieredConfig) {
+		c.promote = fn
+	}
+}
+
+// TieredStats is statistics of multi-level cache.
+type TieredStats struct {
+	// Hits is number of values found in any layer.
+	Hits uint64
+	// Misses is number of values missed by all layers.
+	Misses uint64
+	// Promotions is number of values moved from L2 to L1.
+	Promotions uint64
+	// Demotions is number of values moved from L1 to L2.
+	Demotions uint64
+	L1        Stats
+	L2        Stats
+}
+
+// Tiered is multi-level cache of two layers, reads fall through L1 to L2
+// and values found in L2 are promoted to L1.
+type Tiered[K comparable, V any] struct {
+	l1, l2    Layer[K, V]
+	exclusive bool
+	l1Scale   float64
+	l2Scale   float64
+	promote   func(key K) bool
+
+	// lock guards promotions, which are keys promoted in exclusive mode,
+	// so values demoted during promotion are not removed from L2.
+	lock       sync.Mutex
+	promotions map[K]*promotion
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	promoted  atomic.Uint64
+	demotions atomic.Uint64
+}
+
+// promotion is promotion of key in progress.
+type promotion struct {
+	// refs is number of concurrent promotions of key.
+	refs int
+	// demoted reports whether key is demoted during promotion.
+	demoted bool
+}
+
+// NewTiered returns multi-level cache of given layers, l1 is expected to be
+// faster and smaller than l2. In exclusive mode cache returned by
+// CacheLayer can be L1 of single Tiered, NewTiered panics otherwise.
+func NewTiered[K comparable, V any](l1, l2 Layer[K, V], opts ...TieredOption) *Tiered[K, V] {
+	cfg := tieredConfig{l1Scale: 1, l2Scale: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	t := &Tiered[K, V]{
+		l1:         l1,
+		l2:         l2,
+		exclusive:  cfg.exclusive,
+		l1Scale:    cfg.l1Scale,
+		l2Scale:    cfg.l2Scale,
+		promote:    func(K) bool { return true },
+		promotions: make(map[K]*promotion),
+	}
+	if cfg.promote != nil {
+		typed, ok := cfg.promote.(func(key K) bool)
+		if !ok {
+			panic("Promotion function type does not match layer key type")
+		}
+		t.promote = typed
+	}
+	if l1, ok := l1.(cacheLayer[K, V]); ok && t.exclusive {
+		l1.cache.acquire()
+		defer l1.cache.release()
+		if l1.cache.demote != nil {
+			panic("Cache is already L1 of another exclusive Tiered")
+		}
+		l1.cache.demote = func(key K, value V, ttl time.Duration) error {
+			return t.Demote(context.Background(), key, value, ttl)
+		}
+	}
+	return t
+}
+
+// Get returns value by key from first layer holding it, value found in L2
+// is promoted to L1 with its remaining TTL scaled as TTL of L1. In
+// exclusive mode failure to remove promoted value from L2 is returned
+// along with value.
+func (t *Tiered[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	value, _, ok, err := t.l1.Get(ctx, key)
+	if err != nil || ok {
+		if ok {
+			t.hits.Add(1)
+		}
+		return value, ok, err
+	}
+
+	value, ttl, ok, err := t.l2.Get(ctx, key)
+	if err != nil || !ok {
+		t.misses.Add(1)
+		return value, false, err
+	}
+	t.hits.Add(1)
+	if !t.promote(key) {
+		return value, true, nil
+	}
+
+	if ttl > 0 {
+		// NOTE: remaining TTL of L2 is converted to TTL of L1, but value
+		// is not kept in L1 longer than in L2.
+		ttl = max(min(scale(ttl, t.l1Scale/t.l2Scale), ttl), 1)
+	}
+	if !t.exclusive {
+		if t.l1.Set(ctx, key, value, ttl) == nil {
+			t.promoted.Add(1)
+		}
+		return value, true, nil
+	}
+
+	t.beginPromotion(key)
+	if err := t.l1.Set(ctx, key, value, ttl); err != nil {
+		t.endPromotion(ctx, key, false)
+		return value, true, nil
+	}
+	t.promoted.Add(1)
+	if err := t.endPromotion(ctx, key, true); err != nil {
+		return value, true, fmt.Errorf("cache: remove promoted value from L2: %w", err)
+	}
+	return value, true, nil
+}
+
+func (t *Tiered[K, V]) beginPromotion(key K) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	p, ok := t.promotions[key]
+	if !ok {
+		p = &promotion{}
+		t.promotions[key] = p
+	}
+	p.refs++
+}
+
+// endPromotion ends promotion of key and removes promoted value from L2,
+// unless key was demoted to L2 again during promotion. Removal is made
+// under lock, so concurrent demotion of key writes to L2 after it.
+func (t *Tiered[K, V]) endPromotion(ctx context.Context, key K, remove bool) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	p := t.promotions[key]
+	if p.refs--; p.refs == 0 {
+		delete(t.promotions, key)
+	}
+	if !remove || p.demoted {
+		return nil
+	}
+	return t.l2.Remove(ctx, key)
+}
+
+// Set sets value by key to L1 and, unless layers are exclusive, to L2 with
+// given TTL scaled by factors of layers.
+func (t *Tiered[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	if !t.exclusive {
+		if err := t.l2.Set(ctx, key, value, scale(ttl, t.l2Scale)); err != nil {
+			return err
+		}
+	} else if err := t.l2.Remove(ctx, key); err != nil {
+		return err
+	}
+	return t.l1.Set(ctx, key, value, scale(ttl, t.l1Scale))
+}
+
+// Remove removes value by key from both layers.
+func (t *Tiered[K, V]) Remove(ctx context.Context, key K) error {
+	if err := t.l1.Remove(ctx, key); err != nil {
+		return err
+	}
+	return t.l2.Remove(ctx, key)
+}
+
+// Demote moves value evicted from L1 to L2 with given remaining TTL, e.g.
+// by removal callback of L1 layer in exclusive mode. Cache returned by
+// CacheLayer calls it automatically.
+func (t *Tiered[K, V]) Demote(ctx context.Context, key K, value V, ttl time.Duration) error {
+	if ttl > 0 {
+		ttl = max(scale(ttl, t.l2Scale/t.l1Scale), 1)
+	}
+	t.lock.Lock()
+	if p, ok := t.promotions[key]; ok {
+		p.demoted = true
+	}
+	t.lock.Unlock()
+	if err := t.l2.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	t.demotions.Add(1)
+	return nil
+}
+
+// Stats returns statistics of cache and its layers.
+func (t *Tiered[K, V]) Stats() TieredStats {
+	return TieredStats{
+		Hits:       t.hits.Load(),
+		Misses:     t.misses.Load(),
+		Promotions: t.promoted.Load(),
+		Demotions:  t.demotions.Load(),
+		L1:         t.l1.Stats(),
+		L2:         t.l2.Stats(),
+	}
+}
+
+func scale(ttl time.Duration, factor float64) time.Duration {
+	return time.Duration(float64(ttl) * factor)
+}
+
+// cacheLayer is layer of in-memory cache.
+type cacheLayer[K comparable, V any] struct {
+	cache *Cache[K, V]
+}
+
+// CacheLayer returns layer of given cache.
+func CacheLayer[K comparable, V any](c *Cache[K, V]) Layer[K, V] {
+	return cacheLayer[K, V]{cache: c}
+}
+
+func (l cacheLayer[K, V]) Get(_ context.Context, key K) (V, time.Duration, bool, error) {
+	value, deadline, ok := l.cache.GetWithExpiry(key)
+	if !ok || deadline.IsZero() {
+		return value, 0, ok, nil
+	}
+	ttl := deadline.Sub(l.cache.clock.Now())
+	if ttl <= 0 {
+		var v V
+		return v, 0, false, nil
+	}
+	return value, ttl, true, nil
+}
+
+func (l cacheLayer[K, V]) Set(_ context.Context, key K, value V, ttl time.Duration) error {
+	if ttl > 0 {
+		return l.cache.store(key, value, func(key K, value V) { l.cache.setNX(key, value, ttl) })
+	}
+	// NOTE: zero TTL means that value does not expire, so default TTL of
+	// cache is not applied.
+	return l.cache.store(key, value, l.cache.set)
+}
+
+func (l cacheLayer[K, V]) Remove(_ context.Context, key K) error {
+	l.cache.Remove(key)
+	return nil
+}
+
+func (l cacheLayer[K, V]) Stats() Stats {
+	return l.cache.Stats()
+}
+
+// storeLayer is layer of overflow store, which counts its own statistics.
+type storeLayer[K comparable, V any] struct {
+	overflow *overflow[K, V]
+	clock    Clock
+	stats    *counters
+}
+
+// StoreLayer returns layer of given store, e.g. disk store returned by
+// NewDirStore. Keys and values are encoded by encoding/gob. Len of its
+// statistics is always zero. Deadlines of entries are measured by clock
+// set by WithClock, failures are logged by logger set by WithLogger, other
+// options are ignored.
+func StoreLayer[K comparable, V any](store OverflowStore, opts ...Option) Layer[K, V] {
+	cfg := config{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.clock == nil {
+		cfg.clock = systemClock{}
+	}
+	return storeLayer[K, V]{
+		overflow: newOverflow[K, V](store, false, cfg.logger),
+		clock:    cfg.clock,
+		stats:    new(counters),
+	}
+}
+
+func (l storeLayer[K, V]) Get(_ context.Context, key K) (V, time.Duration, bool, error) {
+	value, deadline, ok, err := l.overflow.get(key)
+	if err == nil && ok && !deadline.IsZero() && !deadline.After(l.clock.Now()) {
+		l.overflow.remove(key)
+		ok = false
+	}
+	if err != nil || !ok {
+		l.stats.RecordMiss()
+		var v V
+		return v, 0, false, err
+	}
+	l.stats.RecordHit()
+	if deadline.IsZero() {
+		return value, 0, true, nil
+	}
+	return value, deadline.Sub(l.clock.Now()), true, nil
+}
+
+func (l storeLayer[K, V]) Set(_ context.Context, key K, value V, ttl time.Duration) error {
+	var deadline time.Time
+	if ttl > 0 {
+		deadline = l.clock.Now().Add(ttl)
+	}
+	l.stats.RecordSet()
+	return l.overflow.put(key, value, deadline)
+}
+
+func (l storeLayer[K, V]) Remove(_ context.Context, key K) error {
+	return l.overflow.remove(key)
+}
+
+func (l storeLayer[K, V]) Stats() Stats {
+	return Stats{
+		Hits:   l.stats.hits.Load(),
+		Misses: l.stats.misses.Load(),
+		Sets:   l.stats.sets.Load(),
+	}
+}
@@ -0,0 +1,99 @@
+package tiered
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RedisClient executes Redis commands of store, nil reply is returned as
+// nil value without error, so missing key is not failure. For example,
+// client of github.com/redis/go-redis is adapted as:
+//
+//	type client struct{ rdb *redis.Client }
+//
+//	func (c client) Do(ctx context.Context, args ...any) (any, error) {
+//		reply, err := c.rdb.Do(ctx, args...).Result()
+//		if errors.Is(err, redis.Nil) {
+//			return nil, nil
+//		}
+//		return reply, err
+//	}
+type RedisClient interface {
+	// Do executes command, bulk string is replied as string or []byte,
+	// integer as int64 and array as []any.
+	Do(ctx context.Context, args ...any) (any, error)
+}
+
+// getScript reads value and its remaining time to live in milliseconds
+// atomically.
+const getScript = `return {redis.call('GET', KEYS[1]), redis.call('PTTL', KEYS[1])}`
+
+// redisStore is remote store kept by Redis.
+type redisStore struct {
+	client RedisClient
+}
+
+// NewRedisStore returns remote store, which keeps values in Redis by given
+// client. Remaining TTL of value is read with it atomically by script.
+func NewRedisStore(client RedisClient) RemoteStore {
+	return redisStore{client: client}
+}
+
+func (s redisStore) Get(ctx context.Context, key string) ([]byte, time.Duration, bool, error) {
+	reply, err := s.client.Do(ctx, "EVAL", getScript, 1, key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	fields, ok := reply.([]any)
+	if !ok || len(fields) != 2 {
+		return nil, 0, false, fmt.Errorf("tiered: unexpected redis reply %v", reply)
+	}
+
+	var value []byte
+	switch v := fields[0].(type) {
+	case nil:
+		return nil, 0, false, nil
+	case string:
+		value = []byte(v)
+	case []byte:
+		value = v
+	default:
+		return nil, 0, false, fmt.Errorf("tiered: unexpected redis value %T", v)
+	}
+	ttl, err := redisInt(fields[1])
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if ttl < 0 {
+		// NOTE: PTTL replies -1 for key without expiration.
+		return value, 0, true, nil
+	}
+	return value, time.Duration(ttl) * time.Millisecond, true, nil
+}
+
+func (s redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []any{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", max(ttl.Milliseconds(), 1))
+	}
+	_, err := s.client.Do(ctx, args...)
+	return err
+}
+
+func (s redisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Do(ctx, "DEL", key)
+	return err
+}
+
+// redisInt returns integer of reply.
+func redisInt(reply any) (int64, error) {
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("tiered: unexpected redis integer %T", reply)
+}
@@ -0,0 +1,90 @@
+package tiered
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// fakeRedis is Redis client, which executes commands used by redis store
+// against map.
+type fakeRedis struct {
+	lock      sync.Mutex
+	values    map[string]string
+	deadlines map[string]time.Time
+}
+
+func (r *fakeRedis) Do(_ context.Context, args ...any) (any, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := fmt.Sprint(args[len(args)-1])
+	switch args[0] {
+	case "EVAL":
+		if args[1] != getScript {
+			return nil, fmt.Errorf(`unexpected script %v`, args[1])
+		}
+		value, ok := r.values[key]
+		if !ok {
+			return []any{nil, int64(-2)}, nil
+		}
+		deadline, expiring := r.deadlines[key]
+		if !expiring {
+			return []any{value, int64(-1)}, nil
+		}
+		return []any{value, time.Until(deadline).Milliseconds()}, nil
+	case "SET":
+		key = args[1].(string)
+		r.values[key] = string(args[2].([]byte))
+		delete(r.deadlines, key)
+		if len(args) == 5 && args[3] == "PX" {
+			r.deadlines[key] = time.Now().Add(time.Duration(args[4].(int64)) * time.Millisecond)
+		}
+		return "OK", nil
+	case "DEL":
+		delete(r.values, key)
+		delete(r.deadlines, key)
+		return int64(1), nil
+	}
+	return nil, fmt.Errorf(`unexpected command %v`, args[0])
+}
+
+func Test_RedisStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	redis := &fakeRedis{values: map[string]string{}, deadlines: map[string]time.Time{}}
+	writer := New(cache.NewCache[string, int](ctx, 10), NewRedisStore(redis))
+	reader := New(cache.NewCache[string, int](ctx, 10), NewRedisStore(redis))
+
+	if err := writer.Set(ctx, `expiring`, 1, time.Hour); err != nil {
+		t.Fatalf(`unexpected set error: %v`, err)
+	}
+	if err := writer.Set(ctx, `persistent`, 2, 0); err != nil {
+		t.Fatalf(`unexpected set error: %v`, err)
+	}
+	if value, ok, err := reader.Get(ctx, `expiring`); err != nil || !ok || value != 1 {
+		t.Fatalf(`expected value read from redis, got %d, %v`, value, err)
+	}
+	if ttl, ok := reader.Local().GetTTL(`expiring`); !ok || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf(`expected remaining TTL read from redis, got %s`, ttl)
+	}
+	if value, ok, _ := reader.Get(ctx, `persistent`); !ok || value != 2 {
+		t.Fatalf(`expected persistent value read from redis`)
+	}
+	if ttl, _ := reader.Local().GetTTL(`persistent`); ttl != 0 {
+		t.Fatalf(`expected value without expiration, got %s`, ttl)
+	}
+
+	if err := writer.Remove(ctx, `expiring`); err != nil {
+		t.Fatalf(`unexpected remove error: %v`, err)
+	}
+	reader.Local().Remove(`expiring`)
+	if _, ok, err := reader.Get(ctx, `expiring`); ok || err != nil {
+		t.Fatalf(`expected value deleted from redis, got %v`, err)
+	}
+}
@@ -0,0 +1,187 @@
+// Package tiered implements two-tier cache, where in-memory cache of process
+// is backed by remote store shared by replicas, e.g. Redis.
+package tiered
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// RemoteStore is shared second tier of cache, e.g. Redis store returned by
+// NewRedisStore.
+type RemoteStore interface {
+	// Get returns value by key and its remaining time to live, zero TTL
+	// means that value does not expire. ok is false if key is missing.
+	Get(ctx context.Context, key string) (value []byte, ttl time.Duration, ok bool, err error)
+	// Set stores value by key, non-positive TTL means that value does not expire.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes value by key, missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Option is an option that can be applied to tiered cache.
+type Option func(*config)
+
+type config struct {
+	prefix string
+}
+
+// WithKeyPrefix sets prefix of keys in remote store, e.g. to share store
+// by several caches.
+func WithKeyPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// Cache is in-memory cache backed by remote store. Keys of remote store are
+// formatted by fmt.Sprint, values are encoded by encoding/gob.
+type Cache[K comparable, V any] struct {
+	local  *cache.Cache[K, V]
+	remote RemoteStore
+	prefix string
+
+	// lock guards locks of keys, which serialize reads of missed keys
+	// with writes of them.
+	lock  sync.Mutex
+	locks map[K]*keyLock
+}
+
+// keyLock is lock of key with number of its holders and waiters.
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// New returns tiered cache of given in-memory cache and remote store.
+func New[K comparable, V any](local *cache.Cache[K, V], remote RemoteStore, opts ...Option) *Cache[K, V] {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Cache[K, V]{local: local, remote: remote, prefix: cfg.prefix, locks: make(map[K]*keyLock)}
+}
+
+// Get returns value by key from in-memory cache, missed value is read from
+// remote store and set to in-memory cache with its remaining TTL. Concurrent
+// callers of same missing key wait for single read until ctx is done.
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	if value, ok := c.local.Get(key); ok {
+		return value, true, nil
+	}
+
+	unlock, err := c.lockKey(ctx, key)
+	if err != nil {
+		var v V
+		return v, false, err
+	}
+	defer unlock()
+
+	// NOTE: value could be read by concurrent caller holding key lock.
+	if value, ok := c.local.Peek(key); ok {
+		return value, true, nil
+	}
+	var value V
+	data, ttl, ok, err := c.remote.Get(ctx, c.key(key))
+	if err != nil || !ok {
+		return value, false, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return value, false, fmt.Errorf("tiered: decode value: %w", err)
+	}
+	c.setLocal(key, value, ttl)
+	return value, true, nil
+}
+
+// Set writes value by key with given TTL to remote store and then to
+// in-memory cache, non-positive TTL means that value does not expire.
+// In-memory cache is not modified if write to remote store fails. Set is
+// serialized with reads of missed key, see Get.
+func (c *Cache[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return fmt.Errorf("tiered: encode value: %w", err)
+	}
+
+	unlock, err := c.lockKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := c.remote.Set(ctx, c.key(key), buf.Bytes(), ttl); err != nil {
+		return err
+	}
+	c.setLocal(key, value, ttl)
+	return nil
+}
+
+// Remove removes value by key from remote store and then from in-memory
+// cache, so value removed from memory is not read back from remote store
+// by concurrent Get. Value is removed from memory even if deletion from
+// remote store fails.
+func (c *Cache[K, V]) Remove(ctx context.Context, key K) error {
+	unlock, err := c.lockKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = c.remote.Delete(ctx, c.key(key))
+	c.local.Remove(key)
+	return err
+}
+
+// Local returns in-memory cache.
+func (c *Cache[K, V]) Local() *cache.Cache[K, V] {
+	return c.local
+}
+
+// lockKey locks given key and returns function, which unlocks it. It is
+// not lock of Cache.LockKey, so callers holding it can use tiered cache.
+func (c *Cache[K, V]) lockKey(ctx context.Context, key K) (func(), error) {
+	c.lock.Lock()
+	kl, ok := c.locks[key]
+	if !ok {
+		kl = &keyLock{ch: make(chan struct{}, 1)}
+		c.locks[key] = kl
+	}
+	kl.refs++
+	c.lock.Unlock()
+
+	release := func() {
+		c.lock.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(c.locks, key)
+		}
+		c.lock.Unlock()
+	}
+	select {
+	case kl.ch <- struct{}{}:
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-kl.ch
+		release()
+	}, nil
+}
+
+func (c *Cache[K, V]) setLocal(key K, value V, ttl time.Duration) {
+	if ttl > 0 {
+		c.local.SetNX(key, value, ttl)
+		return
+	}
+	c.local.Set(key, value)
+}
+
+func (c *Cache[K, V]) key(key K) string {
+	return c.prefix + fmt.Sprint(key)
+}
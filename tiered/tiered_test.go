@@ -0,0 +1,127 @@
+package tiered
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/moeryomenko/ttlcache"
+)
+
+// memoryStore is remote store kept in memory.
+type memoryStore struct {
+	lock   sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+	reads  int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, time.Duration, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reads++
+	value, ok := s.values[key]
+	return value, s.ttls[key], ok, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[key], s.ttls[key] = value, ttl
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+func Test_Tiered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote := newMemoryStore()
+	writer := New(cache.NewCache[string, int](ctx, 10), remote, WithKeyPrefix(`app:`))
+	reader := New(cache.NewCache[string, int](ctx, 10), remote, WithKeyPrefix(`app:`))
+
+	if err := writer.Set(ctx, `key`, 1, time.Hour); err != nil {
+		t.Fatalf(`unexpected set error: %v`, err)
+	}
+	if _, ok := remote.values[`app:key`]; !ok {
+		t.Fatal(`expected value written to remote store`)
+	}
+	if value, ok := writer.Local().Peek(`key`); !ok || value != 1 {
+		t.Fatal(`expected value written to local cache`)
+	}
+
+	for i := 0; i < 2; i++ {
+		if value, ok, err := reader.Get(ctx, `key`); !ok || err != nil || value != 1 {
+			t.Fatalf(`expected value read from remote store, got %d, %v`, value, err)
+		}
+	}
+	if remote.reads != 1 {
+		t.Fatalf(`expected remote value cached locally, got %d reads`, remote.reads)
+	}
+	if ttl, ok := reader.Local().GetTTL(`key`); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf(`expected remote TTL applied locally, got %s`, ttl)
+	}
+
+	if err := reader.Remove(ctx, `key`); err != nil {
+		t.Fatalf(`unexpected remove error: %v`, err)
+	}
+	if _, ok, _ := reader.Get(ctx, `key`); ok {
+		t.Fatal(`expected value removed from both tiers`)
+	}
+}
+
+// nopBacking is backing store, which stores nothing.
+type nopBacking struct{}
+
+func (nopBacking) Write(context.Context, string, int) error { return nil }
+
+func (nopBacking) Delete(context.Context, string) error { return nil }
+
+func Test_TieredLocking(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	local := cache.NewCache[string, int](ctx, 10, cache.WithWriteThrough[string, int](nopBacking{}))
+	c := New(local, newMemoryStore())
+
+	// NOTE: tiered cache does not wait for lock of key held by caller.
+	done := make(chan error, 1)
+	go func() {
+		unlock := local.LockKey(`key`)
+		defer unlock()
+		done <- c.Set(ctx, `key`, 1, time.Hour)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf(`unexpected set error: %v`, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`expected Set under LockKey not blocked`)
+	}
+
+	unlock, _ := c.lockKey(ctx, `missing`)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	if _, _, err := c.Get(waitCtx, `missing`); err != context.DeadlineExceeded {
+		t.Fatalf(`expected wait for key lock cancelled, got %v`, err)
+	}
+	unlock()
+	if _, ok, err := c.Get(ctx, `missing`); ok || err != nil {
+		t.Fatalf(`expected missing value, got %v`, err)
+	}
+	if len(c.locks) != 0 {
+		t.Fatal(`expected released locks removed`)
+	}
+}
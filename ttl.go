@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// wheelBits is number of bits of epoch indexing slots of single level.
+	wheelBits  = 6
+	wheelSlots = 1 << wheelBits
+	// wheelLevels is number of levels covering whole range of epochs.
+	wheelLevels = (64 + wheelBits - 1) / wheelBits
+)
+
+// ttlIndex is hierarchical timing wheel of keys by TTL epoch, in which they
+// expire. Slot of level L spans 64^L epochs, key is placed to level of
+// highest digit, in which its epoch differs from current one, so keys of
+// distant epochs are grouped coarsely and cascaded to lower levels as
+// current epoch approaches them. Index has own lock, so janitor detaches
+// expired keys without taking cache lock.
+type ttlIndex[K comparable] struct {
+	lock        sync.Mutex
+	epoch       uint64
+	epochStart  time.Time
+	granularity time.Duration
+	wheel       [wheelLevels][wheelSlots][]ttlItem[K]
+	// positions are positions of scheduled keys in wheel.
+	positions map[K]ttlPosition
+}
+
+type ttlItem[K comparable] struct {
+	key   K
+	epoch uint64
+}
+
+type ttlPosition struct {
+	level, slot uint8
+	index       int
+}
+
+// bucket is keys of single TTL epoch detached from index.
+type bucket[K comparable] struct {
+	epoch uint64
+	keys  []K
+}
+
+func newTTLIndex[K comparable](granularity time.Duration, now time.Time) *ttlIndex[K] {
+	return &ttlIndex[K]{
+		epochStart:  now,
+		granularity: granularity,
+		positions:   make(map[K]ttlPosition),
+	}
+}
+
+// emplace schedules key to epoch, which is collected not earlier than
+// given deadline.
+func (t *ttlIndex[K]) emplace(key K, deadline time.Time) uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	epoch := uint64(max(deadline.Sub(t.epochStart), 0)/t.granularity) + t.epoch
+	t.place(ttlItem[K]{key: key, epoch: epoch})
+	return epoch
+}
+
+func (t *ttlIndex[K]) place(item ttlItem[K]) {
+	level := 0
+	if diff := item.epoch ^ t.epoch; diff != 0 {
+		level = (bits.Len64(diff) - 1) / wheelBits
+	}
+	slot := uint8(item.epoch >> (level * wheelBits) % wheelSlots)
+	items := &t.wheel[level][slot]
+	*items = append(*items, item)
+	t.positions[item.key] = ttlPosition{level: uint8(level), slot: slot, index: len(*items) - 1}
+}
+
+// remove unschedules key.
+func (t *ttlIndex[K]) remove(key K) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.unlink(key)
+}
+
+// removeAll unschedules given keys under single acquisition of lock.
+func (t *ttlIndex[K]) removeAll(keys []K) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, key := range keys {
+		t.unlink(key)
+	}
+}
+
+// unlink releases position of key by moving last key of its slot to its
+// place, so removal does not shift other keys.
+func (t *ttlIndex[K]) unlink(key K) {
+	pos, ok := t.positions[key]
+	if !ok {
+		return
+	}
+	delete(t.positions, key)
+
+	items := t.wheel[pos.level][pos.slot]
+	last := len(items) - 1
+	if pos.index != last {
+		items[pos.index] = items[last]
+		t.positions[items[pos.index].key] = pos
+	}
+	items[last] = ttlItem[K]{}
+	t.wheel[pos.level][pos.slot] = items[:last]
+}
+
+// expired detaches keys of current epoch, if advance is true it also
+// starts next epoch at given time and cascades slots of higher levels,
+// which epochs have come into range of lower levels.
+func (t *ttlIndex[K]) expired(advance bool, now time.Time) bucket[K] {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	expired := bucket[K]{epoch: t.epoch}
+	current := &t.wheel[0][t.epoch%wheelSlots]
+	if len(*current) > 0 {
+		expired.keys = make([]K, 0, len(*current))
+		for _, item := range *current {
+			expired.keys = append(expired.keys, item.key)
+			delete(t.positions, item.key)
+		}
+		*current = nil
+	}
+	if !advance {
+		return expired
+	}
+
+	t.epoch++
+	t.epochStart = now
+	for level := 1; level < wheelLevels && t.epoch&(1<<(level*wheelBits)-1) == 0; level++ {
+		slot := &t.wheel[level][t.epoch>>(level*wheelBits)%wheelSlots]
+		items := *slot
+		*slot = nil
+		for _, item := range items {
+			t.place(item)
+		}
+	}
+	return expired
+}
+
+// due returns keys of current epoch without detaching them.
+func (t *ttlIndex[K]) due() []K {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	items := t.wheel[0][t.epoch%wheelSlots]
+	keys := make([]K, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.key)
+	}
+	return keys
+}
+
+// skip advances epoch by n at once, if no key is scheduled. Returns false
+// if keys are scheduled.
+func (t *ttlIndex[K]) skip(n uint64) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.positions) > 0 {
+		return false
+	}
+	t.epoch += n
+	t.epochStart = t.epochStart.Add(time.Duration(n) * t.granularity)
+	return true
+}
+
+// passed returns number of whole epochs passed by given time since start
+// of current epoch.
+func (t *ttlIndex[K]) passed(now time.Time) int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return int64(now.Sub(t.epochStart) / t.granularity)
+}
+
+// period returns duration of epoch.
+func (t *ttlIndex[K]) period() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.granularity
+}
+
+// rescale unschedules all keys and starts current epoch of given duration
+// at given time. Returns unscheduled keys, which must be scheduled again.
+func (t *ttlIndex[K]) rescale(granularity time.Duration, now time.Time) []K {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	keys := make([]K, 0, len(t.positions))
+	for key := range t.positions {
+		keys = append(keys, key)
+	}
+	t.wheel = [wheelLevels][wheelSlots][]ttlItem[K]{}
+	clear(t.positions)
+	t.granularity, t.epochStart = granularity, now
+	return keys
+}
+
+// scheduled returns number of scheduled keys.
+func (t *ttlIndex[K]) scheduled() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return len(t.positions)
+}
+
+// current returns current epoch and its start time.
+func (t *ttlIndex[K]) current() (epoch uint64, start time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.epoch, t.epochStart
+}
+
+// remaining returns number of scheduled keys by their approximate
+// remaining time to live.
+func (t *ttlIndex[K]) remaining(now time.Time) map[time.Duration]int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// NOTE: keys of epoch N are collected at the end of epoch N.
+	epochEnd := t.epochStart.Add(t.granularity)
+	remaining := make(map[time.Duration]int)
+	for level := range t.wheel {
+		for _, items := range t.wheel[level] {
+			for _, item := range items {
+				remaining[max(epochEnd.Sub(now)+time.Duration(item.epoch-t.epoch)*t.granularity, 0)]++
+			}
+		}
+	}
+	return remaining
+}
+
+func (t *ttlIndex[K]) clear() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.wheel = [wheelLevels][wheelSlots][]ttlItem[K]{}
+	clear(t.positions)
+}
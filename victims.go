@@ -0,0 +1,32 @@
+package cache
+
+// victims is scratch buffer of entries evicted by policy in single pass,
+// buffer is reused by subsequent evictions.
+type victims[K comparable, V any] struct {
+	keys  []K
+	items []*entry[V]
+}
+
+func newVictims[K comparable, V any](size int) victims[K, V] {
+	return victims[K, V]{
+		keys:  make([]K, 0, size),
+		items: make([]*entry[V], 0, size),
+	}
+}
+
+func (v *victims[K, V]) add(key K, item *entry[V]) {
+	v.keys = append(v.keys, key)
+	v.items = append(v.items, item)
+}
+
+// reset empties buffer, buffer grown by bulk eviction far over given size
+// is released.
+func (v *victims[K, V]) reset(size int) {
+	if cap(v.keys) > 4*size {
+		*v = newVictims[K, V](size)
+		return
+	}
+	clear(v.keys)
+	clear(v.items)
+	v.keys, v.items = v.keys[:0], v.items[:0]
+}
@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BatchStore is optionally implemented by BackingStore, which writes
+// batches of mutations queued by WithWriteBehind by single call.
+type BatchStore[K comparable, V any] interface {
+	// WriteBatch stores given values and removes given keys.
+	WriteBatch(ctx context.Context, writes map[K]V, deletes []K) error
+}
+
+// mutation is write of key queued to backing store, repeated writes of
+// key replace queued one.
+type mutation[V any] struct {
+	value    V
+	deleted  bool
+	attempts int
+}
+
+// writeBehind queues writes of cache to backing store and flushes them by
+// batches in order of first write of key.
+type writeBehind[K comparable, V any] struct {
+	store     BackingStore[K, V]
+	interval  time.Duration
+	batchSize int
+	attempts  int
+	logger    *slog.Logger
+
+	lock    sync.Mutex
+	queue   []K
+	pending map[K]*mutation[V]
+	// flushing serializes flushes, so mutations of key are not written
+	// concurrently.
+	flushing sync.Mutex
+	notify   chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+func newWriteBehind[K comparable, V any](store BackingStore[K, V], policy writeBehindPolicy, logger *slog.Logger) *writeBehind[K, V] {
+	if store == nil {
+		return nil
+	}
+	interval := policy.interval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return &writeBehind[K, V]{
+		store:     store,
+		interval:  interval,
+		batchSize: max(policy.batchSize, 1),
+		attempts:  max(policy.attempts, 1),
+		logger:    logger,
+		pending:   make(map[K]*mutation[V]),
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// run flushes queue by interval or once batch is full until it is closed.
+func (w *writeBehind[K, V]) run(ctx context.Context) {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.notify:
+		case <-w.done:
+			return
+		}
+		w.flush(ctx)
+	}
+}
+
+// enqueue queues mutation of key, replacing queued one.
+func (w *writeBehind[K, V]) enqueue(key K, m *mutation[V]) {
+	w.lock.Lock()
+	if _, queued := w.pending[key]; !queued {
+		w.queue = append(w.queue, key)
+	}
+	w.pending[key] = m
+	full := len(w.queue) >= w.batchSize
+	w.lock.Unlock()
+
+	if full {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush writes mutations queued before flush started by batches and
+// returns number of mutations queued again.
+func (w *writeBehind[K, V]) flush(ctx context.Context) int {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	w.lock.Lock()
+	remaining := len(w.queue)
+	w.lock.Unlock()
+	for remaining > 0 {
+		batch, taken := w.take(min(w.batchSize, remaining))
+		remaining -= taken
+		if len(batch) > 0 {
+			w.retry(w.write(ctx, batch))
+		}
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return len(w.queue)
+}
+
+// flushKey writes queued mutation of key, e.g. before key is loaded from
+// backing store.
+func (w *writeBehind[K, V]) flushKey(ctx context.Context, key K) {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	w.lock.Lock()
+	m, queued := w.pending[key]
+	if queued {
+		delete(w.pending, key)
+	}
+	w.lock.Unlock()
+	if queued {
+		w.retry(w.write(ctx, map[K]*mutation[V]{key: m}))
+	}
+}
+
+// take detaches up to n first keys of queue with their mutations, it
+// returns number of detached keys.
+func (w *writeBehind[K, V]) take(n int) (map[K]*mutation[V], int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	n = min(n, len(w.queue))
+	batch := make(map[K]*mutation[V], n)
+	for _, key := range w.queue[:n] {
+		// NOTE: key flushed by flushKey is left in queue.
+		if m, ok := w.pending[key]; ok {
+			batch[key] = m
+			delete(w.pending, key)
+		}
+	}
+	w.queue = w.queue[n:]
+	return batch, n
+}
+
+// write writes batch by single call of batch store or by mutation, it
+// returns failed mutations.
+func (w *writeBehind[K, V]) write(ctx context.Context, batch map[K]*mutation[V]) map[K]*mutation[V] {
+	if store, ok := w.store.(BatchStore[K, V]); ok {
+		writes := make(map[K]V, len(batch))
+		var deletes []K
+		for key, m := range batch {
+			if m.deleted {
+				deletes = append(deletes, key)
+			} else {
+				writes[key] = m.value
+			}
+		}
+		if err := store.WriteBatch(ctx, writes, deletes); err != nil {
+			logWarn(w.logger, "ttlcache: write-behind batch failed", slog.Any("error", err))
+			return batch
+		}
+		return nil
+	}
+
+	var failed map[K]*mutation[V]
+	for key, m := range batch {
+		var err error
+		if m.deleted {
+			err = w.store.Delete(ctx, key)
+		} else {
+			err = w.store.Write(ctx, key, m.value)
+		}
+		if err != nil {
+			logWarn(w.logger, "ttlcache: write-behind write failed", slog.Any("error", err))
+			if failed == nil {
+				failed = make(map[K]*mutation[V])
+			}
+			failed[key] = m
+		}
+	}
+	return failed
+}
+
+// retry queues failed mutations again, unless key is written again or
+// mutation has failed all attempts.
+func (w *writeBehind[K, V]) retry(failed map[K]*mutation[V]) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for key, m := range failed {
+		if _, queued := w.pending[key]; queued {
+			continue
+		}
+		if m.attempts++; m.attempts >= w.attempts {
+			logWarn(w.logger, "ttlcache: write-behind mutation dropped", slog.Int("attempts", m.attempts))
+			continue
+		}
+		w.queue = append(w.queue, key)
+		w.pending[key] = m
+	}
+}
+
+// close stops flushing by interval and writes queued mutations, failed
+// mutations are retried until they fail all attempts.
+func (w *writeBehind[K, V]) close() {
+	w.once.Do(func() {
+		close(w.done)
+		<-w.stopped
+		for w.flush(context.Background()) > 0 {
+		}
+	})
+}
+
+// queueWrite queues write of value to backing store configured by
+// WithWriteBehind. Must be called under cache lock, so mutations are
+// queued in order of modifications of cache.
+func (c *Cache[K, V]) queueWrite(key K, value V) {
+	if c.writeBehind != nil {
+		c.writeBehind.enqueue(key, &mutation[V]{value: value})
+	}
+}
+
+// queueDelete queues deletion of key from backing store configured by
+// WithWriteBehind. Must be called under cache lock.
+func (c *Cache[K, V]) queueDelete(key K) {
+	if c.writeBehind != nil {
+		c.writeBehind.enqueue(key, &mutation[V]{deleted: true})
+	}
+}
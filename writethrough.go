@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+)
+
+// BackingStore is slow key-value store fronted by cache, see
+// WithWriteThrough.
+type BackingStore[K comparable, V any] interface {
+	// Write stores value by key.
+	Write(ctx context.Context, key K, value V) error
+	// Delete removes value by key, missing key is not an error.
+	Delete(ctx context.Context, key K) error
+}
+
+// writeThrough writes value to backing store before it is set to cache.
+// Failed write is logged and key is removed from cache, since state of
+// store is unknown. Must be called under write lock of key, see lockWrite, so writes of key
+// reach store and cache in the same order.
+func (c *Cache[K, V]) writeThrough(key K, value V) error {
+	err := c.backing.Write(c.ctx, key, value)
+	if err == nil {
+		return nil
+	}
+	logWarn(c.logger, "ttlcache: write to backing store failed", slog.Any("error", err))
+
+	c.acquire()
+	defer c.release()
+
+	c.remove(key, Removed)
+	return err
+}
+
+// deleteThrough deletes key from backing store before it is removed from
+// cache. Failed deletion is logged. Must be called under write lock of key.
+func (c *Cache[K, V]) deleteThrough(key K) {
+	if err := c.backing.Delete(c.ctx, key); err != nil {
+		logWarn(c.logger, "ttlcache: delete from backing store failed", slog.Any("error", err))
+	}
+}